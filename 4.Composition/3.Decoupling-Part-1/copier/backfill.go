@@ -0,0 +1,331 @@
+package copier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Partition is a slice of the source covering keys from From up to but not
+// including To. The bounds are both ints or both times.
+type Partition struct {
+	Name string
+	From Value
+	To   Value
+}
+
+// Contains reports whether v falls in the partition.
+func (p Partition) Contains(v Value) bool {
+	switch p.From.Kind() {
+	case KindInt:
+		return v.Kind() == KindInt && v.Int() >= p.From.Int() && v.Int() < p.To.Int()
+	case KindTime:
+		return v.Kind() == KindTime && !v.Time().Before(p.From.Time()) && v.Time().Before(p.To.Time())
+	}
+	return false
+}
+
+// Split divides the keys from from up to but not including to into n
+// partitions of the same size, give or take one key or nanosecond. The
+// bounds are both ints, for a key range, or both times, for a time window.
+func Split(from, to Value, n int) ([]Partition, error) {
+	if from.Kind() != to.Kind() {
+		return nil, fmt.Errorf("split: bounds are %s and %s", from.Kind(), to.Kind())
+	}
+	if n <= 0 {
+		return nil, errors.New("split: need at least one partition")
+	}
+
+	var lo, hi int64
+	switch from.Kind() {
+	case KindInt:
+		lo, hi = from.Int(), to.Int()
+	case KindTime:
+		lo, hi = from.Time().UnixNano(), to.Time().UnixNano()
+	default:
+		return nil, fmt.Errorf("split: can't split %s bounds", from.Kind())
+	}
+	if hi <= lo {
+		return nil, errors.New("split: empty range")
+	}
+	if span := hi - lo; int64(n) > span {
+		n = int(span)
+	}
+
+	value := func(v int64) Value {
+		if from.Kind() == KindInt {
+			return Int(v)
+		}
+		return Time(time.Unix(0, v).In(from.Time().Location()))
+	}
+
+	size, extra := (hi-lo)/int64(n), (hi-lo)%int64(n)
+
+	parts := make([]Partition, n)
+	start := lo
+	for i := range parts {
+		end := start + size
+		if int64(i) < extra {
+			end++
+		}
+
+		parts[i] = Partition{
+			Name: fmt.Sprintf("part-%03d", i),
+			From: value(start),
+			To:   value(end),
+		}
+		start = end
+	}
+
+	return parts, nil
+}
+
+// =============================================================================
+
+// The states a partition goes through.
+const (
+	PartitionPending = "pending"
+	PartitionRunning = "running"
+	PartitionRetry   = "retry"
+	PartitionDone    = "done"
+	PartitionFailed  = "failed"
+)
+
+// PartitionStatus describes where a partition is.
+type PartitionStatus struct {
+	Name     string
+	State    string
+	Attempts int
+	Records  int   // Records copied, counting those of earlier runs.
+	Err      error // Error of the last attempt.
+}
+
+// BackfillProgress describes where a backfill is.
+type BackfillProgress struct {
+	Partitions []PartitionStatus
+	Done       int
+	Failed     int
+	Records    int
+}
+
+// Backfill copies a source partition by partition with a pool of workers.
+// Each partition has its own Puller and its own checkpoint, so a partition
+// that fails is retried from where it stopped and a backfill that is run
+// again skips what it already copied.
+type Backfill struct {
+	Partitions []Partition
+
+	// Source returns a Puller handing out the records of a partition. It
+	// is called for every attempt, and the Puller is closed when the
+	// attempt is over if it is an io.Closer.
+	Source func(p Partition) (CursorPuller, error)
+
+	// Dest returns the Storer the records of a partition go to. It is
+	// called and closed like Source. Workers store at the same time, so a
+	// Storer shared between partitions must be safe for concurrent use and
+	// must not be an io.Closer.
+	Dest func(p Partition) (Storer, error)
+
+	Dir     string        // Directory the checkpoints are kept in.
+	Workers int           // Partitions copied at the same time. Zero means 4.
+	Batch   int           // Records per batch. Zero means 100.
+	Retries int           // Attempts after the first for a partition that fails.
+	Backoff time.Duration // Wait before a retry, growing with each one.
+
+	mu     sync.Mutex
+	status []PartitionStatus
+	counts []int64
+}
+
+// Run copies every partition. It returns io.EOF when every partition was
+// drained and otherwise an error naming the partitions that failed after
+// their retries. Cancelling ctx stops the copies after their current
+// record.
+func (b *Backfill) Run(ctx context.Context) error {
+	workers, batch := b.Workers, b.Batch
+	if workers <= 0 {
+		workers = 4
+	}
+	if batch <= 0 {
+		batch = 100
+	}
+
+	b.mu.Lock()
+	b.status = make([]PartitionStatus, len(b.Partitions))
+	b.counts = make([]int64, len(b.Partitions))
+	for i, p := range b.Partitions {
+		b.status[i] = PartitionStatus{Name: p.Name, State: PartitionPending}
+	}
+	b.mu.Unlock()
+
+	// Every partition is in the queue at most once, so sends never block.
+	queue := make(chan int, len(b.Partitions))
+	for i := range b.Partitions {
+		queue <- i
+	}
+
+	var outstanding sync.WaitGroup
+	outstanding.Add(len(b.Partitions))
+
+	var workerWG sync.WaitGroup
+	workerWG.Add(workers)
+
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer workerWG.Done()
+
+			for i := range queue {
+				if ctx.Err() != nil {
+					b.finish(i, ctx.Err())
+					outstanding.Done()
+					continue
+				}
+
+				err := b.copy(ctx, i, batch)
+
+				b.mu.Lock()
+				st := &b.status[i]
+				st.Err = err
+				retry := err != io.EOF && ctx.Err() == nil && st.Attempts <= b.Retries
+				if retry {
+					st.State = PartitionRetry
+				}
+				attempts := st.Attempts
+				b.mu.Unlock()
+
+				if !retry {
+					b.finish(i, err)
+					outstanding.Done()
+					continue
+				}
+
+				go func(i int, wait time.Duration) {
+					time.Sleep(wait)
+					queue <- i
+				}(i, time.Duration(attempts)*b.Backoff)
+			}
+		}()
+	}
+
+	outstanding.Wait()
+	close(queue)
+	workerWG.Wait()
+
+	prog := b.Progress()
+	if prog.Failed == 0 {
+		return io.EOF
+	}
+
+	for _, st := range prog.Partitions {
+		if st.State == PartitionFailed {
+			return fmt.Errorf("backfill: %d of %d partitions failed, %s: %w", prog.Failed, len(prog.Partitions), st.Name, st.Err)
+		}
+	}
+	return nil
+}
+
+// copy makes an attempt at copying partition i. The attempt is counted
+// before anything can fail, so a partition that can't even start runs out
+// of retries like any other.
+func (b *Backfill) copy(ctx context.Context, i int, batch int) error {
+	p := b.Partitions[i]
+
+	b.mu.Lock()
+	b.status[i].State = PartitionRunning
+	b.status[i].Attempts++
+	atomic.StoreInt64(&b.counts[i], 0)
+	b.mu.Unlock()
+
+	cp, err := NewCheckpoint(filepath.Join(b.Dir, p.Name+".checkpoint"))
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	b.status[i].Records = cp.State().Records
+	b.mu.Unlock()
+
+	src, err := b.Source(p)
+	if err != nil {
+		return err
+	}
+	defer closeIfCloser(src)
+
+	dst, err := b.Dest(p)
+	if err != nil {
+		return err
+	}
+	defer closeIfCloser(dst)
+
+	return CopyWithCheckpoint(&countPuller{CursorPuller: src, ctx: ctx, n: &b.counts[i]}, dst, batch, cp)
+}
+
+// closeIfCloser closes v when it has a Close method.
+func closeIfCloser(v interface{}) {
+	if c, ok := v.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+// finish records the outcome of a partition that won't be tried again.
+func (b *Backfill) finish(i int, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	st := &b.status[i]
+	st.Err = err
+	st.State = PartitionFailed
+	if err == io.EOF {
+		st.State = PartitionDone
+		st.Err = nil
+	}
+}
+
+// Progress returns where the backfill is. It is safe to call while Run is
+// running.
+func (b *Backfill) Progress() BackfillProgress {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	prog := BackfillProgress{Partitions: make([]PartitionStatus, len(b.status))}
+	for i, st := range b.status {
+		st.Records += int(atomic.LoadInt64(&b.counts[i]))
+		prog.Partitions[i] = st
+		prog.Records += st.Records
+
+		switch st.State {
+		case PartitionDone:
+			prog.Done++
+		case PartitionFailed:
+			prog.Failed++
+		}
+	}
+
+	return prog
+}
+
+// countPuller counts the records pulled and stops pulling once its context
+// is cancelled.
+type countPuller struct {
+	CursorPuller
+	ctx context.Context
+	n   *int64
+}
+
+// Pull implements the Puller interface.
+func (cp *countPuller) Pull(d *Data) error {
+	if err := cp.ctx.Err(); err != nil {
+		return err
+	}
+
+	err := cp.CursorPuller.Pull(d)
+	if err == nil {
+		atomic.AddInt64(cp.n, 1)
+	}
+	return err
+}
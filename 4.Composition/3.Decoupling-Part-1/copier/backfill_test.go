@@ -0,0 +1,305 @@
+package copier_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier"
+)
+
+// keyed is a Puller handing out the records with ids in a partition. It
+// fails with a read error at failAt, if set.
+type keyed struct {
+	next   int64
+	to     int64
+	failAt int64
+}
+
+func (k *keyed) Pull(d *copier.Data) error {
+	switch {
+	case k.failAt > 0 && k.next == k.failAt:
+		return errors.New("error reading data from Xenia")
+	case k.next == k.to:
+		return io.EOF
+	}
+
+	d.Line = fmt.Sprintf("record %d", k.next)
+	d.Fields = map[string]copier.Value{"id": copier.Int(k.next)}
+	k.next++
+	return nil
+}
+
+func (k *keyed) Cursor() string {
+	return strconv.FormatInt(k.next, 10)
+}
+
+func (k *keyed) Seek(cursor string) error {
+	n, err := strconv.ParseInt(cursor, 10, 64)
+	if err != nil {
+		return err
+	}
+	k.next = n
+	return nil
+}
+
+// ids is a Storer counting how many times each id was stored.
+type ids struct {
+	mu    sync.Mutex
+	count map[int64]int
+}
+
+func (s *ids) Store(d *copier.Data) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.count == nil {
+		s.count = make(map[int64]int)
+	}
+	s.count[d.Fields["id"].Int()]++
+	return nil
+}
+
+// once reports whether every id below n was stored exactly once.
+func (s *ids) once(n int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.count) != int(n) {
+		return false
+	}
+	for id := int64(0); id < n; id++ {
+		if s.count[id] != 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// TestSplit validates ranges are split into contiguous partitions.
+func TestSplit(t *testing.T) {
+	t.Log("Given the need to split a source into partitions.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen splitting a key range that doesn't divide evenly.", testID)
+		{
+			parts, err := copier.Split(copier.Int(0), copier.Int(10), 3)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould split the range : %v", failed, testID, err)
+			}
+
+			var sizes []int64
+			for _, p := range parts {
+				sizes = append(sizes, p.To.Int()-p.From.Int())
+			}
+			if fmt.Sprint(sizes) == "[4 3 3]" && parts[2].To.Int() == 10 && parts[1].From.Int() == parts[0].To.Int() {
+				t.Logf("\t%s\tTest %d:\tShould cover the range without gaps.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould cover the range without gaps : %v", failed, testID, sizes)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen splitting a time window.", testID)
+		{
+			from := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+			parts, err := copier.Split(copier.Time(from), copier.Time(from.Add(3*time.Hour)), 3)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould split the window : %v", failed, testID, err)
+			}
+
+			mid := copier.Time(from.Add(90 * time.Minute))
+			if parts[1].From.Time().Equal(from.Add(time.Hour)) && parts[1].Contains(mid) && !parts[0].Contains(mid) {
+				t.Logf("\t%s\tTest %d:\tShould split the window into hours.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould split the window into hours : %+v", failed, testID, parts)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen the bounds are of different kinds.", testID)
+		{
+			if _, err := copier.Split(copier.Int(0), copier.String("z"), 2); err != nil {
+				t.Logf("\t%s\tTest %d:\tShould refuse to split : %v", succeed, testID, err)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould refuse to split.", failed, testID)
+			}
+		}
+	}
+}
+
+// TestBackfill validates partitions are copied in parallel, retried from
+// their checkpoints and skipped once done.
+func TestBackfill(t *testing.T) {
+	const n = 1000
+
+	t.Log("Given the need to backfill a source in partitions.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a partition fails once.", testID)
+		{
+			parts, _ := copier.Split(copier.Int(0), copier.Int(n), 8)
+
+			var mu sync.Mutex
+			failed3 := false
+			dst := ids{}
+
+			b := copier.Backfill{
+				Partitions: parts,
+				Source: func(p copier.Partition) (copier.CursorPuller, error) {
+					k := keyed{next: p.From.Int(), to: p.To.Int()}
+
+					mu.Lock()
+					defer mu.Unlock()
+					if p.Name == "part-003" && !failed3 {
+						failed3 = true
+						k.failAt = p.From.Int() + 57
+					}
+					return &k, nil
+				},
+				Dest:    func(p copier.Partition) (copier.Storer, error) { return &dst, nil },
+				Dir:     t.TempDir(),
+				Workers: 3,
+				Batch:   20,
+				Retries: 2,
+				Backoff: time.Millisecond,
+			}
+
+			if err := b.Run(context.Background()); err != io.EOF {
+				t.Fatalf("\t%s\tTest %d:\tShould copy every partition : %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould copy every partition.", succeed, testID)
+
+			if dst.once(n) {
+				t.Logf("\t%s\tTest %d:\tShould store every record once.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould store every record once.", failed, testID)
+			}
+
+			prog := b.Progress()
+			if prog.Done == 8 && prog.Records == n && prog.Partitions[3].Attempts == 2 {
+				t.Logf("\t%s\tTest %d:\tShould report the retry in the progress.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould report the retry in the progress : %+v", failed, testID, prog)
+			}
+
+			// Running it again finds every partition at its end.
+			if err := b.Run(context.Background()); err != io.EOF || !dst.once(n) {
+				t.Errorf("\t%s\tTest %d:\tShould skip what was copied : %v", failed, testID, err)
+			} else {
+				t.Logf("\t%s\tTest %d:\tShould skip what was copied.", succeed, testID)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen a partition keeps failing.", testID)
+		{
+			parts, _ := copier.Split(copier.Int(0), copier.Int(n), 4)
+			dst := ids{}
+
+			b := copier.Backfill{
+				Partitions: parts,
+				Source: func(p copier.Partition) (copier.CursorPuller, error) {
+					k := keyed{next: p.From.Int(), to: p.To.Int()}
+					if p.Name == "part-001" {
+						k.failAt = p.From.Int() + 10
+					}
+					return &k, nil
+				},
+				Dest:    func(p copier.Partition) (copier.Storer, error) { return &dst, nil },
+				Dir:     t.TempDir(),
+				Workers: 2,
+				Retries: 1,
+			}
+
+			err := b.Run(context.Background())
+			if err != nil && err != io.EOF && strings.Contains(err.Error(), "part-001") {
+				t.Logf("\t%s\tTest %d:\tShould name the partition that failed : %v", succeed, testID, err)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould name the partition that failed : %v", failed, testID, err)
+			}
+
+			prog := b.Progress()
+			st := prog.Partitions[1]
+			if prog.Done == 3 && prog.Failed == 1 && st.State == copier.PartitionFailed && st.Attempts == 2 && st.Records == 10 {
+				t.Logf("\t%s\tTest %d:\tShould give up after the retries.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould give up after the retries : %+v", failed, testID, prog)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen a partition can't read its checkpoint.", testID)
+		{
+			parts, _ := copier.Split(copier.Int(0), copier.Int(n), 2)
+			dir := t.TempDir()
+			os.WriteFile(filepath.Join(dir, "part-000.checkpoint"), []byte("{corrupt"), 0644)
+
+			var mu sync.Mutex
+			opened, closed := 0, 0
+			dst := ids{}
+
+			b := copier.Backfill{
+				Partitions: parts,
+				Source: func(p copier.Partition) (copier.CursorPuller, error) {
+					mu.Lock()
+					defer mu.Unlock()
+					opened++
+					return &closing{keyed: keyed{next: p.From.Int(), to: p.To.Int()}, mu: &mu, closed: &closed}, nil
+				},
+				Dest:    func(p copier.Partition) (copier.Storer, error) { return &dst, nil },
+				Dir:     dir,
+				Workers: 2,
+				Retries: 2,
+			}
+
+			done := make(chan error, 1)
+			go func() {
+				done <- b.Run(context.Background())
+			}()
+
+			select {
+			case err := <-done:
+				st := b.Progress().Partitions[0]
+				if err != nil && err != io.EOF && st.State == copier.PartitionFailed && st.Attempts == 3 {
+					t.Logf("\t%s\tTest %d:\tShould give up after the retries : %v", succeed, testID, err)
+				} else {
+					t.Errorf("\t%s\tTest %d:\tShould give up after the retries : %v %+v", failed, testID, err, st)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("\t%s\tTest %d:\tShould give up after the retries : still running", failed, testID)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if opened == 1 && closed == 1 {
+				t.Logf("\t%s\tTest %d:\tShould close the Puller of every attempt.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould close the Puller of every attempt : opened %d, closed %d", failed, testID, opened, closed)
+			}
+		}
+	}
+}
+
+// closing is a keyed Puller counting how many times it is closed.
+type closing struct {
+	keyed
+	mu     *sync.Mutex
+	closed *int
+}
+
+func (c *closing) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	*c.closed++
+	return nil
+}
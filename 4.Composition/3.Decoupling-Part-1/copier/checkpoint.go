@@ -0,0 +1,202 @@
+package copier
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// CursorPuller is a Puller that knows its position in the source. Cursor
+// returns an opaque value describing the position right after the last
+// record pulled and Seek moves the Puller back to a position it reported.
+type CursorPuller interface {
+	Puller
+	Cursor() string
+	Seek(cursor string) error
+}
+
+// Range is the span of the source covered by a batch.
+type Range struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// State is what a checkpoint file records about a copy.
+type State struct {
+	Run     string    `json:"run,omitempty"`     // Id of the copy, part of the id of every batch.
+	Cursor  string    `json:"cursor"`            // Position after the last committed batch.
+	Pending *Range    `json:"pending,omitempty"` // Batch being stored when the state was written.
+	Batches int       `json:"batches"`           // Number of committed batches.
+	Records int       `json:"records"`           // Number of committed records.
+	Updated time.Time `json:"updated"`
+}
+
+// Checkpoint persists the progress of a copy to a local file so a copy that
+// failed halfway can resume instead of starting over.
+//
+// It follows write-ahead rules. Before a batch is stored its range is
+// written as pending, and only once the store succeeds is the cursor moved
+// past it. A crash between the store and the commit leaves the batch pending
+// and a resumed copy stores it again, so a batch can be stored twice but is
+// never skipped.
+type Checkpoint struct {
+	path  string
+	state State
+}
+
+// NewCheckpoint constructs a checkpoint backed by the specified file and
+// loads the state already in it. A missing file is an empty state.
+func NewCheckpoint(path string) (*Checkpoint, error) {
+	cp := Checkpoint{
+		path: path,
+	}
+
+	b, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return &cp, nil
+	case err != nil:
+		return nil, fmt.Errorf("read checkpoint: %w", err)
+	}
+
+	if err := json.Unmarshal(b, &cp.state); err != nil {
+		return nil, fmt.Errorf("decode checkpoint %s: %w", path, err)
+	}
+
+	return &cp, nil
+}
+
+// State returns the current state of the checkpoint.
+func (cp *Checkpoint) State() State {
+	return cp.state
+}
+
+// Begin records that the batch covering r is about to be stored. The first
+// batch also gets the copy its id.
+func (cp *Checkpoint) Begin(r Range) error {
+	s := cp.state
+	s.Pending = &r
+	if s.Run == "" {
+		s.Run = newRun()
+	}
+
+	return cp.write(s)
+}
+
+// Commit records that the pending batch of n records was stored.
+func (cp *Checkpoint) Commit(n int) error {
+	if cp.state.Pending == nil {
+		return errors.New("commit checkpoint: no pending batch")
+	}
+
+	s := cp.state
+	s.Cursor = s.Pending.To
+	s.Pending = nil
+	s.Batches++
+	s.Records += n
+
+	return cp.write(s)
+}
+
+// write replaces the checkpoint file with the new state. The state is
+// written to a temporary file that is synced and renamed over the old one,
+// so the file on disk is always either the old or the new state.
+func (cp *Checkpoint) write(s State) error {
+	s.Updated = time.Now().UTC()
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("encode checkpoint: %w", err)
+	}
+
+	if err := writeFileAtomic(cp.path, b); err != nil {
+		return fmt.Errorf("write checkpoint: %w", err)
+	}
+
+	cp.state = s
+	return nil
+}
+
+// writeFileAtomic writes b to path by way of a synced temporary file in the
+// same directory and a rename.
+func writeFileAtomic(path string, b []byte) error {
+	dir := filepath.Dir(path)
+
+	f, err := os.CreateTemp(dir, filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	// Sync the directory so the rename itself survives a crash.
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+// =============================================================================
+
+// CopyWithCheckpoint behaves like Copy except it persists its progress to
+// the checkpoint after every batch it stores. If the checkpoint already has
+// progress in it, the Puller is moved to the last committed cursor first,
+// so restarting a failed copy resumes where it left off. A TxStorer gets
+// the id of the copy kept in the checkpoint and the cursor a batch starts
+// at as the batch id, the same every time the batch is stored.
+func CopyWithCheckpoint(p CursorPuller, s Storer, batch int, cp *Checkpoint) error {
+	if cursor := cp.State().Cursor; cursor != "" {
+		if err := p.Seek(cursor); err != nil {
+			return fmt.Errorf("resume from %q: %w", cursor, err)
+		}
+	}
+
+	data := make([]Data, batch)
+
+	for {
+		from := p.Cursor()
+		i, err := pull(p, data)
+		if i > 0 {
+			if err := cp.Begin(Range{From: from, To: p.Cursor()}); err != nil {
+				return err
+			}
+
+			if _, err := storeBatch(s, batchID(cp.State().Run, from), data[:i]); err != nil {
+				return err
+			}
+
+			if err := cp.Commit(i); err != nil {
+				return err
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
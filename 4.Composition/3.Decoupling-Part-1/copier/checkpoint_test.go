@@ -0,0 +1,185 @@
+package copier_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier"
+)
+
+// want returns the lines a source of n records produces.
+func want(n int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("record %04d", i)
+	}
+	return lines
+}
+
+// covered reports whether got holds every line in want, ignoring duplicates.
+func covered(got, want []string) bool {
+	seen := make(map[string]bool)
+	for _, line := range got {
+		seen[line] = true
+	}
+	for _, line := range want {
+		if !seen[line] {
+			return false
+		}
+	}
+	return len(seen) == len(want)
+}
+
+// TestCopyWithCheckpointResume validates a copy that fails halfway resumes
+// from its checkpoint instead of starting over.
+func TestCopyWithCheckpointResume(t *testing.T) {
+	t.Log("Given the need to resume a failed copy.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the store fails after 25 of 50 records.", testID)
+		{
+			path := filepath.Join(t.TempDir(), "copy.checkpoint")
+
+			cp, err := copier.NewCheckpoint(path)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to open the checkpoint : %v", failed, testID, err)
+			}
+
+			first := sink{failAt: 25}
+			if err := copier.CopyWithCheckpoint(&source{n: 50}, &first, 10, cp); err == nil || err == io.EOF {
+				t.Fatalf("\t%s\tTest %d:\tShould fail the first copy : %v", failed, testID, err)
+			}
+
+			st := cp.State()
+			if st.Cursor == "20" && st.Records == 20 && st.Batches == 2 && st.Pending != nil {
+				t.Logf("\t%s\tTest %d:\tShould checkpoint the two stored batches.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould checkpoint the two stored batches : %+v", failed, testID, st)
+			}
+
+			// Reopen the checkpoint as a new process would.
+			cp, err = copier.NewCheckpoint(path)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to reopen the checkpoint : %v", failed, testID, err)
+			}
+
+			var second sink
+			if err := copier.CopyWithCheckpoint(&source{n: 50}, &second, 10, cp); err != io.EOF {
+				t.Fatalf("\t%s\tTest %d:\tShould finish the resumed copy : %v", failed, testID, err)
+			}
+
+			if got := second.sorted(); len(got) == 30 && got[0] == "record 0020" {
+				t.Logf("\t%s\tTest %d:\tShould resume from record 20.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould resume from record 20 : %d records from %v", failed, testID, len(got), got[:1])
+			}
+
+			if all := append(first.sorted(), second.sorted()...); covered(all, want(50)) {
+				t.Logf("\t%s\tTest %d:\tShould copy every record.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould copy every record.", failed, testID)
+			}
+
+			if st := cp.State(); st.Records == 50 && st.Pending == nil {
+				t.Logf("\t%s\tTest %d:\tShould end with nothing pending.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould end with nothing pending : %+v", failed, testID, st)
+			}
+		}
+	}
+}
+
+// TestCopyWithCheckpointCrash validates a batch stored just before a crash,
+// but never committed, is stored again rather than skipped.
+func TestCopyWithCheckpointCrash(t *testing.T) {
+	t.Log("Given the need to never skip a batch after a crash.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the process dies between the store and the commit.", testID)
+		{
+			path := filepath.Join(t.TempDir(), "copy.checkpoint")
+			cp, _ := copier.NewCheckpoint(path)
+
+			// Play the part of a copy that stored records 0-9, committed
+			// them, stored records 10-19 and then died.
+			var first sink
+			src := source{n: 30}
+			var d copier.Data
+			for i := 0; i < 20; i++ {
+				src.Pull(&d)
+				first.Store(&d)
+				if i == 9 {
+					cp.Begin(copier.Range{From: "0", To: "10"})
+					cp.Commit(10)
+				}
+			}
+			cp.Begin(copier.Range{From: "10", To: "20"})
+
+			cp, err := copier.NewCheckpoint(path)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to reopen the checkpoint : %v", failed, testID, err)
+			}
+
+			if st := cp.State(); st.Cursor == "10" && st.Pending != nil && st.Pending.To == "20" {
+				t.Logf("\t%s\tTest %d:\tShould find the batch that was pending.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould find the batch that was pending : %+v", failed, testID, st)
+			}
+
+			var second sink
+			if err := copier.CopyWithCheckpoint(&source{n: 30}, &second, 10, cp); err != io.EOF {
+				t.Fatalf("\t%s\tTest %d:\tShould finish the resumed copy : %v", failed, testID, err)
+			}
+
+			if got := second.sorted(); len(got) == 20 && got[0] == "record 0010" {
+				t.Logf("\t%s\tTest %d:\tShould store the pending batch again.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould store the pending batch again : %d records", failed, testID, len(got))
+			}
+
+			if all := append(first.sorted(), second.sorted()...); covered(all, want(30)) {
+				t.Logf("\t%s\tTest %d:\tShould copy every record.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould copy every record.", failed, testID)
+			}
+		}
+	}
+}
+
+// TestCheckpointCommit validates a commit needs a pending batch and a bad
+// cursor stops the copy before anything is stored.
+func TestCheckpointCommit(t *testing.T) {
+	t.Log("Given the need to protect the checkpoint from misuse.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen committing without a pending batch.", testID)
+		{
+			cp, _ := copier.NewCheckpoint(filepath.Join(t.TempDir(), "copy.checkpoint"))
+
+			if err := cp.Commit(10); err != nil {
+				t.Logf("\t%s\tTest %d:\tShould return an error : %v", succeed, testID, err)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould return an error.", failed, testID)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen the checkpoint is past the end of the source.", testID)
+		{
+			cp, _ := copier.NewCheckpoint(filepath.Join(t.TempDir(), "copy.checkpoint"))
+			cp.Begin(copier.Range{From: "0", To: "99"})
+			cp.Commit(99)
+
+			var s sink
+			err := copier.CopyWithCheckpoint(&source{n: 10}, &s, 10, cp)
+			if err != nil && !errors.Is(err, io.EOF) && len(s.sorted()) == 0 {
+				t.Logf("\t%s\tTest %d:\tShould refuse to resume : %v", succeed, testID, err)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould refuse to resume : %v", failed, testID, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package copier
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier/wire"
+)
+
+// How the system clients use their connections.
+const (
+	maxIdle    = 4                     // Idle connections kept per client.
+	retries    = 3                     // Attempts after the first on a new connection.
+	retryWait  = 50 * time.Millisecond // Wait before the first retry, growing with each one.
+	pullRecord = 100                   // Records asked for per pull.
+)
+
+// client sends requests to a system over pooled connections. A request
+// that fails is sent again on a new connection, which is safe because
+// every request in the protocol can be repeated.
+type client struct {
+	mu   sync.Mutex
+	idle []net.Conn
+}
+
+// do sends req to host and decodes the response into resp.
+func (c *client) do(host string, timeout time.Duration, reqType byte, req interface{}, respType byte, resp interface{}) error {
+	var err error
+
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * retryWait)
+		}
+
+		var conn net.Conn
+		if conn, err = c.get(host, timeout); err != nil {
+			continue
+		}
+
+		if timeout > 0 {
+			conn.SetDeadline(time.Now().Add(timeout))
+		}
+
+		if err = wire.Write(conn, reqType, req); err == nil {
+			err = wire.ReadMsg(conn, respType, resp)
+		}
+		if err != nil {
+			conn.Close()
+			continue
+		}
+
+		c.put(conn)
+		return nil
+	}
+
+	return fmt.Errorf("%s: %w", host, err)
+}
+
+// get returns an idle connection or dials a new one.
+func (c *client) get(host string, timeout time.Duration) (net.Conn, error) {
+	c.mu.Lock()
+	if n := len(c.idle); n > 0 {
+		conn := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.mu.Unlock()
+		return conn, nil
+	}
+	c.mu.Unlock()
+
+	return net.DialTimeout("tcp", host, timeout)
+}
+
+// put returns a connection to the pool.
+func (c *client) put(conn net.Conn) {
+	conn.SetDeadline(time.Time{})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.idle) == maxIdle {
+		conn.Close()
+		return
+	}
+	c.idle = append(c.idle, conn)
+}
+
+// close closes the idle connections.
+func (c *client) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, conn := range c.idle {
+		conn.Close()
+	}
+	c.idle = nil
+
+	return nil
+}
+
+// =============================================================================
+
+// puller pulls records from a system a batch at a time and hands them out
+// one at a time.
+type puller struct {
+	client
+
+	mu      sync.Mutex
+	cursor  string
+	buf     []wire.Record
+	cursors []string
+	eof     bool
+	err     string
+}
+
+// pull fills d with the next record from host.
+func (p *puller) pull(host string, timeout time.Duration, d *Data) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for len(p.buf) == 0 {
+		switch {
+		case p.err != "":
+			return errors.New(p.err)
+		case p.eof:
+			return io.EOF
+		}
+
+		var b wire.Batch
+		if err := p.do(host, timeout, wire.TypePull, wire.Pull{Cursor: p.cursor, Max: pullRecord}, wire.TypeBatch, &b); err != nil {
+			return err
+		}
+		if len(b.Cursors) != len(b.Records) {
+			return fmt.Errorf("%s: batch has %d records and %d cursors", host, len(b.Records), len(b.Cursors))
+		}
+
+		p.buf, p.cursors = b.Records, b.Cursors
+		p.eof, p.err = b.EOF, b.Error
+		if len(p.buf) == 0 {
+			p.cursor = b.Cursor
+		}
+	}
+
+	if err := FromWire(p.buf[0], d); err != nil {
+		return fmt.Errorf("%s: %w", host, err)
+	}
+	p.cursor = p.cursors[0]
+	p.buf, p.cursors = p.buf[1:], p.cursors[1:]
+
+	return nil
+}
+
+// Cursor returns the position after the last record handed out.
+func (p *puller) Cursor() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.cursor
+}
+
+// Seek moves to a position returned by Cursor.
+func (p *puller) Seek(cursor string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.cursor = cursor
+	p.buf, p.cursors = nil, nil
+	p.eof, p.err = false, ""
+
+	return nil
+}
+
+// Close closes the idle connections.
+func (p *puller) Close() error {
+	return p.close()
+}
+
+// storer stores records in a system. Outside a transaction every record
+// is sent on its own. In a transaction the records are sent as one batch
+// on Commit, which the system stores all or nothing. The batch goes out
+// under the id given to Begin, so a batch stored again after a crash isn't
+// stored twice.
+type storer struct {
+	client
+
+	once    sync.Once
+	session string
+	seq     uint64
+
+	mu    sync.Mutex
+	tx    []wire.Record
+	batch string
+	in    bool
+}
+
+// send stores records on host as one batch with the specified id. Records
+// stored outside a transaction get an id of their own.
+func (s *storer) send(host string, timeout time.Duration, id string, records []wire.Record) error {
+	if id == "" {
+		s.once.Do(func() {
+			b := make([]byte, 8)
+			rand.Read(b)
+			s.session = hex.EncodeToString(b)
+		})
+
+		s.mu.Lock()
+		s.seq++
+		id = fmt.Sprintf("%s-%d", s.session, s.seq)
+		s.mu.Unlock()
+	}
+
+	var ack wire.Ack
+	if err := s.do(host, timeout, wire.TypeStore, wire.Store{Batch: id, Records: records}, wire.TypeAck, &ack); err != nil {
+		return err
+	}
+	if ack.Error != "" {
+		return errors.New(ack.Error)
+	}
+
+	return nil
+}
+
+// store stores d on host, or adds it to the transaction.
+func (s *storer) store(host string, timeout time.Duration, d *Data) error {
+	s.mu.Lock()
+	if s.in {
+		s.tx = append(s.tx, ToWire(d))
+		s.mu.Unlock()
+		return nil
+	}
+	s.mu.Unlock()
+
+	return s.send(host, timeout, "", []wire.Record{ToWire(d)})
+}
+
+// Begin starts a transaction.
+func (s *storer) Begin(batch string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.in {
+		return errors.New("transaction already in progress")
+	}
+	s.in = true
+	s.tx = s.tx[:0]
+	s.batch = batch
+
+	return nil
+}
+
+// commit sends the records of the transaction to host.
+func (s *storer) commit(host string, timeout time.Duration) error {
+	s.mu.Lock()
+	if !s.in {
+		s.mu.Unlock()
+		return errors.New("no transaction in progress")
+	}
+	records, batch := s.tx, s.batch
+	s.in = false
+	s.mu.Unlock()
+
+	return s.send(host, timeout, batch, records)
+}
+
+// Rollback drops the records of the transaction.
+func (s *storer) Rollback() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.in = false
+	s.tx = s.tx[:0]
+
+	return nil
+}
+
+// Close closes the idle connections.
+func (s *storer) Close() error {
+	return s.close()
+}
+
+// =============================================================================
+
+// ToWire converts a record to the form it travels in.
+func ToWire(d *Data) wire.Record {
+	r := wire.Record{Line: d.Line}
+
+	if len(d.Fields) > 0 {
+		r.Fields = make(map[string]wire.Value, len(d.Fields))
+		for k, v := range d.Fields {
+			r.Fields[k] = wire.Value{Kind: v.Kind().String(), Value: v.String()}
+		}
+	}
+
+	return r
+}
+
+// FromWire converts a record that traveled back to a record.
+func FromWire(r wire.Record, d *Data) error {
+	d.Line = r.Line
+	d.Fields = nil
+
+	if r.Fields == nil {
+		return nil
+	}
+
+	d.Fields = make(map[string]Value, len(r.Fields))
+	for k, wv := range r.Fields {
+		kind, err := ParseKind(wv.Kind)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", k, err)
+		}
+		v, err := ParseValue(kind, wv.Value)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", k, err)
+		}
+		d.Fields[k] = v
+	}
+
+	return nil
+}
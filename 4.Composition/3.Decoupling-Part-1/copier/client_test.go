@@ -0,0 +1,313 @@
+package copier_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier"
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier/copiertest"
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier/standin"
+)
+
+var (
+	_ copier.CursorPuller = &copier.Xenia{}
+	_ copier.TxStorer     = &copier.Pillar{}
+)
+
+// listen starts a stand-in server on loopback and returns its address.
+func listen(t *testing.T, s interface {
+	Listen(addr string) (string, error)
+	Close() error
+}) string {
+	addr, err := s.Listen("localhost:0")
+	if err != nil {
+		t.Fatalf("Should be able to listen : %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	return addr
+}
+
+// inOrder reports whether recs are records 0 to n-1 of the system in order.
+func inOrder(recs []copier.Data, system string, n int) bool {
+	if len(recs) != n {
+		return false
+	}
+	for i, d := range recs {
+		if d.Line != fmt.Sprintf("%s %d", system, i) || !d.Fields["id"].Equal(copier.Int(int64(i))) {
+			return false
+		}
+	}
+	return true
+}
+
+// TestClients validates Copy between Xenia and Pillar over TCP, with the
+// servers answering slowly and dropping connections.
+func TestClients(t *testing.T) {
+	t.Log("Given the need to copy between systems over the network.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the servers are slow and drop connections.", testID)
+		{
+			src := standin.NewSource("Xenia", standin.Records("Xenia", 250))
+			src.SetLatency(time.Millisecond)
+			src.SetDropEvery(2)
+			dst := standin.NewSink("Pillar")
+			dst.SetLatency(time.Millisecond)
+			dst.SetDropEvery(3)
+
+			x := copier.Xenia{Host: listen(t, src), Timeout: time.Second}
+			p := copier.Pillar{Host: listen(t, dst), Timeout: time.Second}
+			defer x.Close()
+			defer p.Close()
+
+			if err := copier.Copy(&x, &p, 20); err != io.EOF {
+				t.Fatalf("\t%s\tTest %d:\tShould copy to io.EOF : %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould copy to io.EOF.", succeed, testID)
+
+			if inOrder(dst.Records(), "Xenia", 250) {
+				t.Logf("\t%s\tTest %d:\tShould store every record once and in order.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould store every record once and in order : %d records", failed, testID, len(dst.Records()))
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen Xenia fails to read.", testID)
+		{
+			src := standin.NewSource("Xenia", standin.Records("Xenia", 250))
+			src.FailAt(120)
+			dst := standin.NewSink("Pillar")
+
+			x := copier.Xenia{Host: listen(t, src)}
+			p := copier.Pillar{Host: listen(t, dst)}
+
+			err := copier.Copy(&x, &p, 50)
+			if err != nil && err.Error() == "error reading data from Xenia" && inOrder(dst.Records(), "Xenia", 120) {
+				t.Logf("\t%s\tTest %d:\tShould store what was read and return the error.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould store what was read and return the error : %v %d", failed, testID, err, len(dst.Records()))
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen Pillar rejects a record.", testID)
+		{
+			src := standin.NewSource("Xenia", standin.Records("Xenia", 100))
+			dst := standin.NewSink("Pillar")
+			dst.Reject(func(d *copier.Data) error {
+				if d.Line == "Xenia 45" {
+					return errors.New("bad record")
+				}
+				return nil
+			})
+
+			x := copier.Xenia{Host: listen(t, src)}
+			p := copier.Pillar{Host: listen(t, dst)}
+
+			err := copier.Copy(&x, &p, 20)
+			if err != nil && strings.Contains(err.Error(), "bad record") && inOrder(dst.Records(), "Xenia", 40) {
+				t.Logf("\t%s\tTest %d:\tShould store none of the batch : %v", succeed, testID, err)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould store none of the batch : %v %d", failed, testID, err, len(dst.Records()))
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen Xenia is slower than the timeout.", testID)
+		{
+			src := standin.NewSource("Xenia", standin.Records("Xenia", 10))
+			src.SetLatency(200 * time.Millisecond)
+
+			x := copier.Xenia{Host: listen(t, src), Timeout: 20 * time.Millisecond}
+
+			var d copier.Data
+			var ne interface{ Timeout() bool }
+			if err := x.Pull(&d); errors.As(err, &ne) && ne.Timeout() {
+				t.Logf("\t%s\tTest %d:\tShould time out : %v", succeed, testID, err)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould time out : %v", failed, testID, err)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen resuming from a checkpoint.", testID)
+		{
+			src := standin.NewSource("Xenia", standin.Records("Xenia", 100))
+			src.FailAt(55)
+			dst := standin.NewSink("Pillar")
+
+			x := copier.Xenia{Host: listen(t, src)}
+			p := copier.Pillar{Host: listen(t, dst)}
+			cp, _ := copier.NewCheckpoint(filepath.Join(t.TempDir(), "copy.checkpoint"))
+
+			if err := copier.CopyWithCheckpoint(&x, &p, 10, cp); err == io.EOF {
+				t.Fatalf("\t%s\tTest %d:\tShould fail the first copy.", failed, testID)
+			}
+
+			src.FailAt(0)
+			x = copier.Xenia{Host: x.Host}
+			if err := copier.CopyWithCheckpoint(&x, &p, 10, cp); err != io.EOF {
+				t.Fatalf("\t%s\tTest %d:\tShould finish the second copy : %v", failed, testID, err)
+			}
+
+			if inOrder(dst.Records(), "Xenia", 100) {
+				t.Logf("\t%s\tTest %d:\tShould store every record once.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould store every record once : %d records", failed, testID, len(dst.Records()))
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen a batch is stored again.", testID)
+		{
+			dst := standin.NewSink("Pillar")
+			p := copier.Pillar{Host: listen(t, dst)}
+			recs := standin.Records("Xenia", 5)
+
+			for i := 0; i < 2; i++ {
+				p.Begin("batch-1")
+				for j := range recs {
+					p.Store(&recs[j])
+				}
+				if err := p.Commit(); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould commit the batch : %v", failed, testID, err)
+				}
+			}
+
+			if inOrder(dst.Records(), "Xenia", 5) {
+				t.Logf("\t%s\tTest %d:\tShould store it once.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould store it once : %d records", failed, testID, len(dst.Records()))
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen two sources are copied into the same system.", testID)
+		{
+			xenia := standin.NewSource("Xenia", standin.Records("Xenia", 10))
+			bob := standin.NewSource("Bob", standin.Records("Bob", 10))
+			dst := standin.NewSink("Pillar")
+
+			x := copier.Xenia{Host: listen(t, xenia)}
+			b := copier.Bob{Host: listen(t, bob)}
+			p := copier.Pillar{Host: listen(t, dst)}
+
+			if err := copier.Copy(&x, &p, 5); err != io.EOF {
+				t.Fatalf("\t%s\tTest %d:\tShould copy Xenia : %v", failed, testID, err)
+			}
+			if err := copier.Copy(&b, &p, 5); err != io.EOF {
+				t.Fatalf("\t%s\tTest %d:\tShould copy Bob : %v", failed, testID, err)
+			}
+
+			recs := dst.Records()
+			if len(recs) == 20 && inOrder(recs[:10], "Xenia", 10) && inOrder(recs[10:], "Bob", 10) {
+				t.Logf("\t%s\tTest %d:\tShould store the records of both.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould store the records of both : %d records", failed, testID, len(recs))
+			}
+
+			cpx, _ := copier.NewCheckpoint(filepath.Join(t.TempDir(), "xenia.checkpoint"))
+			cpb, _ := copier.NewCheckpoint(filepath.Join(t.TempDir(), "bob.checkpoint"))
+			dst = standin.NewSink("Pillar")
+			p = copier.Pillar{Host: listen(t, dst)}
+			x = copier.Xenia{Host: x.Host}
+			b = copier.Bob{Host: b.Host}
+
+			if err := copier.CopyWithCheckpoint(&x, &p, 5, cpx); err != io.EOF {
+				t.Fatalf("\t%s\tTest %d:\tShould copy Xenia with a checkpoint : %v", failed, testID, err)
+			}
+			if err := copier.CopyWithCheckpoint(&b, &p, 5, cpb); err != io.EOF {
+				t.Fatalf("\t%s\tTest %d:\tShould copy Bob with a checkpoint : %v", failed, testID, err)
+			}
+
+			if n := len(dst.Records()); n == 20 {
+				t.Logf("\t%s\tTest %d:\tShould store the records of both with checkpoints.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould store the records of both with checkpoints : %d records", failed, testID, n)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen Xenia is asked for records past where it fails.", testID)
+		{
+			src := standin.NewSource("Xenia", standin.Records("Xenia", 10))
+			src.FailAt(5)
+
+			x := copier.Xenia{Host: listen(t, src), Timeout: time.Second}
+			x.Seek("8")
+
+			var d copier.Data
+			err := x.Pull(&d)
+			if err != nil && err.Error() == "error reading data from Xenia" {
+				t.Logf("\t%s\tTest %d:\tShould return the read error : %v", succeed, testID, err)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould return the read error : %v", failed, testID, err)
+			}
+
+			src.FailAt(0)
+			x = copier.Xenia{Host: x.Host, Timeout: time.Second}
+			x.Seek("8")
+			if err := x.Pull(&d); err == nil && d.Line == "Xenia 8" {
+				t.Logf("\t%s\tTest %d:\tShould keep serving.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould keep serving : %v %q", failed, testID, err, d.Line)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen nothing is listening.", testID)
+		{
+			src := standin.NewSource("Xenia", nil)
+			addr := listen(t, src)
+			src.Close()
+
+			x := copier.Xenia{Host: addr, Timeout: 100 * time.Millisecond}
+
+			var d copier.Data
+			if err := x.Pull(&d); err != nil && strings.HasPrefix(err.Error(), addr) {
+				t.Logf("\t%s\tTest %d:\tShould return an error naming the host : %v", succeed, testID, err)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould return an error naming the host : %v", failed, testID, err)
+			}
+		}
+	}
+}
+
+// TestXeniaContract runs the Puller battery against Xenia.
+func TestXeniaContract(t *testing.T) {
+	copiertest.TestPuller(t, func(t *testing.T, records []copier.Data) copiertest.Source {
+		src := standin.NewSource("Xenia", records)
+		x := copier.Xenia{Host: listen(t, src), Timeout: time.Second}
+		t.Cleanup(func() { x.Close() })
+
+		return copiertest.Source{Puller: &x, Fail: src.FailAt}
+	})
+}
+
+// TestPillarContract runs the Storer battery against Pillar.
+func TestPillarContract(t *testing.T) {
+	copiertest.TestStorer(t, func(t *testing.T) copiertest.Target {
+		dst := standin.NewSink("Pillar")
+		p := copier.Pillar{Host: listen(t, dst), Timeout: time.Second}
+		t.Cleanup(func() { p.Close() })
+
+		return copiertest.Target{
+			Storer: &p,
+			Stored: dst.Records,
+			Fail: func(on bool) {
+				if !on {
+					dst.Reject(nil)
+					return
+				}
+				dst.Reject(func(d *copier.Data) error { return errors.New("Pillar is down") })
+			},
+		}
+	})
+}
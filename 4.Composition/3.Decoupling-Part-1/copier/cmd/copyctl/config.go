@@ -0,0 +1,395 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier"
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier/file"
+)
+
+// config describes a copy. A sample:
+//
+//	{
+//	  "source": {"system": "xenia", "host": "localhost:8000", "timeout": "5s"},
+//	  "dest": {"dir": "out"},
+//	  "batch": 100,
+//	  "transforms": [
+//	    {"filter": "id >= 100"},
+//	    {"rename": {"from": "system", "to": "origin"}}
+//	  ],
+//	  "checkpoint": "copy.checkpoint",
+//	  "expect": 1000,
+//	  "key": ["id"]
+//	}
+//
+// Concurrency only goes above 1 for a file destination, whose batches are
+// then stored out of order, a whole record at a time. The systems and a
+// dir store every batch as a transaction, one at a time.
+type config struct {
+	Source      endpoint    `json:"source"`
+	Dest        endpoint    `json:"dest"`
+	Batch       int         `json:"batch"`       // Records per batch. Zero means 100.
+	Concurrency int         `json:"concurrency"` // Batches stored in parallel into a file. Ignored with a checkpoint.
+	Transforms  []transform `json:"transforms"`  // Run in order on every record pulled.
+	Checkpoint  string      `json:"checkpoint"`  // File the progress is kept in so a copy can resume.
+	Expect      int         `json:"expect"`      // Records to store, which dry-run reports, for the ETA. Zero shows none.
+	Key         []string    `json:"key"`         // Fields verify matches records on.
+}
+
+// endpoint is a system or a file to copy from or to. Exactly one of
+// System, File and Dir is set.
+type endpoint struct {
+	System  string   `json:"system"` // xenia or bob as a source, pillar or alice as a destination.
+	Host    string   `json:"host"`
+	Timeout duration `json:"timeout"`
+	File    string   `json:"file"`
+	Format  string   `json:"format"` // jsonl or csv. Empty means jsonl.
+	Dir     string   `json:"dir"`    // A directory storing every batch in its own file. Destination only.
+}
+
+// transform is one stage of the transform chain. Exactly one of its fields
+// is set.
+type transform struct {
+	Filter string `json:"filter"`
+	Rename *struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	} `json:"rename"`
+	Drop    []string `json:"drop"`
+	Default *struct {
+		Field string `json:"field"`
+		Kind  string `json:"kind"`
+		Value string `json:"value"`
+	} `json:"default"`
+	Dedup []string `json:"dedup"`
+}
+
+// duration is a time.Duration written as a string like "5s".
+type duration time.Duration
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+
+	return nil
+}
+
+// =============================================================================
+
+// load reads and checks the config at path.
+func load(path string) (config, error) {
+	var cfg config
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if cfg.Batch <= 0 {
+		cfg.Batch = 100
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+
+	if err := cfg.Source.check("source", "xenia", "bob"); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	if cfg.Source.Dir != "" {
+		return cfg, fmt.Errorf("%s: source: dir is only a destination", path)
+	}
+	if err := cfg.Dest.check("dest", "pillar", "alice"); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	if cfg.Concurrency > 1 && cfg.Dest.File == "" {
+		return cfg, fmt.Errorf("%s: concurrency: dest stores one batch at a time", path)
+	}
+	if _, err := cfg.chain(); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+// check validates an endpoint is one of the systems named or a file.
+func (e endpoint) check(name string, systems ...string) error {
+	set := 0
+	for _, s := range []string{e.System, e.File, e.Dir} {
+		if s != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("%s: set exactly one of system, file and dir", name)
+	}
+
+	if e.System != "" {
+		known := false
+		for _, s := range systems {
+			known = known || strings.EqualFold(e.System, s)
+		}
+		if !known {
+			return fmt.Errorf("%s: unknown system %q, want one of %s", name, e.System, strings.Join(systems, ", "))
+		}
+		if e.Host == "" {
+			return fmt.Errorf("%s: system %s needs a host", name, e.System)
+		}
+	}
+
+	switch e.Format {
+	case "", "jsonl", "csv":
+	default:
+		return fmt.Errorf("%s: unknown format %q", name, e.Format)
+	}
+
+	return nil
+}
+
+// chain builds the transform chain. It is nil without transforms.
+func (cfg config) chain() (*copier.Chain, error) {
+	if len(cfg.Transforms) == 0 {
+		return nil, nil
+	}
+
+	stages := make([]copier.Stage, len(cfg.Transforms))
+	for i, t := range cfg.Transforms {
+		var (
+			s   copier.Stage
+			err error
+			set int
+		)
+
+		if t.Filter != "" {
+			set++
+			s.Name = "filter " + t.Filter
+			s.Transformer, err = copier.Filter(t.Filter)
+		}
+		if t.Rename != nil {
+			set++
+			s.Name = "rename " + t.Rename.From + " to " + t.Rename.To
+			s.Transformer = copier.Rename(t.Rename.From, t.Rename.To)
+		}
+		if t.Drop != nil {
+			set++
+			s.Name = "drop " + strings.Join(t.Drop, ", ")
+			s.Transformer = copier.Drop(t.Drop...)
+		}
+		if t.Default != nil {
+			set++
+			s.Name = "default " + t.Default.Field
+
+			var kind copier.Kind
+			if kind, err = copier.ParseKind(t.Default.Kind); err == nil {
+				var v copier.Value
+				if v, err = copier.ParseValue(kind, t.Default.Value); err == nil {
+					s.Transformer = copier.Default(t.Default.Field, v)
+				}
+			}
+		}
+		if t.Dedup != nil {
+			set++
+			s.Name = "dedup " + strings.Join(t.Dedup, ", ")
+			s.Transformer = copier.Dedup(t.Dedup...)
+		}
+
+		switch {
+		case set != 1:
+			return nil, fmt.Errorf("transform %d: set exactly one of filter, rename, drop, default and dedup", i)
+		case err != nil:
+			return nil, fmt.Errorf("transform %d: %w", i, err)
+		}
+
+		stages[i] = s
+	}
+
+	return copier.NewChain(stages...), nil
+}
+
+// =============================================================================
+
+// openSource opens the source for pulling. A source that knows its
+// position is returned as a copier.CursorPuller.
+func openSource(e endpoint) (copier.Puller, func() error, error) {
+	switch strings.ToLower(e.System) {
+	case "xenia":
+		x := copier.Xenia{Host: e.Host, Timeout: time.Duration(e.Timeout)}
+		return &x, x.Close, nil
+	case "bob":
+		b := copier.Bob{Host: e.Host, Timeout: time.Duration(e.Timeout)}
+		return &b, b.Close, nil
+	}
+
+	f, err := os.Open(e.File)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if e.Format == "csv" {
+		return file.NewCSVPuller(f), f.Close, nil
+	}
+	return file.NewJSONLPuller(f), f.Close, nil
+}
+
+// openDest opens the destination for storing. The function returned
+// flushes and closes it. A file is safe for concurrent use.
+func openDest(e endpoint) (copier.Storer, func() error, error) {
+	switch strings.ToLower(e.System) {
+	case "pillar":
+		p := copier.Pillar{Host: e.Host, Timeout: time.Duration(e.Timeout)}
+		return &p, p.Close, nil
+	case "alice":
+		a := copier.Alice{Host: e.Host, Timeout: time.Duration(e.Timeout)}
+		return &a, a.Close, nil
+	}
+
+	if e.Dir != "" {
+		t, err := file.NewTxDir(e.Dir)
+		if err != nil {
+			return nil, nil, err
+		}
+		return t, func() error { return nil }, nil
+	}
+
+	// JSON Lines are appended to, so a resumed copy adds to what is there.
+	// CSV has a header, so it is only ever created.
+	flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if e.Format == "csv" {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	}
+
+	f, err := os.OpenFile(e.File, flags, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var s interface {
+		copier.Storer
+		Flush() error
+	}
+	switch e.Format {
+	case "csv":
+		s = file.NewCSVStorer(f)
+	default:
+		s = file.NewJSONLStorer(f)
+	}
+
+	finish := func() error {
+		err := s.Flush()
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}
+	return &locked{s: s}, finish, nil
+}
+
+// locked makes a Storer safe for concurrent use.
+type locked struct {
+	mu sync.Mutex
+	s  copier.Storer
+}
+
+// Store implements the copier.Storer interface.
+func (l *locked) Store(d *copier.Data) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.s.Store(d)
+}
+
+// openReadback opens the destination for pulling back what was stored.
+// The systems we store into can't be read from.
+func openReadback(e endpoint) (copier.Puller, func() error, error) {
+	switch {
+	case e.System != "":
+		return nil, nil, fmt.Errorf("%s can't be read back", e.System)
+
+	case e.Dir != "":
+		t, err := file.NewTxDir(e.Dir)
+		if err != nil {
+			return nil, nil, err
+		}
+		names, err := t.Files()
+		if err != nil {
+			return nil, nil, err
+		}
+		c := concat{names: names}
+		return &c, c.close, nil
+	}
+
+	f, err := os.Open(e.File)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if e.Format == "csv" {
+		return file.NewCSVPuller(f), f.Close, nil
+	}
+	return file.NewJSONLPuller(f), f.Close, nil
+}
+
+// concat pulls the JSON Lines files named one after the other.
+type concat struct {
+	names []string
+	f     *os.File
+	p     copier.Puller
+}
+
+// Pull implements the copier.Puller interface.
+func (c *concat) Pull(d *copier.Data) error {
+	for {
+		if c.p == nil {
+			if len(c.names) == 0 {
+				return io.EOF
+			}
+
+			f, err := os.Open(c.names[0])
+			if err != nil {
+				return err
+			}
+			c.names = c.names[1:]
+			c.f, c.p = f, file.NewJSONLPuller(f)
+		}
+
+		err := c.p.Pull(d)
+		if !errors.Is(err, io.EOF) {
+			return err
+		}
+
+		c.close()
+	}
+}
+
+// close closes the file being read.
+func (c *concat) close() error {
+	if c.f == nil {
+		return nil
+	}
+
+	err := c.f.Close()
+	c.f, c.p = nil, nil
+	return err
+}
@@ -0,0 +1,402 @@
+// This program runs copies described by a JSON config file, so changing a
+// host or the batch size doesn't mean editing code. See config for the
+// fields of the file.
+//
+//	go run ./cmd/copyctl -config copy.json run
+//
+// The subcommands are:
+//
+//	run      copy the source into the destination, resuming from the checkpoint
+//	dry-run  pull the source through the transforms without storing anything
+//	verify   compare the source with what the destination holds
+//	status   show the progress recorded in the checkpoint
+//
+// The exit code is 0 once the source reached io.EOF and everything was
+// stored, 1 when the copy failed, 2 for a bad command line or config, 3
+// when the copy was interrupted and 4 when verify found differences.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier"
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier/verify"
+)
+
+// The exit codes.
+const (
+	exitDone        = 0
+	exitFailed      = 1
+	exitUsage       = 2
+	exitInterrupted = 3
+	exitDiffers     = 4
+)
+
+// errDiffers is returned by verify when the sides don't match.
+var errDiffers = errors.New("destination differs from source")
+
+func main() {
+	path := flag.String("config", "copy.json", "config file describing the copy")
+	every := flag.Duration("progress", time.Second, "how often run reports progress, 0 for never")
+	report := flag.String("report", "", "file verify writes the diff report to")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: copyctl [flags] run|dry-run|verify|status")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(exitUsage)
+	}
+
+	cfg, err := load(*path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "copyctl:", err)
+		os.Exit(exitUsage)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	switch flag.Arg(0) {
+	case "run":
+		err = run(ctx, cfg, *every)
+	case "dry-run":
+		err = dryRun(ctx, cfg)
+	case "verify":
+		err = check(cfg, *report)
+	case "status":
+		err = status(cfg)
+	default:
+		flag.Usage()
+		os.Exit(exitUsage)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "copyctl:", err)
+	}
+	os.Exit(exitCode(err))
+}
+
+// exitCode returns the exit code for the error a subcommand returned. The
+// end of the source is success.
+func exitCode(err error) int {
+	switch {
+	case err == nil, errors.Is(err, io.EOF):
+		return exitDone
+	case errors.Is(err, context.Canceled):
+		return exitInterrupted
+	case errors.Is(err, errDiffers):
+		return exitDiffers
+	default:
+		return exitFailed
+	}
+}
+
+// =============================================================================
+
+// run copies the source into the destination.
+func run(ctx context.Context, cfg config, every time.Duration) error {
+	var cp *copier.Checkpoint
+	if cfg.Checkpoint != "" {
+		var err error
+		if cp, err = copier.NewCheckpoint(cfg.Checkpoint); err != nil {
+			return err
+		}
+	}
+
+	p, c, closeSrc, err := source(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer closeSrc()
+
+	s, finish, err := openDest(cfg.Dest)
+	if err != nil {
+		return err
+	}
+
+	var done int
+	if cp != nil {
+		done = cp.State().Records
+	}
+	stopProgress := c.watch(every, done, cfg.Expect)
+
+	if cp != nil {
+		cpp, ok := p.(copier.CursorPuller)
+		if !ok {
+			err = errors.New("a checkpoint needs a source that knows its position, which csv files don't")
+		} else {
+			err = copier.CopyWithCheckpoint(cpp, s, cfg.Batch, cp)
+		}
+	} else {
+		err = copier.CopyConcurrent(ctx, p, s, copier.Options{Batch: cfg.Batch, Stores: cfg.Concurrency})
+	}
+
+	if ferr := finish(); ferr != nil && (err == nil || err == io.EOF) {
+		err = ferr
+	}
+	stopProgress()
+	printStages(p)
+
+	if err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// dryRun pulls the source through the transforms and reports what would
+// be stored, leaving the destination and the checkpoint alone.
+func dryRun(ctx context.Context, cfg config) error {
+	p, c, closeSrc, err := source(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer closeSrc()
+
+	s := storeFunc(func(d *copier.Data) error {
+		return nil
+	})
+
+	err = copier.Copy(p, s, cfg.Batch)
+	if err != io.EOF {
+		return err
+	}
+
+	fmt.Printf("would store %d records\n", atomic.LoadInt64(&c.n))
+	printStages(p)
+
+	return nil
+}
+
+// check compares the source, after the transforms, with what the
+// destination holds.
+func check(cfg config, report string) error {
+	p, _, closeSrc, err := source(context.Background(), cfg)
+	if err != nil {
+		return err
+	}
+	defer closeSrc()
+
+	back, closeDst, err := openReadback(cfg.Dest)
+	if err != nil {
+		return err
+	}
+	defer closeDst()
+
+	opts := verify.Options{Key: cfg.Key}
+	if report != "" {
+		f, err := os.Create(report)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		opts.Report = f
+	}
+
+	res, err := verify.Verify(p, back, opts)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("source:      %d records  ordered %.16s  unordered %s\n", res.Source.Records, res.Source.Ordered, res.Source.Unordered)
+	fmt.Printf("destination: %d records  ordered %.16s  unordered %s\n", res.Dest.Records, res.Dest.Ordered, res.Dest.Unordered)
+	fmt.Printf("missing %d, extra %d, mismatched %d\n", res.Missing, res.Extra, res.Mismatched)
+
+	if !res.OK() {
+		return errDiffers
+	}
+	return nil
+}
+
+// status shows the progress recorded in the checkpoint.
+func status(cfg config) error {
+	if cfg.Checkpoint == "" {
+		return errors.New("the config has no checkpoint")
+	}
+
+	cp, err := copier.NewCheckpoint(cfg.Checkpoint)
+	if err != nil {
+		return err
+	}
+	st := cp.State()
+
+	if st.Updated.IsZero() {
+		fmt.Println("not started")
+		return nil
+	}
+
+	fmt.Printf("records: %d", st.Records)
+	if cfg.Expect > 0 {
+		fmt.Printf(" of %d (%.1f%%)", cfg.Expect, 100*float64(st.Records)/float64(cfg.Expect))
+	}
+	fmt.Println()
+	fmt.Printf("batches: %d\n", st.Batches)
+	fmt.Printf("cursor:  %q\n", st.Cursor)
+	fmt.Printf("updated: %s\n", st.Updated.Format(time.RFC3339))
+	if st.Pending != nil {
+		fmt.Printf("pending: batch from %q to %q was being stored and is stored again on resume\n", st.Pending.From, st.Pending.To)
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+// source opens the source and puts the transforms and the counter in front
+// of it, so the counter sees the records that get stored. A source that
+// knows its position still does.
+func source(ctx context.Context, cfg config) (copier.Puller, *counter, func() error, error) {
+	raw, closeSrc, err := openSource(cfg.Source)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	p := raw
+	chain, _ := cfg.chain()
+	if chain != nil {
+		p = &transformed{Puller: copier.TransformPuller(chain, raw), chain: chain}
+	}
+
+	c := &counter{ctx: ctx, p: p}
+	p = c
+
+	if cp, ok := raw.(copier.CursorPuller); ok {
+		p = &positioned{Puller: p, cp: cp}
+	}
+
+	return p, c, closeSrc, nil
+}
+
+// counter counts the records that get past the transforms and stops pulling
+// once its context is cancelled.
+type counter struct {
+	ctx context.Context
+	p   copier.Puller
+	n   int64
+}
+
+// Pull implements the copier.Puller interface.
+func (c *counter) Pull(d *copier.Data) error {
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+
+	err := c.p.Pull(d)
+	if err == nil {
+		atomic.AddInt64(&c.n, 1)
+	}
+	return err
+}
+
+// watch prints the rate and the time left every so often until the
+// function it returns is called, which prints the totals. done is the
+// number of records copied before, by a run that is being resumed, and
+// expect the number in the source.
+func (c *counter) watch(every time.Duration, done, expect int) func() {
+	start := time.Now()
+
+	line := func() {
+		n := atomic.LoadInt64(&c.n)
+		elapsed := time.Since(start)
+		rate := float64(n) / elapsed.Seconds()
+
+		fmt.Printf("%d records  %.0f rec/s", done+int(n), rate)
+		if left := expect - done - int(n); expect > 0 && rate > 0 && left > 0 {
+			eta := time.Duration(float64(left) / rate * float64(time.Second))
+			fmt.Printf("  ETA %s", eta.Round(time.Second))
+		}
+		fmt.Println()
+	}
+
+	stop := make(chan struct{})
+	finished := make(chan struct{})
+
+	go func() {
+		defer close(finished)
+
+		if every <= 0 {
+			<-stop
+			return
+		}
+
+		t := time.NewTicker(every)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-t.C:
+				line()
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-finished
+
+		fmt.Printf("done in %s: ", time.Since(start).Round(time.Millisecond))
+		line()
+	}
+}
+
+// transformed is the source after the transforms, keeping the chain for
+// its stats.
+type transformed struct {
+	copier.Puller
+	chain *copier.Chain
+}
+
+// positioned gives the transformed source the position of the source
+// under it, so a copy can resume from a checkpoint. The position is after
+// the last record pulled, whether or not the transforms kept it.
+type positioned struct {
+	copier.Puller
+	cp copier.CursorPuller
+}
+
+// Cursor implements the copier.CursorPuller interface.
+func (p *positioned) Cursor() string {
+	return p.cp.Cursor()
+}
+
+// Seek implements the copier.CursorPuller interface.
+func (p *positioned) Seek(cursor string) error {
+	return p.cp.Seek(cursor)
+}
+
+// printStages prints what every transform did.
+func printStages(p copier.Puller) {
+	if pp, ok := p.(*positioned); ok {
+		p = pp.Puller
+	}
+
+	t, ok := p.(*counter).p.(*transformed)
+	if !ok {
+		return
+	}
+
+	for _, st := range t.chain.Stats() {
+		fmt.Printf("  %-30s in %d  out %d  rejected %d  errors %d\n", st.Name, st.In, st.Out, st.Rejected, st.Errors)
+	}
+}
+
+// storeFunc adapts a function to the copier.Storer interface.
+type storeFunc func(d *copier.Data) error
+
+// Store implements the copier.Storer interface.
+func (f storeFunc) Store(d *copier.Data) error {
+	return f(d)
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier"
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier/file"
+)
+
+const succeed = "\u2713"
+const failed = "\u2717"
+
+// write writes content to a file in a temporary directory and returns its
+// path.
+func write(t *testing.T, name string, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Should be able to write %s : %v", name, err)
+	}
+	return path
+}
+
+// TestLoad validates configs are checked before anything is copied.
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{"a valid config", `{"source": {"system": "xenia", "host": "localhost:8000"}, "dest": {"dir": "out"}, "transforms": [{"filter": "id >= 1"}, {"default": {"field": "region", "kind": "string", "value": "US"}}]}`, ""},
+		{"an unknown field", `{"source": {"file": "in.jsonl"}, "dest": {"dir": "out"}, "batches": 5}`, "unknown field"},
+		{"a source with nothing set", `{"source": {}, "dest": {"dir": "out"}}`, "source: set exactly one"},
+		{"a source with two things set", `{"source": {"file": "in.jsonl", "system": "xenia", "host": "h"}, "dest": {"dir": "out"}}`, "source: set exactly one"},
+		{"an unknown system", `{"source": {"system": "pillar", "host": "h"}, "dest": {"dir": "out"}}`, `unknown system "pillar"`},
+		{"a system without a host", `{"source": {"system": "bob"}, "dest": {"dir": "out"}}`, "needs a host"},
+		{"an unknown format", `{"source": {"file": "in.xml", "format": "xml"}, "dest": {"dir": "out"}}`, `unknown format "xml"`},
+		{"a dir as the source", `{"source": {"dir": "in"}, "dest": {"dir": "out"}}`, "dir is only a destination"},
+		{"a transform with two things set", `{"source": {"file": "in.jsonl"}, "dest": {"dir": "out"}, "transforms": [{"filter": "id > 1", "drop": ["x"]}]}`, "transform 0: set exactly one"},
+		{"a bad filter", `{"source": {"file": "in.jsonl"}, "dest": {"dir": "out"}, "transforms": [{"drop": ["x"]}, {"filter": "id >"}]}`, "transform 1:"},
+		{"concurrency into a file", `{"source": {"file": "in.jsonl"}, "dest": {"file": "out.jsonl"}, "concurrency": 4}`, ""},
+		{"concurrency into a dir", `{"source": {"file": "in.jsonl"}, "dest": {"dir": "out"}, "concurrency": 4}`, "one batch at a time"},
+		{"concurrency into a system", `{"source": {"file": "in.jsonl"}, "dest": {"system": "pillar", "host": "h"}, "concurrency": 2}`, "one batch at a time"},
+		{"a bad default kind", `{"source": {"file": "in.jsonl"}, "dest": {"dir": "out"}, "transforms": [{"default": {"field": "x", "kind": "color", "value": "red"}}]}`, "transform 0:"},
+	}
+
+	t.Log("Given the need to check the config of a copy.")
+	{
+		for testID, tt := range tests {
+			t.Logf("\tTest %d:\tWhen loading %s.", testID, tt.name)
+			{
+				path := write(t, "copy.json", tt.config)
+				cfg, err := load(path)
+
+				switch {
+				case tt.err == "" && err == nil:
+					if cfg.Batch == 100 && cfg.Concurrency >= 1 {
+						t.Logf("\t%s\tTest %d:\tShould load it with the defaults.", succeed, testID)
+					} else {
+						t.Errorf("\t%s\tTest %d:\tShould load it with the defaults : %+v", failed, testID, cfg)
+					}
+				case tt.err != "" && err != nil && strings.Contains(err.Error(), tt.err) && strings.HasPrefix(err.Error(), path):
+					t.Logf("\t%s\tTest %d:\tShould refuse it naming the file : %v", succeed, testID, err)
+				default:
+					t.Errorf("\t%s\tTest %d:\tShould get %q : %v", failed, testID, tt.err, err)
+				}
+			}
+		}
+	}
+}
+
+// TestExitCode validates the exit code of every outcome.
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		code int
+	}{
+		{"success", nil, exitDone},
+		{"the end of the source", io.EOF, exitDone},
+		{"a failure", errors.New("error writing data to Pillar"), exitFailed},
+		{"an interruption", fmt.Errorf("pull: %w", context.Canceled), exitInterrupted},
+		{"differences", fmt.Errorf("verify: %w", errDiffers), exitDiffers},
+	}
+
+	t.Log("Given the need to tell scripts how a subcommand went.")
+	{
+		for testID, tt := range tests {
+			t.Logf("\tTest %d:\tWhen the subcommand ends with %s.", testID, tt.name)
+			{
+				if got := exitCode(tt.err); got == tt.code {
+					t.Logf("\t%s\tTest %d:\tShould exit with %d.", succeed, testID, tt.code)
+				} else {
+					t.Errorf("\t%s\tTest %d:\tShould exit with %d : got %d", failed, testID, tt.code, got)
+				}
+			}
+		}
+	}
+}
+
+// TestSource validates the transformed source counts what gets through and
+// still knows its position, which resuming from a checkpoint depends on.
+func TestSource(t *testing.T) {
+	in := write(t, "in.jsonl", "{\"id\": 1}\n{\"id\": 2}\n{\"id\": 3}\n{\"id\": 4}\n")
+	cfg := config{
+		Source:     endpoint{File: in},
+		Transforms: []transform{{Filter: "id >= 2"}},
+	}
+
+	t.Log("Given the need to pull a source through the transforms.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen pulling the source to the end.", testID)
+		{
+			p, c, closeSrc, err := source(context.Background(), cfg)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould open the source : %v", failed, testID, err)
+			}
+			defer closeSrc()
+
+			cp, ok := p.(copier.CursorPuller)
+			if !ok {
+				t.Fatalf("\t%s\tTest %d:\tShould know its position.", failed, testID)
+			}
+
+			var d copier.Data
+			if err := cp.Pull(&d); err != nil || d.Fields["id"].Int() != 2 || cp.Cursor() != "20" {
+				t.Fatalf("\t%s\tTest %d:\tShould be after the first record kept : %v %v %s", failed, testID, err, d.Fields, cp.Cursor())
+			}
+			t.Logf("\t%s\tTest %d:\tShould be after the first record kept.", succeed, testID)
+
+			for err == nil {
+				err = cp.Pull(&d)
+			}
+			if err == io.EOF && c.n == 3 {
+				t.Logf("\t%s\tTest %d:\tShould count the records that get through.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould count the records that get through : %v %d", failed, testID, err, c.n)
+			}
+
+			if err := cp.Seek("20"); err == nil && cp.Pull(&d) == nil && d.Fields["id"].Int() == 3 {
+				t.Logf("\t%s\tTest %d:\tShould resume from a position.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould resume from a position : %v %v", failed, testID, err, d.Fields)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen the copy is interrupted.", testID)
+		{
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			p, c, closeSrc, err := source(ctx, cfg)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould open the source : %v", failed, testID, err)
+			}
+			defer closeSrc()
+
+			var d copier.Data
+			if err := p.Pull(&d); errors.Is(err, context.Canceled) && c.n == 0 {
+				t.Logf("\t%s\tTest %d:\tShould stop pulling.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould stop pulling : %v", failed, testID, err)
+			}
+		}
+	}
+}
+
+// TestRunConcurrent validates a copy storing batches in parallel into a
+// file keeps every record whole.
+func TestRunConcurrent(t *testing.T) {
+	var in strings.Builder
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&in, "{\"id\": %d, \"name\": \"customer %d\"}\n", i, i)
+	}
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out.jsonl")
+
+	cfg := config{
+		Source:      endpoint{File: write(t, "in.jsonl", in.String())},
+		Dest:        endpoint{File: out},
+		Batch:       10,
+		Concurrency: 4,
+	}
+
+	t.Log("Given the need to store batches into a file in parallel.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen copying with four store goroutines.", testID)
+		{
+			if err := run(context.Background(), cfg, 0); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould copy : %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould copy.", succeed, testID)
+
+			f, err := os.Open(out)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould open the file : %v", failed, testID, err)
+			}
+			defer f.Close()
+
+			seen := make(map[int64]bool)
+			p := file.NewJSONLPuller(f)
+			var d copier.Data
+			for err = p.Pull(&d); err == nil; err = p.Pull(&d) {
+				id := d.Fields["id"].Int()
+				if seen[id] || d.Fields["name"].String() != fmt.Sprintf("customer %d", id) {
+					break
+				}
+				seen[id] = true
+			}
+
+			if err == io.EOF && len(seen) == 1000 {
+				t.Logf("\t%s\tTest %d:\tShould store every record once and whole.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould store every record once and whole : %v %d records", failed, testID, err, len(seen))
+			}
+		}
+	}
+}
@@ -0,0 +1,190 @@
+// This program replays a dead letter file. Once the target that rejected
+// the records is fixed, it feeds them back through Copy into that target, a
+// system or a file. Records that fail again go to a new dead letter file so
+// nothing is lost.
+//
+//	go run ./cmd/replay -in dead.jsonl -system pillar -host localhost:9000
+//	go run ./cmd/replay -in dead.jsonl -out orders.jsonl
+//
+// Every record is stored on its own, so each can be retried and written to
+// the dead letters by itself. A system gets the records outside of
+// transactions, which is why a dir, which only stores in transactions,
+// can't be replayed into.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier"
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier/file"
+)
+
+// dest is where the records are replayed into. Exactly one of system and
+// out is set.
+type dest struct {
+	system  string
+	host    string
+	timeout time.Duration
+	out     string
+	format  string
+}
+
+func main() {
+	in := flag.String("in", "dead.jsonl", "dead letter file to replay")
+
+	var d dest
+	flag.StringVar(&d.system, "system", "", "system to store the records in: pillar or alice")
+	flag.StringVar(&d.host, "host", "", "address of the system")
+	flag.DurationVar(&d.timeout, "timeout", 0, "timeout for every request to the system, 0 for the default")
+	flag.StringVar(&d.out, "out", "", "file to store the records in")
+	flag.StringVar(&d.format, "format", "jsonl", "format of the file: jsonl, which appends, or csv, which creates")
+
+	again := flag.String("dead", "", "dead letter file for records that fail again (default <in>.again)")
+	batch := flag.Int("batch", 100, "records per batch")
+	retries := flag.Int("retries", 3, "retries for a record that fails to store")
+	backoff := flag.Duration("backoff", 100*time.Millisecond, "wait before the first retry, doubled for each one after")
+	maxRate := flag.Float64("max-rate", 0, "fraction of records failing again that stops the replay, 0 for never")
+	minSeen := flag.Int("min-seen", 100, "records replayed before -max-rate is checked")
+	flag.Parse()
+
+	if err := d.check(); err != nil {
+		fmt.Fprintln(os.Stderr, "replay:", err)
+		os.Exit(2)
+	}
+	if *again == "" {
+		*again = *in + ".again"
+	}
+
+	policy := copier.ErrorPolicy{
+		Retries: *retries,
+		Backoff: *backoff,
+		MaxRate: *maxRate,
+		MinSeen: *minSeen,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, *in, d, *again, *batch, policy); err != nil {
+		fmt.Fprintln(os.Stderr, "replay:", err)
+		os.Exit(1)
+	}
+}
+
+// check validates the destination is a system or a file.
+func (d dest) check() error {
+	switch {
+	case (d.system == "") == (d.out == ""):
+		return errors.New("set exactly one of -system and -out")
+	case d.system != "" && d.host == "":
+		return fmt.Errorf("system %s needs a -host", d.system)
+	}
+
+	switch strings.ToLower(d.system) {
+	case "", "pillar", "alice":
+	default:
+		return fmt.Errorf("unknown system %q, want pillar or alice", d.system)
+	}
+
+	switch d.format {
+	case "jsonl", "csv":
+	default:
+		return fmt.Errorf("unknown format %q", d.format)
+	}
+
+	return nil
+}
+
+// open opens the destination for storing. The function returned flushes
+// and closes it.
+func (d dest) open() (copier.Storer, func() error, error) {
+	switch strings.ToLower(d.system) {
+	case "pillar":
+		p := copier.Pillar{Host: d.host, Timeout: d.timeout}
+		return &p, p.Close, nil
+	case "alice":
+		a := copier.Alice{Host: d.host, Timeout: d.timeout}
+		return &a, a.Close, nil
+	}
+
+	// JSON Lines are appended to. CSV has a header, so it is only ever
+	// created.
+	flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if d.format == "csv" {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	}
+
+	f, err := os.OpenFile(d.out, flags, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var s interface {
+		copier.Storer
+		Flush() error
+	}
+	switch d.format {
+	case "csv":
+		s = file.NewCSVStorer(f)
+	default:
+		s = file.NewJSONLStorer(f)
+	}
+
+	finish := func() error {
+		err := s.Flush()
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}
+	return s, finish, nil
+}
+
+func run(ctx context.Context, in string, d dest, again string, batch int, policy copier.ErrorPolicy) error {
+	src, err := os.Open(in)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	s, finish, err := d.open()
+	if err != nil {
+		return err
+	}
+
+	dead, err := os.OpenFile(again, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		finish()
+		return err
+	}
+	defer dead.Close()
+
+	policy.Dead = file.NewDeadLetterWriter(dead)
+	ps := copier.NewPolicyStorer(ctx, s, policy)
+
+	err = copier.Copy(file.NewDeadLetterPuller(src), ps, batch)
+	if ferr := finish(); ferr != nil && (err == nil || err == io.EOF) {
+		err = ferr
+	}
+
+	st := ps.Stats()
+	fmt.Printf("replayed %d records, %d failed again", st.Stored, st.Dead)
+	if st.Dead > 0 {
+		fmt.Printf(" and were written to %s", again)
+	}
+	fmt.Println()
+
+	if err != io.EOF {
+		return err
+	}
+	return nil
+}
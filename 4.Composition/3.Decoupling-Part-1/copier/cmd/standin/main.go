@@ -0,0 +1,71 @@
+// This program runs stand-in servers for Xenia, Bob, Pillar and Alice so
+// the copier can be tried out locally. It runs until interrupted and then
+// reports how many records each store received.
+//
+//	go run ./cmd/standin -records 1000 -latency 5ms
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier/standin"
+)
+
+func main() {
+	xenia := flag.String("xenia", "localhost:8000", "address for Xenia")
+	bob := flag.String("bob", "localhost:8001", "address for Bob")
+	pillar := flag.String("pillar", "localhost:9000", "address for Pillar")
+	alice := flag.String("alice", "localhost:9001", "address for Alice")
+	records := flag.Int("records", 1000, "records Xenia and Bob hand out")
+	latency := flag.Duration("latency", 0, "delay before every answer")
+	drop := flag.Int("drop", 0, "drop the connection instead of answering every nth request")
+	flag.Parse()
+
+	sinks := map[string]*standin.Sink{
+		"Pillar": standin.NewSink("Pillar"),
+		"Alice":  standin.NewSink("Alice"),
+	}
+
+	servers := []struct {
+		name string
+		addr string
+		s    interface {
+			Listen(addr string) (string, error)
+			Close() error
+			SetLatency(d time.Duration)
+			SetDropEvery(n int)
+		}
+	}{
+		{"Xenia", *xenia, standin.NewSource("Xenia", standin.Records("Xenia", *records))},
+		{"Bob", *bob, standin.NewSource("Bob", standin.Records("Bob", *records))},
+		{"Pillar", *pillar, sinks["Pillar"]},
+		{"Alice", *alice, sinks["Alice"]},
+	}
+
+	for _, srv := range servers {
+		srv.s.SetLatency(*latency)
+		srv.s.SetDropEvery(*drop)
+
+		addr, err := srv.s.Listen(srv.addr)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		defer srv.s.Close()
+
+		fmt.Printf("%s listening on %s\n", srv.name, addr)
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+
+	for _, name := range []string{"Pillar", "Alice"} {
+		fmt.Printf("%s stored %d records\n", name, len(sinks[name].Records()))
+	}
+}
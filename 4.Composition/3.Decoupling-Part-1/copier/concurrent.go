@@ -0,0 +1,124 @@
+package copier
+
+import (
+	"context"
+	"strconv"
+	"sync"
+)
+
+// Options configures a concurrent copy.
+type Options struct {
+	Batch    int // Number of records pulled per batch.
+	InFlight int // Maximum number of batches pulled but not yet stored.
+	Stores   int // Number of goroutines storing batches in parallel.
+}
+
+// batch is a batch of records on its way to be stored.
+type batch struct {
+	id   string
+	data []Data
+}
+
+// withDefaults fills in the options that were not set.
+func (o Options) withDefaults() Options {
+	if o.Batch <= 0 {
+		o.Batch = 100
+	}
+	if o.Stores <= 0 {
+		o.Stores = 1
+	}
+	if o.InFlight < o.Stores {
+		o.InFlight = o.Stores + 1
+	}
+
+	return o
+}
+
+// CopyConcurrent behaves like Copy except pulling and storing overlap. One
+// goroutine pulls batches while a pool of goroutines stores them, so
+// neither system sits idle waiting on the other. The number of batches in
+// memory is bounded by InFlight.
+//
+// With more than one store goroutine the Storer must be safe for concurrent
+// use and batches are not stored in the order they were pulled. A TxStorer
+// has one transaction at a time, so it always gets a single store
+// goroutine.
+//
+// Errors are handled the way Copy handles them. When the Puller returns an
+// error, the records it pulled before the error are still stored and every
+// batch in flight is allowed to finish before the error is returned, so
+// io.EOF means everything was copied. When a store fails, pulling stops,
+// the batches already handed out finish and the store error is returned.
+func CopyConcurrent(ctx context.Context, p Puller, s Storer, opts Options) error {
+	opts = opts.withDefaults()
+	if _, ok := s.(TxStorer); ok {
+		opts.Stores = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// The free channel is the pool of batches. A batch goes from the
+	// puller to a store goroutine over full and comes back over free.
+	free := make(chan []Data, opts.InFlight)
+	for i := 0; i < opts.InFlight; i++ {
+		free <- make([]Data, opts.Batch)
+	}
+	full := make(chan batch)
+
+	// Each store goroutine reports at most one error.
+	errs := make(chan error, opts.Stores)
+
+	var wg sync.WaitGroup
+	wg.Add(opts.Stores)
+
+	for g := 0; g < opts.Stores; g++ {
+		go func() {
+			defer wg.Done()
+
+			for b := range full {
+				if _, err := storeBatch(s, b.id, b.data); err != nil {
+					errs <- err
+					cancel()
+					return
+				}
+				free <- b.data[:cap(b.data)]
+			}
+		}()
+	}
+
+	run := newRun()
+	perr := func() error {
+		for n := 0; ; n++ {
+			var data []Data
+			select {
+			case data = <-free:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+
+			i, err := pull(p, data)
+			if i > 0 {
+				select {
+				case full <- batch{id: batchID(run, strconv.Itoa(n)), data: data[:i]}:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+	}()
+
+	close(full)
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return perr
+	}
+}
@@ -0,0 +1,71 @@
+// Package copier moves data from a system that knows how to pull it into a
+// system that knows how to store it. It is the decoupled version of the
+// Xenia to Pillar program from the decoupling lesson turned into a package,
+// so new systems can be plugged into Copy without touching it.
+package copier
+
+import "strconv"
+
+// Data is the structure of the data we are copying. Line is the record as
+// the system handed it out and Fields holds its typed values for systems
+// that know how to split a record up. A missing field is null.
+type Data struct {
+	Line   string
+	Fields map[string]Value
+}
+
+// Puller declares behavior for pulling data.
+type Puller interface {
+	Pull(d *Data) error
+}
+
+// Storer declares behavior for storing data.
+type Storer interface {
+	Store(d *Data) error
+}
+
+// =============================================================================
+
+// pull knows how to pull bulks of data from any Puller.
+func pull(p Puller, data []Data) (int, error) {
+	for i := range data {
+		if err := p.Pull(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// store knows how to store bulks of data from any Storer.
+func store(s Storer, data []Data) (int, error) {
+	for i := range data {
+		if err := s.Store(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// Copy knows how to pull and store data from any System. It pulls a batch,
+// stores it and repeats until the Puller returns an error. A Puller signals
+// it has no more data with io.EOF, which Copy returns as is. Batches are
+// stored as transactions when the Storer is a TxStorer.
+func Copy(p Puller, s Storer, batch int) error {
+	data := make([]Data, batch)
+	run := newRun()
+
+	for n := 0; ; n++ {
+		i, err := pull(p, data)
+		if i > 0 {
+			if _, err := storeBatch(s, batchID(run, strconv.Itoa(n)), data[:i]); err != nil {
+				return err
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
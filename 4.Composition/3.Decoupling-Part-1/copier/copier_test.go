@@ -0,0 +1,205 @@
+package copier_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier"
+)
+
+const succeed = "\u2713"
+const failed = "\u2717"
+
+// source is a Puller that hands out a fixed number of records and then
+// fails with err, io.EOF by default.
+type source struct {
+	prefix  string
+	n       int
+	next    int
+	err     error
+	latency time.Duration
+}
+
+func (s *source) Pull(d *copier.Data) error {
+	time.Sleep(s.latency)
+	if s.next == s.n {
+		if s.err != nil {
+			return s.err
+		}
+		return io.EOF
+	}
+
+	d.Line = fmt.Sprintf("%srecord %04d", s.prefix, s.next)
+	s.next++
+	return nil
+}
+
+// Cursor returns the index of the next record as the position.
+func (s *source) Cursor() string {
+	return strconv.Itoa(s.next)
+}
+
+// Seek moves the source to a position returned by Cursor.
+func (s *source) Seek(cursor string) error {
+	next, err := strconv.Atoi(cursor)
+	if err != nil || next < 0 || next > s.n {
+		return fmt.Errorf("bad cursor %q", cursor)
+	}
+	s.next = next
+	return nil
+}
+
+// sink is a Storer that records what it stored and can be told to fail.
+type sink struct {
+	mu      sync.Mutex
+	lines   []string
+	failAt  int
+	latency time.Duration
+}
+
+func (s *sink) Store(d *copier.Data) error {
+	time.Sleep(s.latency)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failAt > 0 && len(s.lines) == s.failAt {
+		return errors.New("error writing data to Pillar")
+	}
+	s.lines = append(s.lines, d.Line)
+	return nil
+}
+
+// sorted returns the stored lines in order.
+func (s *sink) sorted() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lines := append([]string(nil), s.lines...)
+	sort.Strings(lines)
+	return lines
+}
+
+// TestCopyConcurrent validates the concurrent copy stores everything the
+// sequential copy would and reports errors the same way.
+func TestCopyConcurrent(t *testing.T) {
+	errPull := errors.New("error reading data from Xenia")
+
+	tt := []struct {
+		name   string
+		src    source
+		failAt int
+		stored int
+		err    error
+	}{
+		{"all data", source{n: 1000}, 0, 1000, io.EOF},
+		{"partial batch", source{n: 1005}, 0, 1005, io.EOF},
+		{"no data", source{n: 0}, 0, 0, io.EOF},
+		{"pull error", source{n: 250, err: errPull}, 0, 250, errPull},
+	}
+
+	t.Log("Given the need to overlap pulling and storing.")
+	{
+		for testID, test := range tt {
+			t.Logf("\tTest %d:\tWhen copying %s.", testID, test.name)
+			{
+				for _, stores := range []int{1, 4} {
+					src := test.src
+					var dst sink
+
+					opts := copier.Options{Batch: 10, InFlight: 3, Stores: stores}
+					err := copier.CopyConcurrent(context.Background(), &src, &dst, opts)
+
+					if err != test.err {
+						t.Fatalf("\t%s\tTest %d:\tShould return %v with %d stores : %v", failed, testID, test.err, stores, err)
+					}
+					t.Logf("\t%s\tTest %d:\tShould return %v with %d stores.", succeed, testID, test.err, stores)
+
+					lines := dst.sorted()
+					if len(lines) != test.stored {
+						t.Fatalf("\t%s\tTest %d:\tShould store %d records : %d", failed, testID, test.stored, len(lines))
+					}
+					for i, line := range lines {
+						if want := fmt.Sprintf("record %04d", i); line != want {
+							t.Fatalf("\t%s\tTest %d:\tShould store %q : %q", failed, testID, want, line)
+						}
+					}
+					t.Logf("\t%s\tTest %d:\tShould store all %d records once.", succeed, testID, test.stored)
+				}
+			}
+		}
+
+		testID := len(tt)
+		t.Logf("\tTest %d:\tWhen a store fails.", testID)
+		{
+			src := source{n: 1000}
+			dst := sink{failAt: 95}
+
+			err := copier.CopyConcurrent(context.Background(), &src, &dst, copier.Options{Batch: 10, Stores: 2})
+			if err != nil && err.Error() == "error writing data to Pillar" {
+				t.Logf("\t%s\tTest %d:\tShould return the store error.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould return the store error : %v", failed, testID, err)
+			}
+
+			if src.next < 1000 {
+				t.Logf("\t%s\tTest %d:\tShould stop pulling.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould stop pulling : pulled %d", failed, testID, src.next)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen the context is cancelled.", testID)
+		{
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			src := source{n: 1000}
+			var dst sink
+
+			if err := copier.CopyConcurrent(ctx, &src, &dst, copier.Options{}); err == context.Canceled {
+				t.Logf("\t%s\tTest %d:\tShould return the context error.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould return the context error : %v", failed, testID, err)
+			}
+		}
+	}
+}
+
+// The simulated cost of pulling or storing a single record. Pillar is
+// slower to write to than Xenia is to read from.
+const (
+	pullLatency  = time.Millisecond
+	storeLatency = 3 * time.Millisecond
+)
+
+// BenchmarkCopy measures the sequential copy against simulated latency.
+func BenchmarkCopy(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		src := source{n: 100, latency: pullLatency}
+		dst := sink{latency: storeLatency}
+		copier.Copy(&src, &dst, 10)
+	}
+}
+
+// BenchmarkCopyConcurrent measures the concurrent copy against simulated
+// latency with a growing number of store goroutines.
+func BenchmarkCopyConcurrent(b *testing.B) {
+	for _, stores := range []int{1, 2, 4} {
+		b.Run(fmt.Sprintf("stores-%d", stores), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				src := source{n: 100, latency: pullLatency}
+				dst := sink{latency: storeLatency}
+				copier.CopyConcurrent(context.Background(), &src, &dst, copier.Options{Batch: 10, Stores: stores})
+			}
+		})
+	}
+}
@@ -0,0 +1,452 @@
+// Package copiertest checks Puller and Storer implementations against the
+// behavior Copy relies on. A system only needs a factory that builds its
+// Puller or Storer over records or a clean target, and TestPuller or
+// TestStorer runs the standard battery of edge cases against it:
+//
+//   - io.EOF on the first pull, and io.EOF again on every pull after it.
+//   - io.EOF in the middle of a batch and on a batch boundary, which leaves
+//     Copy with an empty final batch.
+//   - Transient errors from the system behind the implementation.
+//   - Empty batches and empty transactions.
+//   - Reuse of the same *Data across calls, the way Copy reuses data[i].
+//
+// A factory can stand the implementation up over a real system, a stand-in
+// server or a mock written for the test, whatever the test can reach.
+package copiertest
+
+import (
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier"
+)
+
+const succeed = "\u2713"
+const failed = "\u2717"
+
+// Source is a Puller under test and a hook into the system behind it.
+type Source struct {
+	Puller copier.Puller
+
+	// Fail makes the system fail with an error after handing out n
+	// records. Zero makes it recover. It is nil when the system can't be
+	// made to fail, and the tests that need it are skipped.
+	Fail func(n int)
+}
+
+// PullerFactory builds a Puller that hands out the specified records in
+// order and then io.EOF.
+type PullerFactory func(t *testing.T, records []copier.Data) Source
+
+// Target is a Storer under test and hooks into the system behind it.
+type Target struct {
+	Storer copier.Storer
+
+	// Stored returns the records the system holds, in the order stored.
+	Stored func() []copier.Data
+
+	// Fail makes the system refuse every record while on is true. It is
+	// nil when the system can't be made to fail, and the tests that need
+	// it are skipped.
+	Fail func(on bool)
+}
+
+// StorerFactory builds a Storer over an empty system.
+type StorerFactory func(t *testing.T) Target
+
+// =============================================================================
+
+// Records returns n records with an id and a name field and a line.
+func Records(n int) []copier.Data {
+	recs := make([]copier.Data, n)
+	for i := range recs {
+		recs[i] = copier.Data{
+			Line: fmt.Sprintf("Record %d", i),
+			Fields: map[string]copier.Value{
+				"id":   copier.Int(int64(i)),
+				"name": copier.String(fmt.Sprintf("Record %d", i)),
+			},
+		}
+	}
+	return recs
+}
+
+// Equal reports whether got holds the record want. Records with fields
+// are compared by their fields, since formats like JSON Lines rewrite the
+// line, and records without fields by their line.
+func Equal(want, got *copier.Data) bool {
+	if want.Fields == nil {
+		return got.Fields == nil && want.Line == got.Line
+	}
+
+	if len(want.Fields) != len(got.Fields) {
+		return false
+	}
+	for k, v := range want.Fields {
+		gv, ok := got.Fields[k]
+		if !ok || !v.Equal(gv) {
+			return false
+		}
+	}
+	return true
+}
+
+// same returns an error describing the first difference between the
+// records wanted and the records got.
+func same(want, got []copier.Data) error {
+	for i := range want {
+		if i == len(got) {
+			return fmt.Errorf("got %d records, want %d", len(got), len(want))
+		}
+		if !Equal(&want[i], &got[i]) {
+			return fmt.Errorf("record %d is %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if len(got) > len(want) {
+		return fmt.Errorf("got %d records, want %d", len(got), len(want))
+	}
+	return nil
+}
+
+// =============================================================================
+
+// slice is a Puller handing out records, each in its own map.
+type slice struct {
+	records []copier.Data
+}
+
+// Pull implements the copier.Puller interface.
+func (s *slice) Pull(d *copier.Data) error {
+	if len(s.records) == 0 {
+		return io.EOF
+	}
+
+	r := s.records[0]
+	s.records = s.records[1:]
+
+	d.Line = r.Line
+	d.Fields = nil
+	if r.Fields != nil {
+		d.Fields = make(map[string]copier.Value, len(r.Fields))
+		for k, v := range r.Fields {
+			d.Fields[k] = v
+		}
+	}
+
+	return nil
+}
+
+// collect is a Storer keeping what it stores.
+type collect struct {
+	records []copier.Data
+}
+
+// Store implements the copier.Storer interface.
+func (c *collect) Store(d *copier.Data) error {
+	c.records = append(c.records, *d)
+	return nil
+}
+
+// =============================================================================
+
+// TestPuller runs the battery of Puller tests against the Pullers built by
+// factory.
+func TestPuller(t *testing.T, factory PullerFactory) {
+	t.Run("EOFOnFirstPull", func(t *testing.T) {
+		src := factory(t, nil)
+
+		for i := 0; i < 3; i++ {
+			var d copier.Data
+			if err := src.Puller.Pull(&d); err != io.EOF {
+				t.Fatalf("\t%s\tShould return io.EOF on pull %d of an empty source : %v", failed, i, err)
+			}
+		}
+		t.Logf("\t%s\tShould keep returning io.EOF from an empty source.", succeed)
+
+		var c collect
+		if err := copier.Copy(factory(t, nil).Puller, &c, 3); err != io.EOF || len(c.records) != 0 {
+			t.Fatalf("\t%s\tShould copy nothing and return io.EOF : %d records : %v", failed, len(c.records), err)
+		}
+		t.Logf("\t%s\tShould copy nothing and return io.EOF.", succeed)
+	})
+
+	for _, n := range []int{7, 6} {
+		name := "EOFMidBatch"
+		if n%3 == 0 {
+			name = "EOFOnBatchBoundary"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			want := Records(n)
+			src := factory(t, want)
+
+			var c collect
+			if err := copier.Copy(src.Puller, &c, 3); err != io.EOF {
+				t.Fatalf("\t%s\tShould return io.EOF once the source is drained : %v", failed, err)
+			}
+			t.Logf("\t%s\tShould return io.EOF once the source is drained.", succeed)
+
+			if err := same(want, c.records); err != nil {
+				t.Fatalf("\t%s\tShould copy every record in order : %v", failed, err)
+			}
+			t.Logf("\t%s\tShould copy every record in order.", succeed)
+
+			var d copier.Data
+			if err := src.Puller.Pull(&d); err != io.EOF {
+				t.Fatalf("\t%s\tShould keep returning io.EOF after the last record : %v", failed, err)
+			}
+			t.Logf("\t%s\tShould keep returning io.EOF after the last record.", succeed)
+		})
+	}
+
+	t.Run("TransientError", func(t *testing.T) {
+		want := Records(10)
+		src := factory(t, want)
+		if src.Fail == nil {
+			t.Skip("the system can't be made to fail")
+		}
+		src.Fail(4)
+
+		var got []copier.Data
+		var err error
+		for err == nil {
+			var d copier.Data
+			if err = src.Puller.Pull(&d); err == nil {
+				got = append(got, d)
+			}
+		}
+
+		if err == io.EOF {
+			t.Fatalf("\t%s\tShould return the error of the system rather than io.EOF.", failed)
+		}
+		t.Logf("\t%s\tShould return the error of the system : %v", succeed, err)
+
+		if err := same(want[:4], got); err != nil {
+			t.Fatalf("\t%s\tShould hand out the records before the error : %v", failed, err)
+		}
+		t.Logf("\t%s\tShould hand out the records before the error.", succeed)
+
+		cp, ok := src.Puller.(copier.CursorPuller)
+		if !ok {
+			return
+		}
+
+		src.Fail(0)
+		if err := cp.Seek(cp.Cursor()); err != nil {
+			t.Fatalf("\t%s\tShould seek back to its cursor : %v", failed, err)
+		}
+
+		var c collect
+		if err := copier.Copy(cp, &c, 3); err != io.EOF {
+			t.Fatalf("\t%s\tShould resume once the system recovers : %v", failed, err)
+		}
+		if err := same(want[4:], c.records); err != nil {
+			t.Fatalf("\t%s\tShould resume with the record that failed : %v", failed, err)
+		}
+		t.Logf("\t%s\tShould resume with the record that failed.", succeed)
+	})
+
+	t.Run("PointerReuse", func(t *testing.T) {
+		want := Records(5)
+		src := factory(t, want)
+
+		d := copier.Data{
+			Line:   "stale",
+			Fields: map[string]copier.Value{"stale": copier.String("stale")},
+		}
+
+		var kept []copier.Data
+		for i := range want {
+			if err := src.Puller.Pull(&d); err != nil {
+				t.Fatalf("\t%s\tShould pull record %d : %v", failed, i, err)
+			}
+			if !Equal(&want[i], &d) {
+				t.Fatalf("\t%s\tShould overwrite everything in the record : got %+v, want %+v", failed, d, want[i])
+			}
+
+			// A Storer may keep the fields of a record, so a pull must
+			// not change a map it handed out before.
+			kept = append(kept, d)
+		}
+		t.Logf("\t%s\tShould overwrite everything in the record.", succeed)
+
+		if err := same(want, kept); err != nil {
+			t.Fatalf("\t%s\tShould leave the records it handed out alone : %v", failed, err)
+		}
+		t.Logf("\t%s\tShould leave the records it handed out alone.", succeed)
+	})
+}
+
+// =============================================================================
+
+// TestStorer runs the battery of Storer tests against the Storers built by
+// factory. A copier.TxStorer is also checked for all or nothing batches.
+func TestStorer(t *testing.T, factory StorerFactory) {
+	t.Run("EmptyBatch", func(t *testing.T) {
+		tgt := factory(t)
+
+		if err := copier.Copy(&slice{}, tgt.Storer, 3); err != io.EOF {
+			t.Fatalf("\t%s\tShould copy an empty source : %v", failed, err)
+		}
+
+		if tx, ok := tgt.Storer.(copier.TxStorer); ok {
+			if err := tx.Begin("empty"); err != nil {
+				t.Fatalf("\t%s\tShould begin an empty transaction : %v", failed, err)
+			}
+			if err := tx.Commit(); err != nil {
+				t.Fatalf("\t%s\tShould commit an empty transaction : %v", failed, err)
+			}
+		}
+
+		if got := tgt.Stored(); len(got) != 0 {
+			t.Fatalf("\t%s\tShould store nothing : %d records", failed, len(got))
+		}
+		t.Logf("\t%s\tShould store nothing.", succeed)
+	})
+
+	for _, n := range []int{7, 6} {
+		name := "EOFMidBatch"
+		if n%3 == 0 {
+			name = "EOFOnBatchBoundary"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			want := Records(n)
+			tgt := factory(t)
+
+			if err := copier.Copy(&slice{records: want}, tgt.Storer, 3); err != io.EOF {
+				t.Fatalf("\t%s\tShould copy every record : %v", failed, err)
+			}
+			if err := same(want, tgt.Stored()); err != nil {
+				t.Fatalf("\t%s\tShould store every record in order : %v", failed, err)
+			}
+			t.Logf("\t%s\tShould store every record in order.", succeed)
+		})
+	}
+
+	t.Run("TransientError", func(t *testing.T) {
+		want := Records(6)
+		tgt := factory(t)
+		if tgt.Fail == nil {
+			t.Skip("the system can't be made to fail")
+		}
+
+		if err := copier.Copy(&slice{records: want[:3]}, tgt.Storer, 3); err != io.EOF {
+			t.Fatalf("\t%s\tShould store the first batch : %v", failed, err)
+		}
+
+		tgt.Fail(true)
+		err := store(tgt.Storer, want[3:])
+		if err == nil {
+			t.Fatalf("\t%s\tShould return the error of the system.", failed)
+		}
+		t.Logf("\t%s\tShould return the error of the system : %v", succeed, err)
+
+		if _, ok := tgt.Storer.(copier.TxStorer); ok {
+			if err := same(want[:3], tgt.Stored()); err != nil {
+				t.Fatalf("\t%s\tShould store nothing of a failed batch : %v", failed, err)
+			}
+			t.Logf("\t%s\tShould store nothing of a failed batch.", succeed)
+		}
+
+		tgt.Fail(false)
+		if err := store(tgt.Storer, want[3:]); err != nil {
+			t.Fatalf("\t%s\tShould store the batch once the system recovers : %v", failed, err)
+		}
+
+		// A plain Storer may have stored some of the failed batch, so only
+		// a TxStorer must end up with each record once.
+		got := tgt.Stored()
+		if _, ok := tgt.Storer.(copier.TxStorer); !ok {
+			got = dedup(got)
+		}
+		if err := same(want, got); err != nil {
+			t.Fatalf("\t%s\tShould store every record : %v", failed, err)
+		}
+		t.Logf("\t%s\tShould store every record.", succeed)
+	})
+
+	t.Run("PointerReuse", func(t *testing.T) {
+		want := Records(5)
+		tgt := factory(t)
+
+		// Copy stores the same data[i] again and again, and a Puller may
+		// fill it with the same map. A Storer must copy what it keeps.
+		var d copier.Data
+		d.Fields = make(map[string]copier.Value)
+		if tx, ok := tgt.Storer.(copier.TxStorer); ok {
+			if err := tx.Begin("reuse"); err != nil {
+				t.Fatalf("\t%s\tShould begin a transaction : %v", failed, err)
+			}
+		}
+		for i := range want {
+			d.Line = want[i].Line
+			for k := range d.Fields {
+				delete(d.Fields, k)
+			}
+			for k, v := range want[i].Fields {
+				d.Fields[k] = v
+			}
+
+			if err := tgt.Storer.Store(&d); err != nil {
+				t.Fatalf("\t%s\tShould store record %d : %v", failed, i, err)
+			}
+		}
+		if tx, ok := tgt.Storer.(copier.TxStorer); ok {
+			if err := tx.Commit(); err != nil {
+				t.Fatalf("\t%s\tShould commit the transaction : %v", failed, err)
+			}
+		}
+
+		d.Line = "stale"
+		d.Fields["id"] = copier.String("stale")
+
+		if err := same(want, tgt.Stored()); err != nil {
+			t.Fatalf("\t%s\tShould keep its own copy of every record : %v", failed, err)
+		}
+		t.Logf("\t%s\tShould keep its own copy of every record.", succeed)
+	})
+}
+
+// store stores records as one batch, in a transaction for a TxStorer.
+func store(s copier.Storer, records []copier.Data) error {
+	tx, ok := s.(copier.TxStorer)
+	if ok {
+		if err := tx.Begin(fmt.Sprint(records[0].Fields["id"])); err != nil {
+			return err
+		}
+	}
+
+	for i := range records {
+		if err := s.Store(&records[i]); err != nil {
+			if ok {
+				tx.Rollback()
+			}
+			return err
+		}
+	}
+
+	if ok {
+		if err := tx.Commit(); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return nil
+}
+
+// dedup drops records seen before, keeping the first of each.
+func dedup(records []copier.Data) []copier.Data {
+	seen := make(map[string]bool)
+
+	var out []copier.Data
+	for _, d := range records {
+		k := fmt.Sprint(d.Line, d.Fields["id"])
+		if !seen[k] {
+			seen[k] = true
+			out = append(out, d)
+		}
+	}
+	return out
+}
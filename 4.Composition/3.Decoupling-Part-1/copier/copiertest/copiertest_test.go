@@ -0,0 +1,125 @@
+package copiertest_test
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier"
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier/copiertest"
+)
+
+// mock is a system written for a test, the way the mocking lesson has the
+// user of an API mock just the methods they use. It hands out records
+// like a source and keeps what it is given like a target.
+type mock struct {
+	mu      sync.Mutex
+	records []copier.Data
+	next    int
+	failAt  int
+	fail    bool
+	stored  []copier.Data
+}
+
+// Pull implements the copier.Puller interface.
+func (m *mock) Pull(d *copier.Data) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.failAt > 0 && m.next >= m.failAt {
+		return errors.New("error reading data from mock")
+	}
+	if m.next == len(m.records) {
+		return io.EOF
+	}
+
+	r := m.records[m.next]
+	m.next++
+
+	d.Line = r.Line
+	d.Fields = make(map[string]copier.Value, len(r.Fields))
+	for k, v := range r.Fields {
+		d.Fields[k] = v
+	}
+
+	return nil
+}
+
+// Cursor implements the copier.CursorPuller interface.
+func (m *mock) Cursor() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return strconv.Itoa(m.next)
+}
+
+// Seek implements the copier.CursorPuller interface.
+func (m *mock) Seek(cursor string) error {
+	n, err := strconv.Atoi(cursor)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.next = n
+	return nil
+}
+
+// Store implements the copier.Storer interface.
+func (m *mock) Store(d *copier.Data) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.fail {
+		return errors.New("error writing data to mock")
+	}
+
+	cp := copier.Data{Line: d.Line, Fields: make(map[string]copier.Value, len(d.Fields))}
+	for k, v := range d.Fields {
+		cp.Fields[k] = v
+	}
+	m.stored = append(m.stored, cp)
+
+	return nil
+}
+
+// TestMockPuller runs the Puller battery against the mock.
+func TestMockPuller(t *testing.T) {
+	copiertest.TestPuller(t, func(t *testing.T, records []copier.Data) copiertest.Source {
+		m := mock{records: records}
+
+		return copiertest.Source{
+			Puller: &m,
+			Fail: func(n int) {
+				m.mu.Lock()
+				m.failAt = n
+				m.mu.Unlock()
+			},
+		}
+	})
+}
+
+// TestMockStorer runs the Storer battery against the mock.
+func TestMockStorer(t *testing.T) {
+	copiertest.TestStorer(t, func(t *testing.T) copiertest.Target {
+		var m mock
+
+		return copiertest.Target{
+			Storer: &m,
+			Stored: func() []copier.Data {
+				m.mu.Lock()
+				defer m.mu.Unlock()
+				return append([]copier.Data(nil), m.stored...)
+			},
+			Fail: func(on bool) {
+				m.mu.Lock()
+				m.fail = on
+				m.mu.Unlock()
+			},
+		}
+	})
+}
@@ -0,0 +1,137 @@
+package copier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrErrorRate is returned when too many records have failed to store.
+var ErrErrorRate = errors.New("error rate above threshold")
+
+// DeadLetterer declares behavior for keeping records that failed to store,
+// along with why and when they failed, so they can be replayed later.
+type DeadLetterer interface {
+	DeadLetter(d *Data, err error, at time.Time) error
+}
+
+// ErrorPolicy decides what happens to a record that fails to store.
+type ErrorPolicy struct {
+	Retries   int              // Attempts after the first one.
+	Backoff   time.Duration    // Wait before the first retry, doubled for each one after.
+	Retryable func(error) bool // Errors worth retrying. Nil retries every error.
+	Dead      DeadLetterer     // Where records go once out of retries. Nil fails the copy.
+	MaxRate   float64          // Fraction of dead letters that fails the copy. Zero never does.
+	MinSeen   int              // Records stored or failed before MaxRate is checked.
+}
+
+// PolicyStats describes what a PolicyStorer has done.
+type PolicyStats struct {
+	Stored  int // Records stored, retried or not.
+	Retries int // Retries made.
+	Dead    int // Records sent to the dead letters.
+}
+
+// PolicyStorer is a Storer that applies an ErrorPolicy to another Storer.
+// Records that still fail after their retries are handed to the dead
+// letters and the copy carries on, until the share of dead letters crosses
+// the threshold. It is safe for concurrent use when the Storers it wraps
+// are.
+//
+// A PolicyStorer isn't a TxStorer, even around one. Every record is stored
+// on its own, outside a transaction, so it can be retried and dead lettered
+// by itself, and a failed batch leaves the records stored before the
+// failure behind. A TxStorer that only stores in transactions fails every
+// record.
+type PolicyStorer struct {
+	ctx    context.Context
+	s      Storer
+	policy ErrorPolicy
+
+	mu    sync.Mutex
+	stats PolicyStats
+}
+
+// NewPolicyStorer constructs a Storer applying the policy to s. Once ctx is
+// done it stops waiting to retry and a record that is waiting fails with
+// the error of ctx, without being dead lettered.
+func NewPolicyStorer(ctx context.Context, s Storer, policy ErrorPolicy) *PolicyStorer {
+	return &PolicyStorer{
+		ctx:    ctx,
+		s:      s,
+		policy: policy,
+	}
+}
+
+// Store implements the Storer interface.
+func (ps *PolicyStorer) Store(d *Data) error {
+	err := ps.s.Store(d)
+
+	var retries int
+	wait := ps.policy.Backoff
+	for err != nil && retries < ps.policy.Retries && ps.retryable(err) {
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-ps.ctx.Done():
+			t.Stop()
+
+			ps.mu.Lock()
+			ps.stats.Retries += retries
+			ps.mu.Unlock()
+
+			return ps.ctx.Err()
+		}
+		wait *= 2
+
+		retries++
+		err = ps.s.Store(d)
+	}
+
+	ps.mu.Lock()
+	ps.stats.Retries += retries
+	if err == nil {
+		ps.stats.Stored++
+	}
+	ps.mu.Unlock()
+
+	if err == nil {
+		return nil
+	}
+
+	if ps.policy.Dead == nil {
+		return err
+	}
+	if derr := ps.policy.Dead.DeadLetter(d, err, time.Now().UTC()); derr != nil {
+		return fmt.Errorf("dead letter: %w (storing: %v)", derr, err)
+	}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	ps.stats.Dead++
+
+	seen := ps.stats.Stored + ps.stats.Dead
+	if ps.policy.MaxRate > 0 && seen >= ps.policy.MinSeen {
+		if rate := float64(ps.stats.Dead) / float64(seen); rate > ps.policy.MaxRate {
+			return fmt.Errorf("%w: %d of %d records failed, last: %v", ErrErrorRate, ps.stats.Dead, seen, err)
+		}
+	}
+
+	return nil
+}
+
+// retryable reports whether the policy retries err.
+func (ps *PolicyStorer) retryable(err error) bool {
+	return ps.policy.Retryable == nil || ps.policy.Retryable(err)
+}
+
+// Stats returns what the storer has done so far.
+func (ps *PolicyStorer) Stats() PolicyStats {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	return ps.stats
+}
@@ -0,0 +1,160 @@
+package copier_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier"
+)
+
+// flaky is a Storer that fails the first store of records ending in 3 and
+// every store of records ending in 7.
+type flaky struct {
+	mu       sync.Mutex
+	attempts map[string]int
+	stored   []string
+}
+
+func (f *flaky) Store(d *copier.Data) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.attempts == nil {
+		f.attempts = make(map[string]int)
+	}
+	f.attempts[d.Line]++
+
+	switch {
+	case strings.HasSuffix(d.Line, "7"):
+		return errors.New("Pillar rejected the record")
+	case strings.HasSuffix(d.Line, "3") && f.attempts[d.Line] == 1:
+		return errors.New("Pillar timed out")
+	}
+
+	f.stored = append(f.stored, d.Line)
+	return nil
+}
+
+// letters is a DeadLetterer that keeps what it is given.
+type letters struct {
+	mu    sync.Mutex
+	lines []string
+	errs  []error
+}
+
+func (l *letters) DeadLetter(d *copier.Data, err error, at time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.lines = append(l.lines, d.Line)
+	l.errs = append(l.errs, err)
+	return nil
+}
+
+// TestPolicyStorer validates failed records are retried, then dead lettered
+// while the copy carries on, until the error rate gets too high.
+func TestPolicyStorer(t *testing.T) {
+	t.Log("Given the need to keep copying when some records fail.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen one in ten records always fails.", testID)
+		{
+			var dst flaky
+			var dead letters
+			ps := copier.NewPolicyStorer(context.Background(), &dst, copier.ErrorPolicy{
+				Retries: 2,
+				Backoff: time.Millisecond,
+				Dead:    &dead,
+				MaxRate: 0.2,
+			})
+
+			if err := copier.Copy(&source{n: 100}, ps, 10); err != io.EOF {
+				t.Fatalf("\t%s\tTest %d:\tShould copy to io.EOF : %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould copy to io.EOF.", succeed, testID)
+
+			if st := ps.Stats(); st.Stored == 90 && st.Dead == 10 && st.Retries == 10+20 {
+				t.Logf("\t%s\tTest %d:\tShould retry and count every record.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould retry and count every record : %+v", failed, testID, st)
+			}
+
+			if len(dead.lines) == 10 && dead.lines[0] == "record 0007" && dead.errs[0].Error() == "Pillar rejected the record" {
+				t.Logf("\t%s\tTest %d:\tShould dead letter the records with their errors.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould dead letter the records with their errors : %v", failed, testID, dead.lines)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen the error rate is above the threshold.", testID)
+		{
+			var dead letters
+			ps := copier.NewPolicyStorer(context.Background(), &flaky{}, copier.ErrorPolicy{
+				Retries:   1,
+				Retryable: func(err error) bool { return err.Error() == "Pillar timed out" },
+				Dead:      &dead,
+				MaxRate:   0.05,
+				MinSeen:   20,
+			})
+
+			err := copier.Copy(&source{n: 100}, ps, 10)
+			if errors.Is(err, copier.ErrErrorRate) && ps.Stats().Dead == 3 {
+				t.Logf("\t%s\tTest %d:\tShould abort once enough records were seen : %v", succeed, testID, err)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould abort once enough records were seen : %v %+v", failed, testID, err, ps.Stats())
+			}
+
+			if ps.Stats().Retries == 3 {
+				t.Logf("\t%s\tTest %d:\tShould only retry retryable errors.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould only retry retryable errors : %+v", failed, testID, ps.Stats())
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen there are no dead letters.", testID)
+		{
+			ps := copier.NewPolicyStorer(context.Background(), &flaky{}, copier.ErrorPolicy{Retries: 1})
+
+			if err := copier.Copy(&source{n: 100}, ps, 10); err != nil && err.Error() == "Pillar rejected the record" {
+				t.Logf("\t%s\tTest %d:\tShould fail the copy like Copy does.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould fail the copy like Copy does : %v", failed, testID, err)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen the copy is cancelled while waiting to retry.", testID)
+		{
+			var dead letters
+			ctx, cancel := context.WithCancel(context.Background())
+			ps := copier.NewPolicyStorer(ctx, &flaky{}, copier.ErrorPolicy{
+				Retries: 5,
+				Backoff: time.Hour,
+				Dead:    &dead,
+			})
+
+			time.AfterFunc(10*time.Millisecond, cancel)
+
+			start := time.Now()
+			err := copier.Copy(&source{n: 100}, ps, 10)
+			if err == context.Canceled && time.Since(start) < time.Minute {
+				t.Logf("\t%s\tTest %d:\tShould stop waiting : %v", succeed, testID, err)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould stop waiting : %v", failed, testID, err)
+			}
+
+			if len(dead.lines) == 0 {
+				t.Logf("\t%s\tTest %d:\tShould not dead letter the record.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould not dead letter the record : %v", failed, testID, dead.lines)
+			}
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package file
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier"
+)
+
+// CSVPuller pulls records from CSV whose first row names the fields. It
+// has no cursor since a quoted field can span lines.
+type CSVPuller struct {
+	r      *csv.Reader
+	header []string
+}
+
+// NewCSVPuller constructs a Puller reading CSV from r.
+func NewCSVPuller(r io.Reader) *CSVPuller {
+	cr := csv.NewReader(r)
+	cr.ReuseRecord = true
+	cr.FieldsPerRecord = -1
+
+	return &CSVPuller{
+		r: cr,
+	}
+}
+
+// Pull implements the copier.Puller interface.
+func (p *CSVPuller) Pull(d *copier.Data) error {
+	if p.header == nil {
+		header, err := p.r.Read()
+		if err != nil {
+			return err
+		}
+		p.header = append([]string(nil), header...)
+	}
+
+	record, err := p.r.Read()
+	if err != nil {
+		return err
+	}
+
+	if len(record) != len(p.header) {
+		line, _ := p.r.FieldPos(0)
+		return fmt.Errorf("line %d: %d fields, header has %d", line, len(record), len(p.header))
+	}
+
+	fields := make(map[string]copier.Value, len(record))
+	for i, v := range record {
+		fields[p.header[i]] = copier.String(v)
+	}
+
+	d.Line = strings.Join(record, ",")
+	d.Fields = fields
+	return nil
+}
+
+// =============================================================================
+
+// CSVStorer stores records as CSV, starting with a header row.
+type CSVStorer struct {
+	w      *csv.Writer
+	header []string
+	row    []string
+}
+
+// NewCSVStorer constructs a Storer writing CSV to w. The header names the
+// columns in order. With no header, the sorted field names of the first
+// record are used.
+func NewCSVStorer(w io.Writer, header ...string) *CSVStorer {
+	return &CSVStorer{
+		w:      csv.NewWriter(w),
+		header: header,
+	}
+}
+
+// Store implements the copier.Storer interface. A field that isn't in the
+// header is an error rather than being dropped.
+func (s *CSVStorer) Store(d *copier.Data) error {
+	fields := fields(d)
+
+	if s.row == nil {
+		if s.header == nil {
+			s.header = names(fields)
+		}
+		if err := s.w.Write(s.header); err != nil {
+			return err
+		}
+		s.row = make([]string, len(s.header))
+	}
+
+	var n int
+	for i, name := range s.header {
+		v, ok := fields[name]
+		if ok {
+			n++
+		}
+		s.row[i] = v.String()
+	}
+
+	if n != len(fields) {
+		return errors.New("record has fields that are not in the header")
+	}
+
+	return s.w.Write(s.row)
+}
+
+// Flush writes any buffered records to the output.
+func (s *CSVStorer) Flush() error {
+	s.w.Flush()
+	return s.w.Error()
+}
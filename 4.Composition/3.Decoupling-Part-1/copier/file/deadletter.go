@@ -0,0 +1,128 @@
+package file
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier"
+)
+
+// letter is a dead letter as it is written to the file. Values keep their
+// kind so a replay hands out the record that failed.
+type letter struct {
+	At     time.Time              `json:"at"`
+	Error  string                 `json:"error"`
+	Line   string                 `json:"line,omitempty"`
+	Fields map[string]letterValue `json:"fields,omitempty"`
+}
+
+type letterValue struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value,omitempty"`
+}
+
+// DeadLetterWriter keeps records that failed to store as JSON Lines, each
+// with the error and the time it failed. Every record is written as soon
+// as it fails so none are lost to a buffer. It is safe for concurrent use.
+type DeadLetterWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewDeadLetterWriter constructs a dead letter file writing to w.
+func NewDeadLetterWriter(w io.Writer) *DeadLetterWriter {
+	return &DeadLetterWriter{
+		w: w,
+	}
+}
+
+// DeadLetter implements the copier.DeadLetterer interface.
+func (dw *DeadLetterWriter) DeadLetter(d *copier.Data, err error, at time.Time) error {
+	l := letter{
+		At:    at,
+		Error: err.Error(),
+		Line:  d.Line,
+	}
+
+	if len(d.Fields) > 0 {
+		l.Fields = make(map[string]letterValue, len(d.Fields))
+		for k, v := range d.Fields {
+			l.Fields[k] = letterValue{Kind: v.Kind().String(), Value: v.String()}
+		}
+	}
+
+	b, jerr := json.Marshal(l)
+	if jerr != nil {
+		return jerr
+	}
+	b = append(b, '\n')
+
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+
+	_, werr := dw.w.Write(b)
+	return werr
+}
+
+// =============================================================================
+
+// DeadLetterPuller pulls the records back out of a dead letter file so
+// they can be copied again once the target is fixed.
+type DeadLetterPuller struct {
+	*lines
+	last letter
+}
+
+// NewDeadLetterPuller constructs a Puller reading a dead letter file from r.
+func NewDeadLetterPuller(r io.Reader) *DeadLetterPuller {
+	return &DeadLetterPuller{
+		lines: newLines(r),
+	}
+}
+
+// Pull implements the copier.Puller interface.
+func (p *DeadLetterPuller) Pull(d *copier.Data) error {
+	for {
+		line, err := p.next()
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		var l letter
+		if err := json.Unmarshal([]byte(line), &l); err != nil {
+			return p.errorf("%v", err)
+		}
+
+		var fields map[string]copier.Value
+		if l.Fields != nil {
+			fields = make(map[string]copier.Value, len(l.Fields))
+			for k, lv := range l.Fields {
+				kind, err := copier.ParseKind(lv.Kind)
+				if err != nil {
+					return p.errorf("field %s: %v", k, err)
+				}
+				v, err := copier.ParseValue(kind, lv.Value)
+				if err != nil {
+					return p.errorf("field %s: %v", k, err)
+				}
+				fields[k] = v
+			}
+		}
+
+		p.last = l
+		d.Line = l.Line
+		d.Fields = fields
+		return nil
+	}
+}
+
+// Failure returns why and when the record pulled last failed.
+func (p *DeadLetterPuller) Failure() (string, time.Time) {
+	return p.last.Error, p.last.At
+}
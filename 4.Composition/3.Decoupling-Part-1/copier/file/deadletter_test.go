@@ -0,0 +1,71 @@
+package file_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier"
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier/file"
+)
+
+// TestDeadLetter validates dead letters are replayed as the records that
+// failed.
+func TestDeadLetter(t *testing.T) {
+	at := time.Date(2021, time.March, 5, 10, 0, 0, 0, time.UTC)
+
+	t.Log("Given the need to replay records that failed to store.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen reading back a dead letter file.", testID)
+		{
+			var buf bytes.Buffer
+			dw := file.NewDeadLetterWriter(&buf)
+
+			want := copier.Data{
+				Line: "42,9.75",
+				Fields: map[string]copier.Value{
+					"id":    copier.Int(42),
+					"price": copier.Float(9.75),
+					"at":    copier.Time(at),
+					"blob":  copier.Bytes([]byte("x")),
+					"note":  copier.Null(),
+				},
+			}
+			dw.DeadLetter(&want, errors.New("Pillar rejected the record"), at)
+			dw.DeadLetter(&copier.Data{Line: "Data"}, errors.New("Pillar timed out"), at.Add(time.Second))
+
+			p := file.NewDeadLetterPuller(&buf)
+
+			var d copier.Data
+			if err := p.Pull(&d); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould pull the first record : %v", failed, testID, err)
+			}
+
+			ok := d.Line == want.Line && len(d.Fields) == len(want.Fields)
+			for k, v := range want.Fields {
+				ok = ok && d.Fields[k].Equal(v)
+			}
+			if ok {
+				t.Logf("\t%s\tTest %d:\tShould pull back the typed record.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould pull back the typed record : %+v", failed, testID, d)
+			}
+
+			if msg, when := p.Failure(); msg == "Pillar rejected the record" && when.Equal(at) {
+				t.Logf("\t%s\tTest %d:\tShould keep the error and time.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould keep the error and time : %s %v", failed, testID, msg, when)
+			}
+
+			err1, err2 := p.Pull(&d), p.Pull(&d)
+			if err1 == nil && d.Line == "Data" && d.Fields == nil && err2 == io.EOF {
+				t.Logf("\t%s\tTest %d:\tShould pull a record without fields and then io.EOF.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould pull a record without fields and then io.EOF : %v %v", failed, testID, err1, err2)
+			}
+		}
+	}
+}
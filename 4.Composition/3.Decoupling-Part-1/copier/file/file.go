@@ -0,0 +1,114 @@
+// Package file provides Pullers and Storers for the export formats we
+// move data with: JSON Lines, CSV and fixed-width AS400 records. Pullers
+// stream their input one record at a time and Storers buffer their output,
+// so Flush must be called once the copy is done.
+//
+// CSV and fixed-width records are text, so their Pullers hand out string
+// values. Wrap them with copier.Schema.Puller to get the typed values.
+package file
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier"
+)
+
+// LineField is the field a Storer writes when a record has no fields, as
+// with the systems that only hand out a line.
+const LineField = "line"
+
+// fields returns the fields of d to write.
+func fields(d *copier.Data) map[string]copier.Value {
+	if d.Fields == nil {
+		return map[string]copier.Value{LineField: copier.String(d.Line)}
+	}
+
+	return d.Fields
+}
+
+// names returns the field names of a record in sorted order.
+func names(fields map[string]copier.Value) []string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// =============================================================================
+
+// lines reads an input one line at a time and keeps track of the offset of
+// the next line, which is the cursor of the line based Pullers.
+type lines struct {
+	src    io.Reader
+	r      *bufio.Reader
+	offset int64
+	line   int
+}
+
+// newLines constructs a line reader for r.
+func newLines(r io.Reader) *lines {
+	return &lines{
+		src: r,
+		r:   bufio.NewReader(r),
+	}
+}
+
+// next returns the next line without its line ending. A last line with no
+// line ending is still returned, and io.EOF after that.
+func (l *lines) next() (string, error) {
+	s, err := l.r.ReadString('\n')
+	if err != nil && (err != io.EOF || s == "") {
+		return "", err
+	}
+
+	l.offset += int64(len(s))
+	l.line++
+
+	s = strings.TrimSuffix(s, "\n")
+	s = strings.TrimSuffix(s, "\r")
+
+	return s, nil
+}
+
+// errorf returns an error about the line just read.
+func (l *lines) errorf(format string, a ...interface{}) error {
+	return fmt.Errorf("line %d: %s", l.line, fmt.Sprintf(format, a...))
+}
+
+// Cursor returns the offset of the next line.
+func (l *lines) Cursor() string {
+	return strconv.FormatInt(l.offset, 10)
+}
+
+// Seek moves back to an offset returned by Cursor. The input has to be an
+// io.Seeker. Line numbers in errors count from the cursor.
+func (l *lines) Seek(cursor string) error {
+	s, ok := l.src.(io.Seeker)
+	if !ok {
+		return errors.New("input does not support seeking")
+	}
+
+	offset, err := strconv.ParseInt(cursor, 10, 64)
+	if err != nil || offset < 0 {
+		return fmt.Errorf("invalid cursor %q", cursor)
+	}
+
+	if _, err := s.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	l.r.Reset(l.src)
+	l.offset = offset
+	l.line = 0
+
+	return nil
+}
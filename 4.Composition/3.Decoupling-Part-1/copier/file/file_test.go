@@ -0,0 +1,395 @@
+package file_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier"
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier/copiertest"
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier/file"
+)
+
+const succeed = "\u2713"
+const failed = "\u2717"
+
+// flusher is a Storer with buffered output.
+type flusher interface {
+	copier.Storer
+	Flush() error
+}
+
+// format is a file format under the contract. Formats with columns can
+// only store the fields they were set up with.
+type format struct {
+	name      string
+	columns   bool
+	newPuller func(r io.Reader) copier.Puller
+	newStorer func(w io.Writer) flusher
+}
+
+var layout = file.Layout{
+	{Name: "id", Width: 6},
+	{Name: "name", Width: 12},
+	{Name: "qty", Width: 4},
+}
+
+var formats = []format{
+	{
+		"jsonl",
+		false,
+		func(r io.Reader) copier.Puller { return file.NewJSONLPuller(r) },
+		func(w io.Writer) flusher { return file.NewJSONLStorer(w) },
+	},
+	{
+		"csv",
+		true,
+		func(r io.Reader) copier.Puller { return file.NewCSVPuller(r) },
+		func(w io.Writer) flusher { return file.NewCSVStorer(w, "id", "name", "qty") },
+	},
+	{
+		"fixed",
+		true,
+		func(r io.Reader) copier.Puller { return file.NewFixedPuller(r, layout) },
+		func(w io.Writer) flusher { return file.NewFixedStorer(w, layout) },
+	},
+}
+
+// records returns n records every format can hold.
+func records(n int) []map[string]copier.Value {
+	recs := make([]map[string]copier.Value, n)
+	for i := range recs {
+		recs[i] = map[string]copier.Value{
+			"id":   copier.String(fmt.Sprintf("%06d", i)),
+			"name": copier.String(fmt.Sprintf("item, %d", i)),
+			"qty":  copier.String(fmt.Sprint(i % 7)),
+		}
+	}
+	return recs
+}
+
+// collect is a Storer that keeps the fields of what it stores.
+type collect struct {
+	fields []map[string]copier.Value
+}
+
+func (c *collect) Store(d *copier.Data) error {
+	c.fields = append(c.fields, d.Fields)
+	return nil
+}
+
+// TestContract validates every format behaves the way Copy expects a
+// Puller and Storer to behave.
+func TestContract(t *testing.T) {
+	t.Log("Given the need for file formats to plug into Copy.")
+	{
+		for testID, f := range formats {
+			t.Logf("\tTest %d:\tWhen using the %s format.", testID, f.name)
+			{
+				var buf bytes.Buffer
+				s := f.newStorer(&buf)
+				want := records(25)
+				for i := range want {
+					if err := s.Store(&copier.Data{Fields: want[i]}); err != nil {
+						t.Fatalf("\t%s\tTest %d:\tShould be able to store a record : %v", failed, testID, err)
+					}
+				}
+				if err := s.Flush(); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to flush : %v", failed, testID, err)
+				}
+
+				var got collect
+				if err := copier.Copy(f.newPuller(&buf), &got, 10); err != io.EOF {
+					t.Fatalf("\t%s\tTest %d:\tShould copy to io.EOF : %v", failed, testID, err)
+				}
+
+				if reflect.DeepEqual(got.fields, want) {
+					t.Logf("\t%s\tTest %d:\tShould pull back what was stored.", succeed, testID)
+				} else {
+					t.Errorf("\t%s\tTest %d:\tShould pull back what was stored : %v", failed, testID, got.fields[:1])
+				}
+
+				p := f.newPuller(strings.NewReader(""))
+				var d copier.Data
+				if err1, err2 := p.Pull(&d), p.Pull(&d); err1 == io.EOF && err2 == io.EOF {
+					t.Logf("\t%s\tTest %d:\tShould return io.EOF on empty input and after.", succeed, testID)
+				} else {
+					t.Errorf("\t%s\tTest %d:\tShould return io.EOF on empty input and after : %v %v", failed, testID, err1, err2)
+				}
+
+				if !f.columns {
+					continue
+				}
+
+				buf.Reset()
+				s = f.newStorer(&buf)
+				s.Store(&copier.Data{Fields: want[0]})
+				s.Flush()
+				out := buf.String()
+
+				if err := s.Store(&copier.Data{Fields: map[string]copier.Value{"id": copier.String("1"), "extra": copier.String("x")}}); err != nil {
+					t.Logf("\t%s\tTest %d:\tShould refuse a field it can't write : %v", succeed, testID, err)
+				} else {
+					t.Errorf("\t%s\tTest %d:\tShould refuse a field it can't write.", failed, testID)
+				}
+
+				s.Flush()
+				if buf.String() == out {
+					t.Logf("\t%s\tTest %d:\tShould write nothing for a refused record.", succeed, testID)
+				} else {
+					t.Errorf("\t%s\tTest %d:\tShould write nothing for a refused record : %q", failed, testID, buf.String())
+				}
+			}
+		}
+	}
+}
+
+// typed gives the fields of copiertest.Records back their kinds once CSV,
+// which only holds text, is pulled.
+var typed = copier.Schema{Fields: []copier.Field{
+	{Name: "id", Kind: copier.KindInt, Required: true},
+	{Name: "name", Kind: copier.KindString},
+}}
+
+// battery runs the copiertest batteries against a format. The Puller
+// pulls what the Storer wrote, and the Storer is read back with the
+// Puller.
+func battery(t *testing.T, newPuller func(r io.Reader) copier.Puller, newStorer func(w io.Writer) flusher) {
+	t.Run("Puller", func(t *testing.T) {
+		copiertest.TestPuller(t, func(t *testing.T, records []copier.Data) copiertest.Source {
+			var buf bytes.Buffer
+			s := newStorer(&buf)
+			for i := range records {
+				if err := s.Store(&records[i]); err != nil {
+					t.Fatalf("Should be able to store record %d : %v", i, err)
+				}
+			}
+			if err := s.Flush(); err != nil {
+				t.Fatalf("Should be able to flush : %v", err)
+			}
+
+			return copiertest.Source{Puller: newPuller(&buf)}
+		})
+	})
+
+	t.Run("Storer", func(t *testing.T) {
+		copiertest.TestStorer(t, func(t *testing.T) copiertest.Target {
+			var buf bytes.Buffer
+			s := newStorer(&buf)
+
+			stored := func() []copier.Data {
+				if err := s.Flush(); err != nil {
+					t.Fatalf("Should be able to flush : %v", err)
+				}
+
+				var got []copier.Data
+				p := newPuller(bytes.NewReader(buf.Bytes()))
+				for {
+					var d copier.Data
+					err := p.Pull(&d)
+					if err == io.EOF {
+						return got
+					}
+					if err != nil {
+						t.Fatalf("Should be able to read back what was stored : %v", err)
+					}
+					got = append(got, d)
+				}
+			}
+
+			return copiertest.Target{Storer: s, Stored: stored}
+		})
+	})
+}
+
+// TestJSONLContract runs the Puller and Storer batteries against JSON
+// Lines.
+func TestJSONLContract(t *testing.T) {
+	battery(t,
+		func(r io.Reader) copier.Puller { return file.NewJSONLPuller(r) },
+		func(w io.Writer) flusher { return file.NewJSONLStorer(w) },
+	)
+}
+
+// TestCSVContract runs the Puller and Storer batteries against CSV.
+func TestCSVContract(t *testing.T) {
+	battery(t,
+		func(r io.Reader) copier.Puller { return typed.Puller(file.NewCSVPuller(r)) },
+		func(w io.Writer) flusher { return file.NewCSVStorer(w) },
+	)
+}
+
+// TestMalformed validates bad input fails with the line it is on.
+func TestMalformed(t *testing.T) {
+	tt := []struct {
+		name  string
+		p     copier.Puller
+		line2 string
+	}{
+		{"jsonl", file.NewJSONLPuller(strings.NewReader("{\"id\":\"1\"}\n{\"id\":\n")), "line 2"},
+		{"csv", file.NewCSVPuller(strings.NewReader("id,name\n1,a\n2\n")), "line 3"},
+		{"fixed", file.NewFixedPuller(strings.NewReader("000001apple       1   \nshort\n"), layout), "line 2"},
+	}
+
+	t.Log("Given the need to find bad records in an export.")
+	{
+		for testID, test := range tt {
+			t.Logf("\tTest %d:\tWhen reading a bad %s record.", testID, test.name)
+			{
+				var d copier.Data
+				if err := test.p.Pull(&d); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould pull the good record : %v", failed, testID, err)
+				}
+
+				if err := test.p.Pull(&d); err != nil && strings.Contains(err.Error(), test.line2) {
+					t.Logf("\t%s\tTest %d:\tShould report %s : %v", succeed, testID, test.line2, err)
+				} else {
+					t.Errorf("\t%s\tTest %d:\tShould report %s : %v", failed, testID, test.line2, err)
+				}
+			}
+		}
+	}
+}
+
+// TestJSONLValues validates JSON values become values of the right kind.
+func TestJSONLValues(t *testing.T) {
+	t.Log("Given the need to read JSON Lines written by other systems.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a record has numbers, booleans and nulls.", testID)
+		{
+			p := file.NewJSONLPuller(strings.NewReader(`{"qty":12,"price":1.5,"ok":true,"note":null,"tags":["a"]}` + "\n"))
+
+			var d copier.Data
+			if err := p.Pull(&d); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould pull the record : %v", failed, testID, err)
+			}
+
+			want := map[string]copier.Value{
+				"qty":   copier.Int(12),
+				"price": copier.Float(1.5),
+				"ok":    copier.String("true"),
+				"note":  copier.Null(),
+				"tags":  copier.String(`["a"]`),
+			}
+			if reflect.DeepEqual(d.Fields, want) {
+				t.Logf("\t%s\tTest %d:\tShould decode each value.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould decode each value : %v", failed, testID, d.Fields)
+			}
+		}
+	}
+}
+
+// TestCursor validates the line based Pullers resume from a cursor.
+func TestCursor(t *testing.T) {
+	var jsonl, fixed bytes.Buffer
+	js, fs := file.NewJSONLStorer(&jsonl), file.NewFixedStorer(&fixed, layout)
+	for _, r := range records(10) {
+		js.Store(&copier.Data{Fields: r})
+		fs.Store(&copier.Data{Fields: r})
+	}
+	js.Flush()
+	fs.Flush()
+
+	tt := []struct {
+		name string
+		new  func() copier.CursorPuller
+	}{
+		{"jsonl", func() copier.CursorPuller { return file.NewJSONLPuller(bytes.NewReader(jsonl.Bytes())) }},
+		{"fixed", func() copier.CursorPuller { return file.NewFixedPuller(bytes.NewReader(fixed.Bytes()), layout) }},
+	}
+
+	t.Log("Given the need to resume reading an export.")
+	{
+		for testID, test := range tt {
+			t.Logf("\tTest %d:\tWhen seeking a %s file to the cursor after 4 records.", testID, test.name)
+			{
+				p := test.new()
+				var d copier.Data
+				for i := 0; i < 4; i++ {
+					p.Pull(&d)
+				}
+				cursor := p.Cursor()
+
+				p = test.new()
+				if err := p.Seek(cursor); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to seek : %v", failed, testID, err)
+				}
+
+				if err := p.Pull(&d); err == nil && d.Fields["id"].Str() == "000004" {
+					t.Logf("\t%s\tTest %d:\tShould pull the fifth record.", succeed, testID)
+				} else {
+					t.Errorf("\t%s\tTest %d:\tShould pull the fifth record : %v %v", failed, testID, d.Fields, err)
+				}
+			}
+		}
+	}
+}
+
+// TestTyped validates typed records survive a round trip through every
+// format once the schema converts the text back.
+func TestTyped(t *testing.T) {
+	schema := copier.Schema{Fields: []copier.Field{
+		{Name: "id", Kind: copier.KindInt, Required: true},
+		{Name: "price", Kind: copier.KindFloat},
+		{Name: "at", Kind: copier.KindTime},
+		{Name: "blob", Kind: copier.KindBytes},
+		{Name: "note", Kind: copier.KindString},
+	}}
+
+	wide := file.Layout{{Name: "id", Width: 4}, {Name: "price", Width: 8}, {Name: "at", Width: 30}, {Name: "blob", Width: 8}, {Name: "note", Width: 6}}
+
+	want := map[string]copier.Value{
+		"id":    copier.Int(42),
+		"price": copier.Float(9.75),
+		"at":    copier.Time(time.Date(2021, time.March, 5, 10, 0, 0, 0, time.UTC)),
+		"blob":  copier.Bytes([]byte{0, 1, 2}),
+		"note":  copier.String("hi"),
+	}
+
+	tt := []struct {
+		name      string
+		newPuller func(r io.Reader) copier.Puller
+		newStorer func(w io.Writer) flusher
+	}{
+		{"jsonl", func(r io.Reader) copier.Puller { return file.NewJSONLPuller(r) }, func(w io.Writer) flusher { return file.NewJSONLStorer(w) }},
+		{"csv", func(r io.Reader) copier.Puller { return file.NewCSVPuller(r) }, func(w io.Writer) flusher { return file.NewCSVStorer(w) }},
+		{"fixed", func(r io.Reader) copier.Puller { return file.NewFixedPuller(r, wide) }, func(w io.Writer) flusher { return file.NewFixedStorer(w, wide) }},
+	}
+
+	t.Log("Given the need to copy typed records through text files.")
+	{
+		for testID, test := range tt {
+			t.Logf("\tTest %d:\tWhen using the %s format.", testID, test.name)
+			{
+				var buf bytes.Buffer
+				s := test.newStorer(&buf)
+				if err := s.Store(&copier.Data{Fields: want}); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to store the record : %v", failed, testID, err)
+				}
+				s.Flush()
+
+				var d copier.Data
+				if err := schema.Puller(test.newPuller(&buf)).Pull(&d); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to pull the record : %v", failed, testID, err)
+				}
+
+				ok := len(d.Fields) == len(want)
+				for k, v := range want {
+					ok = ok && d.Fields[k].Equal(v)
+				}
+
+				if ok {
+					t.Logf("\t%s\tTest %d:\tShould pull back the same values.", succeed, testID)
+				} else {
+					t.Errorf("\t%s\tTest %d:\tShould pull back the same values : %v", failed, testID, d.Fields)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package file
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier"
+)
+
+// Column is a field of a fixed-width record.
+type Column struct {
+	Name  string
+	Width int
+}
+
+// Layout describes a fixed-width record as its columns in order.
+type Layout []Column
+
+// width returns the length of a record in characters.
+func (l Layout) width() int {
+	var n int
+	for _, c := range l {
+		n += c.Width
+	}
+
+	return n
+}
+
+// FixedPuller pulls fixed-width records the way the AS400 systems export
+// them, one per line with every column padded with spaces.
+type FixedPuller struct {
+	*lines
+	layout Layout
+}
+
+// NewFixedPuller constructs a Puller reading records with the specified
+// layout from r.
+func NewFixedPuller(r io.Reader, layout Layout) *FixedPuller {
+	return &FixedPuller{
+		lines:  newLines(r),
+		layout: layout,
+	}
+}
+
+// Pull implements the copier.Puller interface. Padding is trimmed from the
+// end of every value.
+func (p *FixedPuller) Pull(d *copier.Data) error {
+	line, err := p.next()
+	if err != nil {
+		return err
+	}
+
+	rs := []rune(line)
+	if len(rs) != p.layout.width() {
+		return p.errorf("%d characters, layout has %d", len(rs), p.layout.width())
+	}
+
+	fields := make(map[string]copier.Value, len(p.layout))
+	for _, c := range p.layout {
+		fields[c.Name] = copier.String(strings.TrimRight(string(rs[:c.Width]), " "))
+		rs = rs[c.Width:]
+	}
+
+	d.Line = line
+	d.Fields = fields
+	return nil
+}
+
+// =============================================================================
+
+// FixedStorer stores records as fixed-width lines.
+type FixedStorer struct {
+	w      *bufio.Writer
+	layout Layout
+}
+
+// NewFixedStorer constructs a Storer writing records with the specified
+// layout to w.
+func NewFixedStorer(w io.Writer, layout Layout) *FixedStorer {
+	return &FixedStorer{
+		w:      bufio.NewWriter(w),
+		layout: layout,
+	}
+}
+
+// Store implements the copier.Storer interface. A value too wide for its
+// column, or a field the layout doesn't have, is an error rather than being
+// cut.
+func (s *FixedStorer) Store(d *copier.Data) error {
+	fields := fields(d)
+
+	var b strings.Builder
+	var n int
+	for _, c := range s.layout {
+		fv, ok := fields[c.Name]
+		if ok {
+			n++
+		}
+		v := fv.String()
+
+		w := utf8.RuneCountInString(v)
+		if w > c.Width {
+			return fmt.Errorf("field %s: %q is wider than %d", c.Name, v, c.Width)
+		}
+		if strings.ContainsAny(v, "\r\n") {
+			return fmt.Errorf("field %s: %q has a line break", c.Name, v)
+		}
+
+		b.WriteString(v)
+		b.WriteString(strings.Repeat(" ", c.Width-w))
+	}
+
+	if n != len(fields) {
+		return fmt.Errorf("record has fields that are not in the layout")
+	}
+
+	b.WriteByte('\n')
+	_, err := s.w.WriteString(b.String())
+	return err
+}
+
+// Flush writes any buffered records to the output.
+func (s *FixedStorer) Flush() error {
+	return s.w.Flush()
+}
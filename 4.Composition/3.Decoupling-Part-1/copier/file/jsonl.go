@@ -0,0 +1,127 @@
+package file
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier"
+)
+
+// JSONLPuller pulls records from JSON Lines, one object per line. Strings,
+// numbers and nulls become values of the matching kind. Booleans, arrays
+// and objects become strings holding their JSON text.
+type JSONLPuller struct {
+	*lines
+}
+
+// NewJSONLPuller constructs a Puller reading JSON Lines from r.
+func NewJSONLPuller(r io.Reader) *JSONLPuller {
+	return &JSONLPuller{
+		lines: newLines(r),
+	}
+}
+
+// Pull implements the copier.Puller interface. Blank lines are skipped.
+func (p *JSONLPuller) Pull(d *copier.Data) error {
+	for {
+		line, err := p.next()
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(line), &obj); err != nil {
+			return p.errorf("%v", err)
+		}
+
+		fields := make(map[string]copier.Value, len(obj))
+		for k, v := range obj {
+			fields[k] = decode(v)
+		}
+
+		d.Line = line
+		d.Fields = fields
+		return nil
+	}
+}
+
+// decode returns the value of a JSON value.
+func decode(raw json.RawMessage) copier.Value {
+	switch raw[0] {
+	case 'n':
+		return copier.Null()
+
+	case '"':
+		var s string
+		json.Unmarshal(raw, &s)
+		return copier.String(s)
+
+	case '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		if i, err := strconv.ParseInt(string(raw), 10, 64); err == nil {
+			return copier.Int(i)
+		}
+		f, _ := strconv.ParseFloat(string(raw), 64)
+		return copier.Float(f)
+	}
+
+	return copier.String(string(raw))
+}
+
+// encode returns the JSON form of a value. Times are RFC 3339 strings and
+// bytes are base64 strings.
+func encode(v copier.Value) interface{} {
+	switch v.Kind() {
+	case copier.KindString:
+		return v.Str()
+	case copier.KindInt:
+		return v.Int()
+	case copier.KindFloat:
+		return v.Float()
+	case copier.KindTime, copier.KindBytes:
+		return v.String()
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+// JSONLStorer stores records as JSON Lines.
+type JSONLStorer struct {
+	w *bufio.Writer
+}
+
+// NewJSONLStorer constructs a Storer writing JSON Lines to w.
+func NewJSONLStorer(w io.Writer) *JSONLStorer {
+	return &JSONLStorer{
+		w: bufio.NewWriter(w),
+	}
+}
+
+// Store implements the copier.Storer interface.
+func (s *JSONLStorer) Store(d *copier.Data) error {
+	obj := make(map[string]interface{}, len(d.Fields))
+	for k, v := range fields(d) {
+		obj[k] = encode(v)
+	}
+
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+
+	b = append(b, '\n')
+	_, err = s.w.Write(b)
+	return err
+}
+
+// Flush writes any buffered records to the output.
+func (s *JSONLStorer) Flush() error {
+	return s.w.Flush()
+}
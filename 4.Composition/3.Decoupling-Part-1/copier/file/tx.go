@@ -0,0 +1,134 @@
+package file
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier"
+)
+
+// ErrNoTx is returned when a TxDir is used outside a transaction.
+var ErrNoTx = errors.New("no transaction in progress")
+
+// TxDir is a copier.TxStorer that keeps every batch in its own JSON Lines
+// file in a directory. A batch is written to a temporary file that is
+// synced and renamed into place on Commit, so a batch is either all there
+// or not there at all. The file is named after the batch id, so storing a
+// batch again replaces it rather than duplicating it.
+type TxDir struct {
+	dir string
+
+	f    *os.File
+	w    *JSONLStorer
+	name string
+}
+
+// NewTxDir constructs a TxDir storing batches in dir. The temporary files
+// of transactions cut short by a crash are removed.
+func NewTxDir(dir string) (*TxDir, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	tmps, err := filepath.Glob(filepath.Join(dir, "*.tmp"))
+	if err != nil {
+		return nil, err
+	}
+	for _, tmp := range tmps {
+		os.Remove(tmp)
+	}
+
+	return &TxDir{dir: dir}, nil
+}
+
+// Begin implements the copier.TxStorer interface.
+func (t *TxDir) Begin(batch string) error {
+	if t.f != nil {
+		return errors.New("transaction already in progress")
+	}
+
+	name := filepath.Join(t.dir, "batch-"+url.PathEscape(batch)+".jsonl")
+
+	f, err := os.Create(name + ".tmp")
+	if err != nil {
+		return err
+	}
+
+	t.f = f
+	t.w = NewJSONLStorer(f)
+	t.name = name
+	return nil
+}
+
+// Store implements the copier.Storer interface.
+func (t *TxDir) Store(d *copier.Data) error {
+	if t.f == nil {
+		return ErrNoTx
+	}
+
+	return t.w.Store(d)
+}
+
+// Commit implements the copier.TxStorer interface.
+func (t *TxDir) Commit() error {
+	if t.f == nil {
+		return ErrNoTx
+	}
+
+	err := t.w.Flush()
+	if err == nil {
+		err = t.f.Sync()
+	}
+	if cerr := t.f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(t.f.Name(), t.name)
+	}
+	if err == nil {
+		err = syncDir(t.dir)
+	}
+
+	if err != nil {
+		os.Remove(t.f.Name())
+	}
+	t.f = nil
+	return err
+}
+
+// Rollback implements the copier.TxStorer interface.
+func (t *TxDir) Rollback() error {
+	if t.f == nil {
+		return ErrNoTx
+	}
+
+	t.f.Close()
+	err := os.Remove(t.f.Name())
+	t.f = nil
+	return err
+}
+
+// Files returns the files of the committed batches, sorted by name.
+func (t *TxDir) Files() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(t.dir, "batch-*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// syncDir syncs a directory so the renames in it survive a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
@@ -0,0 +1,169 @@
+package file_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier"
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier/file"
+)
+
+var errInjected = errors.New("injected failure")
+
+// chaos is a TxDir that fails on purpose. It fails the store of a record
+// or the commit of a batch when the count reaches the number it was given.
+// A commit can also fail after the batch was committed, which is what a
+// crash before the checkpoint is written looks like.
+type chaos struct {
+	*file.TxDir
+	failStore  int
+	failCommit int
+	lostCommit int
+
+	stores  int
+	commits int
+}
+
+func (c *chaos) Store(d *copier.Data) error {
+	c.stores++
+	if c.stores == c.failStore {
+		return errInjected
+	}
+	return c.TxDir.Store(d)
+}
+
+func (c *chaos) Commit() error {
+	c.commits++
+	switch c.commits {
+	case c.failCommit:
+		c.TxDir.Rollback()
+		return errInjected
+	case c.lostCommit:
+		c.TxDir.Commit()
+		return errInjected
+	}
+	return c.TxDir.Commit()
+}
+
+// committed returns how many times each id was committed to dir.
+func committed(t *testing.T, dir string) map[string]int {
+	tx, _ := file.NewTxDir(dir)
+	files, err := tx.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := make(map[string]int)
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p := file.NewJSONLPuller(bytes.NewReader(b))
+		for {
+			var d copier.Data
+			if err := p.Pull(&d); err != nil {
+				break
+			}
+			ids[d.Fields["id"].Str()]++
+		}
+	}
+
+	return ids
+}
+
+// TestTxDirExactlyOnce validates a copy restarted after every kind of
+// failure stores every record exactly once.
+func TestTxDirExactlyOnce(t *testing.T) {
+	var src bytes.Buffer
+	js := file.NewJSONLStorer(&src)
+	for _, r := range records(100) {
+		js.Store(&copier.Data{Fields: r})
+	}
+	js.Flush()
+
+	// Each run fails in a different way until the last one finishes.
+	runs := []chaos{
+		{failStore: 15},
+		{failCommit: 2},
+		{lostCommit: 3},
+		{failStore: 7, lostCommit: 1},
+		{},
+	}
+
+	t.Log("Given the need to store every record exactly once.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a copy is restarted after failed stores, commits and lost commits.", testID)
+		{
+			dir := t.TempDir()
+			path := filepath.Join(dir, "copy.checkpoint")
+
+			for i, run := range runs {
+				tx, err := file.NewTxDir(filepath.Join(dir, "out"))
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould open the directory : %v", failed, testID, err)
+				}
+				cp, err := copier.NewCheckpoint(path)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould open the checkpoint : %v", failed, testID, err)
+				}
+
+				run.TxDir = tx
+				err = copier.CopyWithCheckpoint(file.NewJSONLPuller(bytes.NewReader(src.Bytes())), &run, 10, cp)
+
+				want := errInjected
+				if i == len(runs)-1 {
+					want = io.EOF
+				}
+				if !errors.Is(err, want) {
+					t.Fatalf("\t%s\tTest %d:\tShould end run %d with %v : %v", failed, testID, i, want, err)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould fail every run but the last.", succeed, testID)
+
+			ids := committed(t, filepath.Join(dir, "out"))
+
+			ok := len(ids) == 100
+			for i := 0; i < 100; i++ {
+				ok = ok && ids[fmt.Sprintf("%06d", i)] == 1
+			}
+			if ok {
+				t.Logf("\t%s\tTest %d:\tShould store each of the 100 records once.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould store each of the 100 records once : %d records %v", failed, testID, len(ids), ids)
+			}
+
+			tmps, _ := filepath.Glob(filepath.Join(dir, "out", "*.tmp"))
+			if len(tmps) == 0 {
+				t.Logf("\t%s\tTest %d:\tShould leave no temporary files.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould leave no temporary files : %v", failed, testID, tmps)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen a plain Copy fails halfway through a batch.", testID)
+		{
+			dir := t.TempDir()
+			tx, _ := file.NewTxDir(dir)
+
+			p := file.NewJSONLPuller(bytes.NewReader(src.Bytes()))
+			if err := copier.Copy(p, &chaos{TxDir: tx, failStore: 25}, 10); err != errInjected {
+				t.Fatalf("\t%s\tTest %d:\tShould fail : %v", failed, testID, err)
+			}
+
+			if ids := committed(t, dir); len(ids) == 20 {
+				t.Logf("\t%s\tTest %d:\tShould leave only the two whole batches.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould leave only the two whole batches : %d records", failed, testID, len(ids))
+			}
+		}
+	}
+}
@@ -0,0 +1,390 @@
+package copier
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Filter returns a Transformer that passes the records matching a filter
+// expression and rejects the rest. An expression compares fields with
+// literals and combines the comparisons:
+//
+//	status == "open" and (total >= 100 or vip != null)
+//	not region == 'EU'
+//
+// The operators are ==, !=, <, <=, >, >=, and, or and not. Literals are
+// quoted strings, numbers and null. A missing field is null, and null is
+// only equal to null. Strings are compared with numbers as numbers and
+// with times as RFC 3339 times, so text records can be filtered without a
+// schema.
+func Filter(expr string) (Transformer, error) {
+	p := parser{toks: tokenize(expr)}
+
+	n, err := p.or()
+	if err != nil {
+		return nil, fmt.Errorf("filter %q: %w", expr, err)
+	}
+	if tok := p.peek(); tok.kind != tokEnd {
+		return nil, fmt.Errorf("filter %q: unexpected %q", expr, tok.text)
+	}
+
+	return TransformFunc(func(d *Data) (bool, error) {
+		return n.eval(d), nil
+	}), nil
+}
+
+// MustFilter is like Filter but panics if the expression doesn't parse.
+func MustFilter(expr string) Transformer {
+	t, err := Filter(expr)
+	if err != nil {
+		panic(err)
+	}
+
+	return t
+}
+
+// =============================================================================
+
+type tokKind int
+
+const (
+	tokEnd tokKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+	tokLParen
+	tokRParen
+	tokBad
+)
+
+type token struct {
+	kind tokKind
+	text string
+}
+
+// tokenize splits an expression into tokens, ending with tokEnd.
+func tokenize(s string) []token {
+	var toks []token
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+
+		case c == '(':
+			toks = append(toks, token{tokLParen, "("})
+			i++
+
+		case c == ')':
+			toks = append(toks, token{tokRParen, ")"})
+			i++
+
+		case c == '"' || c == '\'':
+			j := i + 1
+			var b strings.Builder
+			for j < len(s) && s[j] != c {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				}
+				b.WriteByte(s[j])
+				j++
+			}
+			if j == len(s) {
+				return append(toks, token{tokBad, s[i:]})
+			}
+			toks = append(toks, token{tokString, b.String()})
+			i = j + 1
+
+		case strings.ContainsRune("=!<>", rune(c)):
+			j := i + 1
+			if j < len(s) && s[j] == '=' {
+				j++
+			}
+			toks = append(toks, token{tokOp, s[i:j]})
+			i = j
+
+		case c == '-' || c == '.' || unicode.IsDigit(rune(c)):
+			j := i + 1
+			for j < len(s) && (s[j] == '.' || s[j] == 'e' || s[j] == 'E' || unicode.IsDigit(rune(s[j])) ||
+				((s[j] == '-' || s[j] == '+') && (s[j-1] == 'e' || s[j-1] == 'E'))) {
+				j++
+			}
+			toks = append(toks, token{tokNumber, s[i:j]})
+			i = j
+
+		case c == '_' || unicode.IsLetter(rune(c)):
+			j := i + 1
+			for j < len(s) && (s[j] == '_' || s[j] == '.' || unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j]))) {
+				j++
+			}
+			toks = append(toks, token{tokIdent, s[i:j]})
+			i = j
+
+		default:
+			return append(toks, token{tokBad, string(c)})
+		}
+	}
+
+	return append(toks, token{tokEnd, ""})
+}
+
+// =============================================================================
+
+// node is a parsed expression.
+type node interface {
+	eval(d *Data) bool
+}
+
+type andNode struct{ l, r node }
+type orNode struct{ l, r node }
+type notNode struct{ n node }
+
+func (n andNode) eval(d *Data) bool { return n.l.eval(d) && n.r.eval(d) }
+func (n orNode) eval(d *Data) bool  { return n.l.eval(d) || n.r.eval(d) }
+func (n notNode) eval(d *Data) bool { return !n.n.eval(d) }
+
+// cmpNode compares a field with a literal.
+type cmpNode struct {
+	field string
+	op    string
+	lit   Value
+}
+
+func (n cmpNode) eval(d *Data) bool {
+	v := d.Fields[n.field]
+
+	if v.IsNull() || n.lit.IsNull() {
+		eq := v.IsNull() && n.lit.IsNull()
+		switch n.op {
+		case "==":
+			return eq
+		case "!=":
+			return !eq
+		}
+		return false
+	}
+
+	c, ok := compare(v, n.lit)
+	if !ok {
+		return n.op == "!="
+	}
+
+	switch n.op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	}
+	return c >= 0
+}
+
+// compare orders a field value against a literal. It reports false when
+// the two can't be compared.
+func compare(v, lit Value) (int, bool) {
+	switch {
+	case lit.Kind() == KindString && v.Kind() == KindTime:
+		t, err := time.Parse(time.RFC3339Nano, lit.Str())
+		if err != nil {
+			return 0, false
+		}
+		return cmpTime(v.Time(), t), true
+
+	case lit.Kind() == KindString:
+		if v.Kind() != KindString {
+			return 0, false
+		}
+		return strings.Compare(v.Str(), lit.Str()), true
+
+	case v.Kind() == KindInt && lit.Kind() == KindInt:
+		switch a, b := v.Int(), lit.Int(); {
+		case a < b:
+			return -1, true
+		case a > b:
+			return 1, true
+		}
+		return 0, true
+	}
+
+	// The literal is a number.
+	var f float64
+	switch v.Kind() {
+	case KindInt:
+		f = float64(v.Int())
+	case KindFloat:
+		f = v.Float()
+	case KindString:
+		var err error
+		if f, err = strconv.ParseFloat(v.Str(), 64); err != nil {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+
+	lf := lit.Float()
+	if lit.Kind() == KindInt {
+		lf = float64(lit.Int())
+	}
+	return cmpFloat(f, lf), true
+}
+
+func cmpFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func cmpTime(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+	return 0
+}
+
+// =============================================================================
+
+// parser is a recursive descent parser for filter expressions.
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.toks[p.pos]
+	if tok.kind != tokEnd {
+		p.pos++
+	}
+	return tok
+}
+
+// keyword reports whether the next token is the keyword and consumes it.
+func (p *parser) keyword(kw string) bool {
+	if tok := p.peek(); tok.kind == tokIdent && tok.text == kw {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) or() (node, error) {
+	l, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("or") {
+		r, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l = orNode{l, r}
+	}
+
+	return l, nil
+}
+
+func (p *parser) and() (node, error) {
+	l, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("and") {
+		r, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l = andNode{l, r}
+	}
+
+	return l, nil
+}
+
+func (p *parser) unary() (node, error) {
+	if p.keyword("not") {
+		n, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{n}, nil
+	}
+
+	if p.peek().kind == tokLParen {
+		p.next()
+		n, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if tok := p.next(); tok.kind != tokRParen {
+			return nil, fmt.Errorf("expected ) but found %q", tok.text)
+		}
+		return n, nil
+	}
+
+	return p.cmp()
+}
+
+func (p *parser) cmp() (node, error) {
+	field := p.next()
+	if field.kind != tokIdent {
+		return nil, fmt.Errorf("expected a field but found %q", field.text)
+	}
+
+	op := p.next()
+	switch op.text {
+	case "==", "!=", "<", "<=", ">", ">=":
+	default:
+		return nil, fmt.Errorf("expected an operator after %s but found %q", field.text, op.text)
+	}
+
+	var lit Value
+	tok := p.next()
+	switch {
+	case tok.kind == tokString:
+		lit = String(tok.text)
+
+	case tok.kind == tokNumber:
+		if i, err := strconv.ParseInt(tok.text, 10, 64); err == nil {
+			lit = Int(i)
+			break
+		}
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad number %q", tok.text)
+		}
+		lit = Float(f)
+
+	case tok.kind == tokIdent && tok.text == "null":
+		if op.text != "==" && op.text != "!=" {
+			return nil, fmt.Errorf("null can only be compared with == or !=")
+		}
+		lit = Null()
+
+	default:
+		return nil, fmt.Errorf("expected a literal after %s %s but found %q", field.text, op.text, tok.text)
+	}
+
+	return cmpNode{field: field.text, op: op.text, lit: lit}, nil
+}
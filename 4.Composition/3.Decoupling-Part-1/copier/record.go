@@ -0,0 +1,206 @@
+package copier
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Kind is the type of a value in a record.
+type Kind int
+
+// The kinds of value a record can hold.
+const (
+	KindNull Kind = iota
+	KindString
+	KindInt
+	KindFloat
+	KindTime
+	KindBytes
+)
+
+var kinds = [...]string{"null", "string", "int", "float", "time", "bytes"}
+
+// String returns the name of the kind.
+func (k Kind) String() string {
+	if k < 0 || int(k) >= len(kinds) {
+		return "kind(" + strconv.Itoa(int(k)) + ")"
+	}
+
+	return kinds[k]
+}
+
+// ParseKind returns the kind with the specified name.
+func ParseKind(name string) (Kind, error) {
+	for k, n := range kinds {
+		if n == name {
+			return Kind(k), nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown kind %q", name)
+}
+
+// Value is a single typed value in a record. The zero value is null.
+type Value struct {
+	kind Kind
+	s    string
+	i    int64
+	f    float64
+	t    time.Time
+	b    []byte
+}
+
+// Null returns a null value.
+func Null() Value {
+	return Value{}
+}
+
+// String returns a string value.
+func String(s string) Value {
+	return Value{kind: KindString, s: s}
+}
+
+// Int returns an integer value.
+func Int(i int64) Value {
+	return Value{kind: KindInt, i: i}
+}
+
+// Float returns a floating point value.
+func Float(f float64) Value {
+	return Value{kind: KindFloat, f: f}
+}
+
+// Time returns a time value.
+func Time(t time.Time) Value {
+	return Value{kind: KindTime, t: t}
+}
+
+// Bytes returns a binary value.
+func Bytes(b []byte) Value {
+	return Value{kind: KindBytes, b: b}
+}
+
+// Kind returns the kind of the value.
+func (v Value) Kind() Kind {
+	return v.kind
+}
+
+// IsNull reports whether the value is null.
+func (v Value) IsNull() bool {
+	return v.kind == KindNull
+}
+
+// Str returns the value of a string. It is empty for any other kind.
+func (v Value) Str() string {
+	return v.s
+}
+
+// Int returns the value of an integer. It is zero for any other kind.
+func (v Value) Int() int64 {
+	return v.i
+}
+
+// Float returns the value of a float. It is zero for any other kind.
+func (v Value) Float() float64 {
+	return v.f
+}
+
+// Time returns the value of a time. It is zero for any other kind.
+func (v Value) Time() time.Time {
+	return v.t
+}
+
+// Bytes returns the value of a binary value. It is nil for any other kind.
+func (v Value) Bytes() []byte {
+	return v.b
+}
+
+// Equal reports whether two values have the same kind and value.
+func (v Value) Equal(u Value) bool {
+	if v.kind != u.kind {
+		return false
+	}
+
+	switch v.kind {
+	case KindString:
+		return v.s == u.s
+	case KindInt:
+		return v.i == u.i
+	case KindFloat:
+		return v.f == u.f
+	case KindTime:
+		return v.t.Equal(u.t)
+	case KindBytes:
+		return bytes.Equal(v.b, u.b)
+	}
+
+	return true
+}
+
+// String returns the value as text, the form ParseValue reads back. Null
+// is empty, times are RFC 3339 and bytes are base64.
+func (v Value) String() string {
+	switch v.kind {
+	case KindString:
+		return v.s
+	case KindInt:
+		return strconv.FormatInt(v.i, 10)
+	case KindFloat:
+		return strconv.FormatFloat(v.f, 'g', -1, 64)
+	case KindTime:
+		return v.t.Format(time.RFC3339Nano)
+	case KindBytes:
+		return base64.StdEncoding.EncodeToString(v.b)
+	}
+
+	return ""
+}
+
+// ParseValue reads a value of the specified kind from its text form. Empty
+// text is null for every kind but string.
+func ParseValue(k Kind, s string) (Value, error) {
+	if s == "" && k != KindString {
+		return Null(), nil
+	}
+
+	switch k {
+	case KindNull:
+		return Value{}, fmt.Errorf("%q is not null", s)
+
+	case KindString:
+		return String(s), nil
+
+	case KindInt:
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return Value{}, fmt.Errorf("%q is not an int", s)
+		}
+		return Int(i), nil
+
+	case KindFloat:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return Value{}, fmt.Errorf("%q is not a float", s)
+		}
+		return Float(f), nil
+
+	case KindTime:
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return Value{}, fmt.Errorf("%q is not an RFC 3339 time", s)
+		}
+		return Time(t), nil
+
+	case KindBytes:
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return Value{}, fmt.Errorf("%q is not base64", s)
+		}
+		return Bytes(b), nil
+	}
+
+	return Value{}, fmt.Errorf("unknown kind %v", k)
+}
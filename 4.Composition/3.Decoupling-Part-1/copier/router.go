@@ -0,0 +1,169 @@
+package copier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoRoute is returned when a record matches none of the routes.
+var ErrNoRoute = errors.New("no route matches record")
+
+// Match decides if a record belongs on a route.
+type Match func(d *Data) bool
+
+// Prefix matches records whose line starts with s.
+func Prefix(s string) Match {
+	return func(d *Data) bool {
+		return strings.HasPrefix(d.Line, s)
+	}
+}
+
+// Contains matches records whose line contains s.
+func Contains(s string) Match {
+	return func(d *Data) bool {
+		return strings.Contains(d.Line, s)
+	}
+}
+
+// Route sends the records that match it to a Storer. A route with no Match
+// takes every record.
+type Route struct {
+	Name  string
+	Match Match
+	To    Storer
+}
+
+// RouteStats describes the traffic a route has seen.
+type RouteStats struct {
+	Name    string
+	Records int           // Records stored.
+	Errors  int           // Stores that failed.
+	Busy    time.Duration // Time spent storing.
+}
+
+// PerSecond returns the throughput of the route's Storer.
+func (rs RouteStats) PerSecond() float64 {
+	if rs.Busy <= 0 {
+		return 0
+	}
+
+	return float64(rs.Records) / rs.Busy.Seconds()
+}
+
+// route is a Route and its stats. The mutex serializes the stores, so the
+// Storers behind a router don't need to be safe for concurrent use.
+type route struct {
+	Route
+
+	mu    sync.Mutex
+	stats RouteStats
+}
+
+// store stores d on the route and keeps count.
+func (r *route) store(d *Data) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	start := time.Now()
+	err := r.To.Store(d)
+	r.stats.Busy += time.Since(start)
+
+	if err != nil {
+		r.stats.Errors++
+		return fmt.Errorf("route %s: %w", r.Name, err)
+	}
+	r.stats.Records++
+
+	return nil
+}
+
+// Router is a Storer that hands each record to every route that matches
+// it. Copying many Pullers into one Router is how data from several
+// systems is spread over several others.
+type Router struct {
+	routes []*route
+}
+
+// NewRouter constructs a router for the specified routes. Routes are
+// checked in the order they are given.
+func NewRouter(routes ...Route) *Router {
+	var r Router
+	for _, rt := range routes {
+		r.routes = append(r.routes, &route{Route: rt, stats: RouteStats{Name: rt.Name}})
+	}
+
+	return &r
+}
+
+// Store implements the Storer interface. It fails with ErrNoRoute when no
+// route matches and stops at the first route that fails to store.
+func (r *Router) Store(d *Data) error {
+	var matched bool
+
+	for _, rt := range r.routes {
+		if rt.Match != nil && !rt.Match(d) {
+			continue
+		}
+		matched = true
+
+		if err := rt.store(d); err != nil {
+			return err
+		}
+	}
+
+	if !matched {
+		return fmt.Errorf("%w: %q", ErrNoRoute, d.Line)
+	}
+
+	return nil
+}
+
+// Stats returns the stats of every route in the order they were given.
+func (r *Router) Stats() []RouteStats {
+	stats := make([]RouteStats, len(r.routes))
+	for i, rt := range r.routes {
+		rt.mu.Lock()
+		stats[i] = rt.stats
+		rt.mu.Unlock()
+	}
+
+	return stats
+}
+
+// Copy copies every Puller into the router at the same time. It returns
+// io.EOF when every Puller was drained and otherwise the first error, which
+// stops the other copies.
+func (r *Router) Copy(ctx context.Context, batch int, ps ...Puller) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make(chan error, len(ps))
+
+	for _, p := range ps {
+		go func(p Puller) {
+			err := CopyConcurrent(ctx, p, r, Options{Batch: batch})
+			if err != io.EOF {
+				cancel()
+			}
+			errs <- err
+		}(p)
+	}
+
+	// Prefer the error that caused the others to be canceled.
+	err := io.EOF
+	for range ps {
+		e := <-errs
+		switch {
+		case e == io.EOF:
+		case err == io.EOF || errors.Is(err, context.Canceled):
+			err = e
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,142 @@
+package copier_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier"
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier/standin"
+)
+
+// TestRouter validates records from several Pullers reach the Storers whose
+// rules they match and each route keeps count.
+func TestRouter(t *testing.T) {
+	t.Log("Given the need to move data off Xenia and Bob into Pillar and Alice.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen Bob's records go to Alice and everything goes to Pillar.", testID)
+		{
+			var pillar, alice sink
+			r := copier.NewRouter(
+				copier.Route{Name: "bob-alice", Match: copier.Prefix("bob "), To: &alice},
+				copier.Route{Name: "all-pillar", To: &pillar},
+			)
+
+			xenia := source{prefix: "xenia ", n: 40}
+			bob := source{prefix: "bob ", n: 25}
+
+			if err := r.Copy(context.Background(), 10, &xenia, &bob); err != io.EOF {
+				t.Fatalf("\t%s\tTest %d:\tShould drain every Puller : %v", failed, testID, err)
+			}
+
+			got := alice.sorted()
+			if len(got) == 25 && strings.HasPrefix(got[0], "bob ") && strings.HasPrefix(got[24], "bob ") {
+				t.Logf("\t%s\tTest %d:\tShould store only Bob's records in Alice.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould store only Bob's records in Alice : %d records", failed, testID, len(got))
+			}
+
+			if got := pillar.sorted(); len(got) == 65 {
+				t.Logf("\t%s\tTest %d:\tShould store every record in Pillar.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould store every record in Pillar : %d records", failed, testID, len(got))
+			}
+
+			stats := r.Stats()
+			if stats[0].Name == "bob-alice" && stats[0].Records == 25 && stats[1].Records == 65 && stats[1].Errors == 0 {
+				t.Logf("\t%s\tTest %d:\tShould count the records on each route.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould count the records on each route : %+v", failed, testID, stats)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen a route's Storer fails.", testID)
+		{
+			failing := sink{failAt: 5}
+			r := copier.NewRouter(copier.Route{Name: "pillar", To: &failing})
+
+			err := r.Copy(context.Background(), 10, &source{n: 100}, &source{n: 100})
+			if err != nil && err != io.EOF && !errors.Is(err, context.Canceled) {
+				t.Logf("\t%s\tTest %d:\tShould return the store error : %v", succeed, testID, err)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould return the store error : %v", failed, testID, err)
+			}
+
+			if st := r.Stats()[0]; st.Records == 5 && st.Errors >= 1 {
+				t.Logf("\t%s\tTest %d:\tShould count the error.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould count the error : %+v", failed, testID, st)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen a record matches no route.", testID)
+		{
+			var alice sink
+			r := copier.NewRouter(copier.Route{Name: "bob-alice", Match: copier.Contains("bob"), To: &alice})
+
+			if err := r.Store(&copier.Data{Line: "xenia 1"}); errors.Is(err, copier.ErrNoRoute) {
+				t.Logf("\t%s\tTest %d:\tShould return ErrNoRoute.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould return ErrNoRoute : %v", failed, testID, err)
+			}
+		}
+	}
+}
+
+// TestSystems validates the lesson's systems plug into the router.
+func TestSystems(t *testing.T) {
+	t.Log("Given the need to copy between the lesson's systems.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen copying Xenia and Bob into Pillar and Alice.", testID)
+		{
+			xenia := standin.NewSource("Xenia", standin.Records("Xenia", 30))
+			bob := standin.NewSource("Bob", standin.Records("Bob", 20))
+			pillar, alice := standin.NewSink("Pillar"), standin.NewSink("Alice")
+
+			var addrs []string
+			for _, s := range []interface {
+				Listen(addr string) (string, error)
+				Close() error
+			}{xenia, bob, pillar, alice} {
+				addr, err := s.Listen("localhost:0")
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to listen : %v", failed, testID, err)
+				}
+				defer s.Close()
+				addrs = append(addrs, addr)
+			}
+
+			r := copier.NewRouter(
+				copier.Route{Name: "xenia", Match: copier.Prefix("Xenia"), To: &copier.Pillar{Host: addrs[2], Timeout: time.Second}},
+				copier.Route{Name: "bob", Match: copier.Prefix("Bob"), To: &copier.Alice{Host: addrs[3], Timeout: time.Second}},
+			)
+
+			x := copier.Xenia{Host: addrs[0], Timeout: time.Second}
+			b := copier.Bob{Host: addrs[1], Timeout: time.Second}
+			if err := r.Copy(context.Background(), 3, &x, &b); err != io.EOF {
+				t.Fatalf("\t%s\tTest %d:\tShould copy to io.EOF : %v", failed, testID, err)
+			}
+
+			ok := len(pillar.Records()) == 30 && len(alice.Records()) == 20
+			for _, d := range pillar.Records() {
+				ok = ok && strings.HasPrefix(d.Line, "Xenia ")
+			}
+			for _, d := range alice.Records() {
+				ok = ok && strings.HasPrefix(d.Line, "Bob ")
+			}
+
+			if ok {
+				t.Logf("\t%s\tTest %d:\tShould route each system's records.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould route each system's records : %d %d", failed, testID, len(pillar.Records()), len(alice.Records()))
+			}
+		}
+	}
+}
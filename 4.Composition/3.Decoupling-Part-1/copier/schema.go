@@ -0,0 +1,163 @@
+package copier
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Field describes a field of a record.
+type Field struct {
+	Name     string
+	Kind     Kind
+	Required bool // A required field can't be missing or null.
+}
+
+// Schema describes the records a system hands out or accepts. Records may
+// only have the fields the schema lists.
+type Schema struct {
+	Fields []Field
+}
+
+// FieldError is the error for a record that doesn't match its schema. It
+// names the field and holds the offending value.
+type FieldError struct {
+	Field string
+	Value Value
+	Msg   string
+}
+
+// Error implements the error interface.
+func (fe *FieldError) Error() string {
+	return fmt.Sprintf("field %s: %s: value %q", fe.Field, fe.Msg, fe.Value.String())
+}
+
+// field returns the description of the named field.
+func (s Schema) field(name string) (Field, bool) {
+	for _, f := range s.Fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+
+	return Field{}, false
+}
+
+// Validate checks a record against the schema and returns a *FieldError
+// for the first field that doesn't match.
+func (s Schema) Validate(d *Data) error {
+	for _, f := range s.Fields {
+		v := d.Fields[f.Name]
+		switch {
+		case v.IsNull() && f.Required:
+			return &FieldError{Field: f.Name, Value: v, Msg: "required"}
+		case !v.IsNull() && v.Kind() != f.Kind:
+			return &FieldError{Field: f.Name, Value: v, Msg: fmt.Sprintf("%v is not %v", v.Kind(), f.Kind)}
+		}
+	}
+
+	// Report unknown fields in a stable order.
+	var unknown []string
+	for name := range d.Fields {
+		if _, ok := s.field(name); !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return &FieldError{Field: unknown[0], Value: d.Fields[unknown[0]], Msg: "not in schema"}
+	}
+
+	return nil
+}
+
+// Convert turns the string values of a record into the kinds the schema
+// says they are, for systems that only hand out text. Values that are
+// already the right kind are left alone.
+func (s Schema) Convert(d *Data) error {
+	for _, f := range s.Fields {
+		v, ok := d.Fields[f.Name]
+		if !ok || v.Kind() != KindString || f.Kind == KindString {
+			continue
+		}
+
+		nv, err := ParseValue(f.Kind, v.Str())
+		if err != nil {
+			return &FieldError{Field: f.Name, Value: v, Msg: err.Error()}
+		}
+		d.Fields[f.Name] = nv
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+// schemaPuller converts and validates every record it pulls.
+type schemaPuller struct {
+	schema Schema
+	p      Puller
+}
+
+// Pull implements the Puller interface.
+func (sp *schemaPuller) Pull(d *Data) error {
+	if err := sp.p.Pull(d); err != nil {
+		return err
+	}
+
+	if err := sp.schema.Convert(d); err != nil {
+		return err
+	}
+
+	return sp.schema.Validate(d)
+}
+
+// schemaCursorPuller is a schemaPuller over a CursorPuller, which knows the
+// position of the records it pulls.
+type schemaCursorPuller struct {
+	schemaPuller
+	cp CursorPuller
+}
+
+// Cursor implements the CursorPuller interface.
+func (sp *schemaCursorPuller) Cursor() string {
+	return sp.cp.Cursor()
+}
+
+// Seek implements the CursorPuller interface.
+func (sp *schemaCursorPuller) Seek(cursor string) error {
+	return sp.cp.Seek(cursor)
+}
+
+// Puller returns a Puller that hands out the records of p converted to the
+// schema, and fails with a *FieldError on the first record that doesn't
+// match it. It works with any system, so Copy never sees a bad record.
+// When p is a CursorPuller so is the Puller returned, so a source that is
+// validated can still be copied with a checkpoint.
+func (s Schema) Puller(p Puller) Puller {
+	sp := schemaPuller{schema: s, p: p}
+	if cp, ok := p.(CursorPuller); ok {
+		return &schemaCursorPuller{schemaPuller: sp, cp: cp}
+	}
+	return &sp
+}
+
+// schemaStorer validates every record before storing it.
+type schemaStorer struct {
+	schema Schema
+	s      Storer
+}
+
+// Store implements the Storer interface.
+func (ss *schemaStorer) Store(d *Data) error {
+	if err := ss.schema.Validate(d); err != nil {
+		return err
+	}
+
+	return ss.s.Store(d)
+}
+
+// Storer returns a Storer that refuses, with a *FieldError, any record that
+// doesn't match the schema before it reaches s.
+func (s Schema) Storer(st Storer) Storer {
+	return &schemaStorer{schema: s, s: st}
+}
@@ -0,0 +1,151 @@
+package copier_test
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier"
+)
+
+var orders = copier.Schema{Fields: []copier.Field{
+	{Name: "id", Kind: copier.KindInt, Required: true},
+	{Name: "total", Kind: copier.KindFloat},
+	{Name: "placed", Kind: copier.KindTime},
+}}
+
+// records is a Puller that hands out a fixed set of records.
+type records []map[string]copier.Value
+
+func (r *records) Pull(d *copier.Data) error {
+	if len(*r) == 0 {
+		return io.EOF
+	}
+
+	d.Fields = (*r)[0]
+	*r = (*r)[1:]
+	return nil
+}
+
+// TestValidate validates records that don't match the schema are reported
+// with the field and the value.
+func TestValidate(t *testing.T) {
+	tt := []struct {
+		name   string
+		fields map[string]copier.Value
+		field  string
+		value  string
+	}{
+		{"a valid record", map[string]copier.Value{"id": copier.Int(1), "total": copier.Float(2.5)}, "", ""},
+		{"a missing required field", map[string]copier.Value{"total": copier.Float(2.5)}, "id", ""},
+		{"a null required field", map[string]copier.Value{"id": copier.Null()}, "id", ""},
+		{"the wrong kind", map[string]copier.Value{"id": copier.String("seven")}, "id", "seven"},
+		{"an unknown field", map[string]copier.Value{"id": copier.Int(1), "color": copier.String("red")}, "color", "red"},
+	}
+
+	t.Log("Given the need to check records against a schema.")
+	{
+		for testID, test := range tt {
+			t.Logf("\tTest %d:\tWhen validating %s.", testID, test.name)
+			{
+				err := orders.Validate(&copier.Data{Fields: test.fields})
+
+				var fe *copier.FieldError
+				switch {
+				case test.field == "" && err == nil:
+					t.Logf("\t%s\tTest %d:\tShould accept the record.", succeed, testID)
+				case test.field != "" && errors.As(err, &fe) && fe.Field == test.field && fe.Value.String() == test.value:
+					t.Logf("\t%s\tTest %d:\tShould report field %s : %v", succeed, testID, test.field, err)
+				default:
+					t.Errorf("\t%s\tTest %d:\tShould report field %q : %v", failed, testID, test.field, err)
+				}
+			}
+		}
+	}
+}
+
+// TestSchemaPuller validates text records are converted at the Copy
+// boundary and the first bad record stops the copy.
+func TestSchemaPuller(t *testing.T) {
+	t.Log("Given the need to copy only records that match the schema.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the third record has a bad time.", testID)
+		{
+			src := records{
+				{"id": copier.String("1"), "total": copier.String("10.5"), "placed": copier.String("2021-03-05T10:00:00Z")},
+				{"id": copier.String("2"), "total": copier.String("")},
+				{"id": copier.String("3"), "placed": copier.String("yesterday")},
+				{"id": copier.String("4")},
+			}
+
+			var got []map[string]copier.Value
+			dst := storeFunc(func(d *copier.Data) error {
+				got = append(got, d.Fields)
+				return nil
+			})
+
+			err := copier.Copy(orders.Puller(&src), dst, 10)
+
+			var fe *copier.FieldError
+			if errors.As(err, &fe) && fe.Field == "placed" && fe.Value.Str() == "yesterday" {
+				t.Logf("\t%s\tTest %d:\tShould report the field and value : %v", succeed, testID, err)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould report the field and value : %v", failed, testID, err)
+			}
+
+			placed := time.Date(2021, time.March, 5, 10, 0, 0, 0, time.UTC)
+			if len(got) == 2 && got[0]["id"].Equal(copier.Int(1)) && got[0]["total"].Equal(copier.Float(10.5)) &&
+				got[0]["placed"].Equal(copier.Time(placed)) && got[1]["total"].IsNull() {
+				t.Logf("\t%s\tTest %d:\tShould store the converted records before it.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould store the converted records before it : %v", failed, testID, got)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen storing a record that doesn't match.", testID)
+		{
+			var stored int
+			dst := orders.Storer(storeFunc(func(d *copier.Data) error {
+				stored++
+				return nil
+			}))
+
+			err := dst.Store(&copier.Data{Fields: map[string]copier.Value{"id": copier.Float(1)}})
+			if err != nil && stored == 0 {
+				t.Logf("\t%s\tTest %d:\tShould refuse the record : %v", succeed, testID, err)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould refuse the record : %v", failed, testID, err)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen the source knows its position.", testID)
+		{
+			// The records of source have no fields, so any schema takes them.
+			p, ok := copier.Schema{}.Puller(&source{n: 25}).(copier.CursorPuller)
+			if !ok {
+				t.Fatalf("\t%s\tTest %d:\tShould know its position.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould know its position.", succeed, testID)
+
+			cp, _ := copier.NewCheckpoint(filepath.Join(t.TempDir(), "copy.checkpoint"))
+			var dst sink
+			if err := copier.CopyWithCheckpoint(p, &dst, 10, cp); err == io.EOF && cp.State().Records == 25 && cp.State().Cursor == "25" {
+				t.Logf("\t%s\tTest %d:\tShould copy with a checkpoint.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould copy with a checkpoint : %v %+v", failed, testID, err, cp.State())
+			}
+		}
+	}
+}
+
+// storeFunc adapts a function to the Storer interface.
+type storeFunc func(d *copier.Data) error
+
+func (f storeFunc) Store(d *copier.Data) error {
+	return f(d)
+}
@@ -0,0 +1,350 @@
+// Package standin provides servers that speak the wire protocol in place
+// of the real systems, so the copier can be run and tested end to end on a
+// single machine. Servers can be told to answer slowly and to drop
+// connections to see how the clients cope.
+package standin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier"
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier/wire"
+)
+
+// maxPull is the most records a Source sends in one batch.
+const maxPull = 1000
+
+// handler answers a request frame with a response frame.
+type handler func(typ byte, payload []byte) (byte, interface{}, error)
+
+// Server accepts connections and answers requests on them. Its faults can
+// be changed while it runs.
+type Server struct {
+	handle handler
+
+	mu        sync.Mutex
+	latency   time.Duration
+	dropEvery int
+	requests  int
+	ln        net.Listener
+	conns     map[net.Conn]struct{}
+	wg        sync.WaitGroup
+}
+
+// SetLatency delays the answer to every request by d.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.latency = d
+}
+
+// SetDropEvery makes the server handle every nth request and then close
+// the connection instead of answering, as if the network failed. Zero
+// turns it off.
+func (s *Server) SetDropEvery(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.dropEvery = n
+}
+
+// Requests returns the number of requests the server has handled.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests
+}
+
+// Listen starts serving on addr and returns the address it listens on,
+// which tells the port picked for an addr like "localhost:0".
+func (s *Server) Listen(addr string) (string, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	s.ln = ln
+	s.conns = make(map[net.Conn]struct{})
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			s.mu.Lock()
+			s.conns[conn] = struct{}{}
+			s.mu.Unlock()
+
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.serve(conn)
+			}()
+		}
+	}()
+
+	return ln.Addr().String(), nil
+}
+
+// serve answers the requests on a connection until it closes.
+func (s *Server) serve(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		typ, payload, err := wire.Read(conn)
+		if err != nil {
+			return
+		}
+
+		rtyp, resp, err := s.handle(typ, payload)
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.requests++
+		drop := s.dropEvery > 0 && s.requests%s.dropEvery == 0
+		latency := s.latency
+		s.mu.Unlock()
+
+		time.Sleep(latency)
+		if drop {
+			return
+		}
+
+		if err := wire.Write(conn, rtyp, resp); err != nil {
+			return
+		}
+	}
+}
+
+// Close stops the server and closes every connection.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	var err error
+	if s.ln != nil {
+		err = s.ln.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+// =============================================================================
+
+// Records returns n records the way an AS400 like Xenia or Bob hands them
+// out, named after the system.
+func Records(system string, n int) []copier.Data {
+	recs := make([]copier.Data, n)
+	for i := range recs {
+		recs[i] = copier.Data{
+			Line: fmt.Sprintf("%s %d", system, i),
+			Fields: map[string]copier.Value{
+				"id":     copier.Int(int64(i)),
+				"system": copier.String(system),
+			},
+		}
+	}
+
+	return recs
+}
+
+// Source is a server records can be pulled from, standing in for Xenia or
+// Bob. The cursor is the index of the next record.
+type Source struct {
+	Server
+
+	name    string
+	records []copier.Data
+	errAt   int
+}
+
+// NewSource constructs a source handing out the specified records.
+func NewSource(name string, records []copier.Data) *Source {
+	src := Source{
+		name:    name,
+		records: records,
+	}
+	src.handle = src.pull
+
+	return &src
+}
+
+// FailAt makes the source fail with a read error after handing out n
+// records, the way the lesson's Xenia could. Zero turns it off.
+func (src *Source) FailAt(n int) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+
+	src.errAt = n
+}
+
+// pull answers a Pull.
+func (src *Source) pull(typ byte, payload []byte) (byte, interface{}, error) {
+	var req wire.Pull
+	if err := decode(typ, wire.TypePull, payload, &req); err != nil {
+		return 0, nil, err
+	}
+
+	from := 0
+	if req.Cursor != "" {
+		n, err := strconv.Atoi(req.Cursor)
+		if err != nil || n < 0 || n > len(src.records) {
+			return wire.TypeBatch, wire.Batch{Cursor: req.Cursor, Error: fmt.Sprintf("bad cursor %q", req.Cursor)}, nil
+		}
+		from = n
+	}
+
+	max := req.Max
+	if max <= 0 || max > maxPull {
+		max = maxPull
+	}
+
+	src.mu.Lock()
+	end, errAt := len(src.records), src.errAt
+	src.mu.Unlock()
+
+	failing := errAt > 0 && errAt < end
+	if failing {
+		end = errAt
+
+		// A cursor past the failure fails right away.
+		if from > end {
+			end = from
+		}
+	}
+
+	to := from + max
+	if to > end {
+		to = end
+	}
+
+	b := wire.Batch{
+		Records: make([]wire.Record, 0, to-from),
+		Cursors: make([]string, 0, to-from),
+		Cursor:  strconv.Itoa(to),
+	}
+	for i := from; i < to; i++ {
+		b.Records = append(b.Records, copier.ToWire(&src.records[i]))
+		b.Cursors = append(b.Cursors, strconv.Itoa(i+1))
+	}
+
+	if to == end {
+		if failing {
+			b.Error = "error reading data from " + src.name
+		} else {
+			b.EOF = true
+		}
+	}
+
+	return wire.TypeBatch, b, nil
+}
+
+// =============================================================================
+
+// Sink is a server records can be stored in, standing in for Pillar or
+// Alice. It keeps what it stores in memory.
+type Sink struct {
+	Server
+
+	name    string
+	reject  func(d *copier.Data) error
+	records []copier.Data
+	batches map[string]bool
+}
+
+// NewSink constructs an empty sink.
+func NewSink(name string) *Sink {
+	snk := Sink{
+		name:    name,
+		batches: make(map[string]bool),
+	}
+	snk.handle = snk.store
+
+	return &snk
+}
+
+// Reject makes the sink refuse any batch holding a record fn returns an
+// error for. Nil turns it off.
+func (snk *Sink) Reject(fn func(d *copier.Data) error) {
+	snk.mu.Lock()
+	defer snk.mu.Unlock()
+
+	snk.reject = fn
+}
+
+// Records returns the records stored so far.
+func (snk *Sink) Records() []copier.Data {
+	snk.mu.Lock()
+	defer snk.mu.Unlock()
+
+	return append([]copier.Data(nil), snk.records...)
+}
+
+// store answers a Store. A batch is stored all or nothing, and only once.
+func (snk *Sink) store(typ byte, payload []byte) (byte, interface{}, error) {
+	var req wire.Store
+	if err := decode(typ, wire.TypeStore, payload, &req); err != nil {
+		return 0, nil, err
+	}
+
+	recs := make([]copier.Data, len(req.Records))
+	for i, r := range req.Records {
+		if err := copier.FromWire(r, &recs[i]); err != nil {
+			return wire.TypeAck, wire.Ack{Error: err.Error()}, nil
+		}
+	}
+
+	snk.mu.Lock()
+	defer snk.mu.Unlock()
+
+	if snk.batches[req.Batch] {
+		return wire.TypeAck, wire.Ack{Stored: len(recs)}, nil
+	}
+
+	if snk.reject != nil {
+		for i := range recs {
+			if err := snk.reject(&recs[i]); err != nil {
+				return wire.TypeAck, wire.Ack{Error: fmt.Sprintf("error writing data to %s: %v", snk.name, err)}, nil
+			}
+		}
+	}
+
+	snk.records = append(snk.records, recs...)
+	snk.batches[req.Batch] = true
+
+	return wire.TypeAck, wire.Ack{Stored: len(recs)}, nil
+}
+
+// decode checks a request is of the type expected and decodes it.
+func decode(got, want byte, payload []byte, msg interface{}) error {
+	if got != want {
+		return errors.New("unexpected frame type " + strconv.Itoa(int(got)))
+	}
+
+	return json.Unmarshal(payload, msg)
+}
@@ -0,0 +1,74 @@
+package copier
+
+import (
+	"time"
+)
+
+// The systems from the decoupling lesson. Each one is a client of a server
+// speaking the wire protocol at Host, and Timeout bounds every request
+// made to it. The standin package has servers to run in their place.
+
+// Xenia is a system we need to pull data from.
+type Xenia struct {
+	Host    string
+	Timeout time.Duration
+
+	puller
+}
+
+// Pull knows how to pull data out of Xenia.
+func (x *Xenia) Pull(d *Data) error {
+	return x.pull(x.Host, x.Timeout, d)
+}
+
+// Bob is another AS400 system we need to pull data from.
+type Bob struct {
+	Host    string
+	Timeout time.Duration
+
+	puller
+}
+
+// Pull knows how to pull data out of Bob.
+func (b *Bob) Pull(d *Data) error {
+	return b.pull(b.Host, b.Timeout, d)
+}
+
+// =============================================================================
+
+// Pillar is a system we need to store data into. It is a TxStorer, so Copy
+// sends it a whole batch at a time.
+type Pillar struct {
+	Host    string
+	Timeout time.Duration
+
+	storer
+}
+
+// Store knows how to store data into Pillar.
+func (p *Pillar) Store(d *Data) error {
+	return p.store(p.Host, p.Timeout, d)
+}
+
+// Commit sends the records stored since Begin to Pillar.
+func (p *Pillar) Commit() error {
+	return p.commit(p.Host, p.Timeout)
+}
+
+// Alice is another system we need to store data into.
+type Alice struct {
+	Host    string
+	Timeout time.Duration
+
+	storer
+}
+
+// Store knows how to store data into Alice.
+func (a *Alice) Store(d *Data) error {
+	return a.store(a.Host, a.Timeout, d)
+}
+
+// Commit sends the records stored since Begin to Alice.
+func (a *Alice) Commit() error {
+	return a.commit(a.Host, a.Timeout)
+}
@@ -0,0 +1,132 @@
+// Package tape records what a Puller hands out and plays it back. A
+// Recorder sits in front of a real Puller and writes the result of every
+// pull to a fixture, and a Player is a Puller that reproduces the session
+// from the fixture: the same records, the same errors and io.EOF on the
+// same pull. Tests that copy from a Player are deterministic, and an edge
+// case seen against a real system can be kept as a fixture.
+//
+// A fixture is JSON Lines with one line per pull. Errors other than io.EOF
+// are played back with the same message but not the same type.
+package tape
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier"
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier/wire"
+)
+
+// ErrEndOfTape is returned by a Player pulled more times than the session
+// it plays back was.
+var ErrEndOfTape = errors.New("end of tape")
+
+// pull is a line of a fixture: the result of a pull.
+type pull struct {
+	Record *wire.Record `json:"record,omitempty"`
+	Error  string       `json:"error,omitempty"`
+	EOF    bool         `json:"eof,omitempty"`
+}
+
+// =============================================================================
+
+// Recorder is a Puller that hands out what another Puller does and writes
+// the result of every pull to a fixture.
+type Recorder struct {
+	p   copier.Puller
+	enc *json.Encoder
+}
+
+// NewRecorder constructs a Recorder pulling from p and writing the
+// fixture to w.
+func NewRecorder(p copier.Puller, w io.Writer) *Recorder {
+	return &Recorder{
+		p:   p,
+		enc: json.NewEncoder(w),
+	}
+}
+
+// Pull implements the copier.Puller interface. If the fixture can't be
+// written, the error writing it is returned instead of the result.
+func (r *Recorder) Pull(d *copier.Data) error {
+	err := r.p.Pull(d)
+
+	var line pull
+	switch {
+	case err == io.EOF:
+		line.EOF = true
+	case err != nil:
+		line.Error = err.Error()
+	default:
+		rec := copier.ToWire(d)
+		line.Record = &rec
+	}
+
+	if werr := r.enc.Encode(line); werr != nil {
+		return fmt.Errorf("record fixture: %w", werr)
+	}
+
+	return err
+}
+
+// =============================================================================
+
+// Player is a Puller that plays back a recorded session.
+type Player struct {
+	pulls []pull
+	next  int
+}
+
+// NewPlayer constructs a Player for the fixture read from r.
+func NewPlayer(r io.Reader) (*Player, error) {
+	var pl Player
+
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, wire.MaxFrame)
+	for n := 1; s.Scan(); n++ {
+		var line pull
+		if err := json.Unmarshal(s.Bytes(), &line); err != nil {
+			return nil, fmt.Errorf("fixture line %d: %w", n, err)
+		}
+		if line.Record == nil && line.Error == "" && !line.EOF {
+			return nil, fmt.Errorf("fixture line %d: no record, error or eof", n)
+		}
+		pl.pulls = append(pl.pulls, line)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return &pl, nil
+}
+
+// Pull implements the copier.Puller interface. Once the session played
+// back reached io.EOF every pull after it does too, as with a real Puller.
+func (pl *Player) Pull(d *copier.Data) error {
+	if pl.next == len(pl.pulls) {
+		if n := len(pl.pulls); n > 0 && pl.pulls[n-1].EOF {
+			return io.EOF
+		}
+		return ErrEndOfTape
+	}
+
+	line := pl.pulls[pl.next]
+	pl.next++
+
+	switch {
+	case line.EOF:
+		return io.EOF
+	case line.Error != "":
+		return errors.New(line.Error)
+	}
+
+	return copier.FromWire(*line.Record, d)
+}
+
+// Remaining returns the number of recorded pulls not played back yet.
+func (pl *Player) Remaining() int {
+	return len(pl.pulls) - pl.next
+}
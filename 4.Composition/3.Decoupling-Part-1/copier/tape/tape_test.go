@@ -0,0 +1,193 @@
+package tape_test
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier"
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier/copiertest"
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier/standin"
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier/tape"
+)
+
+const succeed = "\u2713"
+const failed = "\u2717"
+
+var update = flag.Bool("update", false, "record the fixtures in testdata again")
+
+// result is what a pull returned.
+type result struct {
+	d   copier.Data
+	err error
+}
+
+// drain pulls n times and keeps every result.
+func drain(p copier.Puller, n int) []result {
+	rs := make([]result, n)
+	for i := range rs {
+		rs[i].err = p.Pull(&rs[i].d)
+	}
+	return rs
+}
+
+// xenia starts a stand-in Xenia handing out n records and failing after
+// failAt of them.
+func xenia(t *testing.T, n, failAt int) *copier.Xenia {
+	src := standin.NewSource("Xenia", standin.Records("Xenia", n))
+	src.FailAt(failAt)
+
+	addr, err := src.Listen("localhost:0")
+	if err != nil {
+		t.Fatalf("Should be able to listen : %v", err)
+	}
+	t.Cleanup(func() { src.Close() })
+
+	x := copier.Xenia{Host: addr, Timeout: time.Second}
+	t.Cleanup(func() { x.Close() })
+
+	return &x
+}
+
+// TestRecordPlay validates a Player reproduces every pull of a recorded
+// session.
+func TestRecordPlay(t *testing.T) {
+	t.Log("Given the need to play back a Puller session.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen Xenia fails partway through.", testID)
+		{
+			var buf bytes.Buffer
+			live := drain(tape.NewRecorder(xenia(t, 10, 7), &buf), 9)
+
+			pl, err := tape.NewPlayer(&buf)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould load the fixture : %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould load the fixture.", succeed, testID)
+
+			played := drain(pl, 9)
+			for i := range live {
+				l, p := live[i], played[i]
+
+				ok := (l.err == nil) == (p.err == nil)
+				if ok && l.err != nil {
+					ok = l.err.Error() == p.err.Error()
+				}
+				if ok && l.err == nil {
+					ok = l.d.Line == p.d.Line && copiertest.Equal(&l.d, &p.d)
+				}
+				if !ok {
+					t.Fatalf("\t%s\tTest %d:\tShould play back pull %d : got %+v %v, want %+v %v", failed, testID, i, p.d, p.err, l.d, l.err)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould play back every pull.", succeed, testID)
+
+			var d copier.Data
+			if err := pl.Pull(&d); err == tape.ErrEndOfTape {
+				t.Logf("\t%s\tTest %d:\tShould say when pulled past the recording.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould say when pulled past the recording : %v", failed, testID, err)
+			}
+		}
+	}
+}
+
+// TestFixture validates Copy against a session recorded from Xenia, which
+// failed after handing out 10 of its records. Run with -update to record
+// it again.
+func TestFixture(t *testing.T) {
+	path := filepath.Join("testdata", "xenia-fail.jsonl")
+
+	if *update {
+		var buf bytes.Buffer
+		drain(tape.NewRecorder(xenia(t, 12, 10), &buf), 11)
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			t.Fatalf("Should be able to write the fixture : %v", err)
+		}
+	}
+
+	t.Log("Given the need to copy from a recorded session.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the session ends in a read error.", testID)
+		{
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould open the fixture : %v", failed, testID, err)
+			}
+			defer f.Close()
+
+			pl, err := tape.NewPlayer(f)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould load the fixture : %v", failed, testID, err)
+			}
+
+			var stored []copier.Data
+			s := storeFunc(func(d *copier.Data) error {
+				stored = append(stored, *d)
+				return nil
+			})
+
+			err = copier.Copy(pl, s, 4)
+			if err != nil && err.Error() == "error reading data from Xenia" {
+				t.Logf("\t%s\tTest %d:\tShould return the recorded error.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould return the recorded error : %v", failed, testID, err)
+			}
+
+			if len(stored) == 10 && stored[9].Line == "Xenia 9" {
+				t.Logf("\t%s\tTest %d:\tShould store the records before the error.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould store the records before the error : %d", failed, testID, len(stored))
+			}
+		}
+	}
+}
+
+// TestPlayerContract runs the Puller battery against Players of recorded
+// sessions.
+func TestPlayerContract(t *testing.T) {
+	copiertest.TestPuller(t, func(t *testing.T, records []copier.Data) copiertest.Source {
+		var buf bytes.Buffer
+		r := tape.NewRecorder(&slice{records: records}, &buf)
+		for {
+			var d copier.Data
+			if err := r.Pull(&d); err == io.EOF {
+				break
+			}
+		}
+
+		pl, err := tape.NewPlayer(&buf)
+		if err != nil {
+			t.Fatalf("Should load the fixture : %v", err)
+		}
+		return copiertest.Source{Puller: pl}
+	})
+}
+
+// slice hands out records.
+type slice struct {
+	records []copier.Data
+}
+
+func (s *slice) Pull(d *copier.Data) error {
+	if len(s.records) == 0 {
+		return io.EOF
+	}
+
+	*d = s.records[0]
+	s.records = s.records[1:]
+	return nil
+}
+
+// storeFunc adapts a function to the copier.Storer interface.
+type storeFunc func(d *copier.Data) error
+
+func (f storeFunc) Store(d *copier.Data) error {
+	return f(d)
+}
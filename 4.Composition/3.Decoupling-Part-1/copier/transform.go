@@ -0,0 +1,255 @@
+package copier
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Transformer declares behavior for changing records between the pull and
+// the store. Transform returns false to reject the record, which drops it
+// from the copy.
+type Transformer interface {
+	Transform(d *Data) (bool, error)
+}
+
+// TransformFunc adapts a function to the Transformer interface.
+type TransformFunc func(d *Data) (bool, error)
+
+// Transform implements the Transformer interface.
+func (f TransformFunc) Transform(d *Data) (bool, error) {
+	return f(d)
+}
+
+// Stage names a Transformer in a chain.
+type Stage struct {
+	Name string
+	Transformer
+}
+
+// StageStats describes the records a stage has seen.
+type StageStats struct {
+	Name     string
+	In       int // Records handed to the stage.
+	Out      int // Records the stage passed on.
+	Rejected int // Records the stage dropped.
+	Errors   int // Records the stage failed on.
+}
+
+// stage is a Stage and its stats.
+type stage struct {
+	Stage
+
+	mu    sync.Mutex
+	stats StageStats
+}
+
+// Chain runs records through stages in order and counts what each stage
+// does with them. A record rejected by a stage doesn't reach the stages
+// after it. A chain is safe for concurrent use when its stages are.
+type Chain struct {
+	stages []*stage
+}
+
+// NewChain constructs a chain of the specified stages.
+func NewChain(stages ...Stage) *Chain {
+	var c Chain
+	for _, s := range stages {
+		c.stages = append(c.stages, &stage{Stage: s, stats: StageStats{Name: s.Name}})
+	}
+
+	return &c
+}
+
+// Transform implements the Transformer interface, so chains can be nested.
+func (c *Chain) Transform(d *Data) (bool, error) {
+	for _, s := range c.stages {
+		ok, err := s.Transform(d)
+
+		s.mu.Lock()
+		s.stats.In++
+		switch {
+		case err != nil:
+			s.stats.Errors++
+		case ok:
+			s.stats.Out++
+		default:
+			s.stats.Rejected++
+		}
+		s.mu.Unlock()
+
+		if err != nil {
+			return false, fmt.Errorf("stage %s: %w", s.Name, err)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// Stats returns the stats of every stage in order.
+func (c *Chain) Stats() []StageStats {
+	stats := make([]StageStats, len(c.stages))
+	for i, s := range c.stages {
+		s.mu.Lock()
+		stats[i] = s.stats
+		s.mu.Unlock()
+	}
+
+	return stats
+}
+
+// =============================================================================
+
+// transformPuller hands out the records of a Puller that pass a Transformer.
+type transformPuller struct {
+	t Transformer
+	p Puller
+}
+
+// Pull implements the Puller interface.
+func (tp *transformPuller) Pull(d *Data) error {
+	for {
+		if err := tp.p.Pull(d); err != nil {
+			return err
+		}
+
+		ok, err := tp.t.Transform(d)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+	}
+}
+
+// TransformPuller returns a Puller that runs the records of p through t
+// and skips the ones it rejects. With CopyConcurrent, the transform runs in
+// the goroutine that pulls.
+func TransformPuller(t Transformer, p Puller) Puller {
+	return &transformPuller{t: t, p: p}
+}
+
+// transformStorer stores the records that pass a Transformer.
+type transformStorer struct {
+	t Transformer
+	s Storer
+}
+
+// Store implements the Storer interface.
+func (ts *transformStorer) Store(d *Data) error {
+	ok, err := ts.t.Transform(d)
+	if err != nil || !ok {
+		return err
+	}
+
+	return ts.s.Store(d)
+}
+
+// TransformStorer returns a Storer that runs records through t before
+// storing them in s and skips the ones it rejects. With CopyConcurrent, the
+// transform runs in the store goroutines, so t must be safe for concurrent
+// use.
+func TransformStorer(t Transformer, s Storer) Storer {
+	return &transformStorer{t: t, s: s}
+}
+
+// =============================================================================
+
+// fields returns the fields of d, creating them if needed.
+func (d *Data) fields() map[string]Value {
+	if d.Fields == nil {
+		d.Fields = make(map[string]Value)
+	}
+
+	return d.Fields
+}
+
+// Rename moves a field to a new name.
+func Rename(from, to string) Transformer {
+	return TransformFunc(func(d *Data) (bool, error) {
+		if v, ok := d.Fields[from]; ok {
+			delete(d.Fields, from)
+			d.fields()[to] = v
+		}
+		return true, nil
+	})
+}
+
+// Default sets a field that is missing or null.
+func Default(field string, v Value) Transformer {
+	return TransformFunc(func(d *Data) (bool, error) {
+		if d.Fields[field].IsNull() {
+			d.fields()[field] = v
+		}
+		return true, nil
+	})
+}
+
+// Drop removes fields from the record.
+func Drop(fields ...string) Transformer {
+	return TransformFunc(func(d *Data) (bool, error) {
+		for _, f := range fields {
+			delete(d.Fields, f)
+		}
+		return true, nil
+	})
+}
+
+// MapField replaces the value of a field with what fn returns for it.
+func MapField(field string, fn func(v Value) (Value, error)) Transformer {
+	return TransformFunc(func(d *Data) (bool, error) {
+		v, err := fn(d.Fields[field])
+		if err != nil {
+			return false, &FieldError{Field: field, Value: d.Fields[field], Msg: err.Error()}
+		}
+		d.fields()[field] = v
+		return true, nil
+	})
+}
+
+// dedup remembers the keys of the records it has seen.
+type dedup struct {
+	fields []string
+
+	mu   sync.Mutex
+	seen map[string]struct{}
+}
+
+// Transform implements the Transformer interface.
+func (dd *dedup) Transform(d *Data) (bool, error) {
+	var b strings.Builder
+	if len(dd.fields) == 0 {
+		b.WriteString(d.Line)
+	}
+	for _, f := range dd.fields {
+		v := d.Fields[f]
+		fmt.Fprintf(&b, "%d:%d:%s", v.Kind(), len(v.String()), v.String())
+	}
+	key := b.String()
+
+	dd.mu.Lock()
+	defer dd.mu.Unlock()
+
+	if _, ok := dd.seen[key]; ok {
+		return false, nil
+	}
+	dd.seen[key] = struct{}{}
+
+	return true, nil
+}
+
+// Dedup rejects records whose key fields match a record it passed before.
+// With no fields, the whole line is the key. Every key is kept in memory.
+// Dedup keeps the first record of a key it sees, so behind a
+// TransformStorer with more than one store it keeps an arbitrary one of
+// the duplicates. Put it in a TransformPuller to keep the first pulled.
+func Dedup(fields ...string) Transformer {
+	return &dedup{
+		fields: fields,
+		seen:   make(map[string]struct{}),
+	}
+}
@@ -0,0 +1,214 @@
+package copier_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier"
+)
+
+// orderSource hands out n orders, every id twice, with every third order
+// missing its region.
+func orderSource(n int) *records {
+	var src records
+	for i := 0; i < n; i++ {
+		f := map[string]copier.Value{
+			"order_id": copier.String(fmt.Sprint(i / 2)),
+			"total":    copier.String(fmt.Sprint(i * 10)),
+		}
+		if i%3 != 0 {
+			f["region"] = copier.String("EU")
+		}
+		src = append(src, f)
+	}
+	return &src
+}
+
+// newOrderChain returns the chain the transform tests run orders through.
+func newOrderChain() *copier.Chain {
+	return copier.NewChain(
+		copier.Stage{Name: "rename", Transformer: copier.Rename("order_id", "id")},
+		copier.Stage{Name: "default", Transformer: copier.Default("region", copier.String("US"))},
+		copier.Stage{Name: "dedup", Transformer: copier.Dedup("id")},
+		copier.Stage{Name: "filter", Transformer: copier.MustFilter(`total >= 100 and region == "EU"`)},
+	)
+}
+
+// fieldSink is a Storer that keeps the fields of what it stores.
+type fieldSink struct {
+	mu     sync.Mutex
+	fields []map[string]copier.Value
+}
+
+func (s *fieldSink) Store(d *copier.Data) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.fields = append(s.fields, d.Fields)
+	return nil
+}
+
+// TestChain validates a chain of stages reshapes and drops records the same
+// way in front of Copy and behind CopyConcurrent.
+func TestChain(t *testing.T) {
+	// Of 40 orders, 20 are unique. Of those, ids 5 to 19 have a total of
+	// at least 100, and 5 of them had no region so they default to US and
+	// are filtered out.
+	want := []copier.StageStats{
+		{Name: "rename", In: 40, Out: 40},
+		{Name: "default", In: 40, Out: 40},
+		{Name: "dedup", In: 40, Out: 20, Rejected: 20},
+		{Name: "filter", In: 20, Out: 10, Rejected: 10},
+	}
+
+	// Behind CopyConcurrent the batches reach the chain in any order, so
+	// which copy of an id Dedup keeps changes from run to run and with it
+	// what the filter lets through. Only the counts up to Dedup are fixed.
+	copies := []struct {
+		name  string
+		run   func(c *copier.Chain, dst *fieldSink) error
+		exact bool
+	}{
+		{"Copy with a transforming Puller", func(c *copier.Chain, dst *fieldSink) error {
+			return copier.Copy(copier.TransformPuller(c, orderSource(40)), dst, 7)
+		}, true},
+		{"CopyConcurrent with a transforming Storer", func(c *copier.Chain, dst *fieldSink) error {
+			opts := copier.Options{Batch: 7, Stores: 4}
+			return copier.CopyConcurrent(context.Background(), orderSource(40), copier.TransformStorer(c, dst), opts)
+		}, false},
+	}
+
+	t.Log("Given the need to reshape records between the pull and the store.")
+	{
+		for testID, test := range copies {
+			t.Logf("\tTest %d:\tWhen using %s.", testID, test.name)
+			{
+				c := newOrderChain()
+				var dst fieldSink
+
+				if err := test.run(c, &dst); err != io.EOF {
+					t.Fatalf("\t%s\tTest %d:\tShould copy to io.EOF : %v", failed, testID, err)
+				}
+
+				ok := !test.exact || len(dst.fields) == 10
+				seen := make(map[string]bool)
+				for _, f := range dst.fields {
+					_, old := f["order_id"]
+					id := f["id"].String()
+					ok = ok && !old && !f["id"].IsNull() && !seen[id] && f["region"].Str() == "EU"
+					seen[id] = true
+				}
+				if ok {
+					t.Logf("\t%s\tTest %d:\tShould store the renamed and filtered records once.", succeed, testID)
+				} else {
+					t.Errorf("\t%s\tTest %d:\tShould store the renamed and filtered records once : %v", failed, testID, dst.fields)
+				}
+
+				got := c.Stats()
+				filter := got[len(got)-1]
+				ok = fmt.Sprint(got[:3]) == fmt.Sprint(want[:3]) && filter.In == 20 && filter.Out+filter.Rejected == 20 && filter.Out == len(dst.fields)
+				if test.exact {
+					ok = fmt.Sprint(got) == fmt.Sprint(want)
+				}
+				if ok {
+					t.Logf("\t%s\tTest %d:\tShould count each stage.", succeed, testID)
+				} else {
+					t.Errorf("\t%s\tTest %d:\tShould count each stage : %+v", failed, testID, got)
+				}
+			}
+		}
+
+		testID := len(copies)
+		t.Logf("\tTest %d:\tWhen a stage fails.", testID)
+		{
+			c := copier.NewChain(copier.Stage{Name: "upper", Transformer: copier.MapField("total", func(v copier.Value) (copier.Value, error) {
+				if v.Str() == "30" {
+					return v, fmt.Errorf("can't map")
+				}
+				return copier.String(strings.ToUpper(v.Str())), nil
+			})})
+
+			var dst fieldSink
+			err := copier.Copy(copier.TransformPuller(c, orderSource(40)), &dst, 10)
+
+			if err != nil && strings.Contains(err.Error(), "stage upper: field total") && len(dst.fields) == 3 {
+				t.Logf("\t%s\tTest %d:\tShould stop with the stage and field : %v", succeed, testID, err)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould stop with the stage and field : %v", failed, testID, err)
+			}
+
+			if st := c.Stats()[0]; st.In == 4 && st.Out == 3 && st.Errors == 1 {
+				t.Logf("\t%s\tTest %d:\tShould count the error.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould count the error : %+v", failed, testID, st)
+			}
+		}
+	}
+}
+
+// TestFilter validates filter expressions.
+func TestFilter(t *testing.T) {
+	d := copier.Data{Fields: map[string]copier.Value{
+		"status": copier.String("open"),
+		"total":  copier.Float(120.5),
+		"qty":    copier.Int(3),
+		"text":   copier.String("42"),
+		"placed": copier.Time(time.Date(2021, time.March, 5, 10, 0, 0, 0, time.UTC)),
+	}}
+
+	tt := []struct {
+		expr string
+		want bool
+	}{
+		{`status == "open"`, true},
+		{`status != 'open'`, false},
+		{`total > 100 and qty <= 3`, true},
+		{`total < 100 or qty == 3`, true},
+		{`not (total < 100 or qty == 3)`, false},
+		{`text >= 40`, true},
+		{`placed < "2021-03-06T00:00:00Z"`, true},
+		{`vip == null`, true},
+		{`vip != null or status == "closed"`, false},
+		{`vip > 1`, false},
+		{`status > 1`, false},
+		{`qty == -3e0`, false},
+	}
+
+	bad := []string{``, `status ==`, `status = "open"`, `(qty == 3`, `qty == 3 extra`, `qty < null`, `"open" == status`, `status == "open`}
+
+	t.Log("Given the need to filter records with an expression.")
+	{
+		for testID, test := range tt {
+			t.Logf("\tTest %d:\tWhen evaluating %s.", testID, test.expr)
+			{
+				f, err := copier.Filter(test.expr)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould parse : %v", failed, testID, err)
+				}
+
+				if got, _ := f.Transform(&d); got == test.want {
+					t.Logf("\t%s\tTest %d:\tShould be %v.", succeed, testID, test.want)
+				} else {
+					t.Errorf("\t%s\tTest %d:\tShould be %v.", failed, testID, test.want)
+				}
+			}
+		}
+
+		for i, expr := range bad {
+			testID := len(tt) + i
+			t.Logf("\tTest %d:\tWhen parsing %s.", testID, expr)
+			{
+				if _, err := copier.Filter(expr); err != nil {
+					t.Logf("\t%s\tTest %d:\tShould return an error : %v", succeed, testID, err)
+				} else {
+					t.Errorf("\t%s\tTest %d:\tShould return an error.", failed, testID)
+				}
+			}
+		}
+	}
+}
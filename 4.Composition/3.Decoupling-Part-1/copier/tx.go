@@ -0,0 +1,64 @@
+package copier
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+// TxStorer is a Storer that can make a batch visible all at once. When the
+// Storer handed to a copy is also a TxStorer, the copy finds out with a
+// type assertion and wraps every batch in Begin and Commit, or Rollback if
+// a record fails, so a failed batch leaves nothing behind.
+//
+// Begin is given an id for the batch, made of an id for the copy and the
+// position of the batch in it, so two copies into the same system never
+// share a batch id. Copy and CopyConcurrent pick a new id for every copy
+// and number the batches. CopyWithCheckpoint keeps the id of the copy in
+// the checkpoint and uses the cursor the batch starts at, so a batch stored
+// again after a crash gets the same id and a TxStorer can use it to replace
+// what it committed the first time instead of duplicating it.
+type TxStorer interface {
+	Storer
+	Begin(batch string) error
+	Commit() error
+	Rollback() error
+}
+
+// storeBatch stores a batch, as a transaction if the Storer supports them.
+func storeBatch(s Storer, id string, data []Data) (int, error) {
+	tx, ok := s.(TxStorer)
+	if !ok {
+		return store(s, data)
+	}
+
+	if err := tx.Begin(id); err != nil {
+		return 0, err
+	}
+
+	if _, err := store(tx, data); err != nil {
+		if rerr := tx.Rollback(); rerr != nil {
+			return 0, fmt.Errorf("%w (rollback: %v)", err, rerr)
+		}
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+// newRun returns a random id for a copy.
+func newRun() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// batchID returns the id of the batch of the copy run at pos, the number
+// of the batch or the cursor it starts at.
+func batchID(run string, pos string) string {
+	return run + "-" + pos
+}
@@ -0,0 +1,207 @@
+package verify
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sort"
+)
+
+// entry is what is kept of a record to compare it: the key it is matched
+// on and the checksum of the record.
+type entry struct {
+	key  string
+	hash [32]byte
+}
+
+// less orders entries by key and then by checksum.
+func less(a, b entry) bool {
+	if a.key != b.key {
+		return a.key < b.key
+	}
+	return string(a.hash[:]) < string(b.hash[:])
+}
+
+// iterator hands out entries in order.
+type iterator interface {
+	next() (entry, bool, error)
+}
+
+// =============================================================================
+
+// sorter sorts entries with bounded memory. Once it holds max entries it
+// sorts them and spills them to a run file. The runs are merged back in
+// order at the end.
+type sorter struct {
+	dir     string
+	max     int
+	entries []entry
+	runs    []*os.File
+}
+
+// add adds an entry, spilling a run if memory is full.
+func (s *sorter) add(e entry) error {
+	s.entries = append(s.entries, e)
+	if len(s.entries) < s.max {
+		return nil
+	}
+
+	return s.spill()
+}
+
+// spill sorts the entries in memory and writes them to a new run file.
+func (s *sorter) spill() error {
+	sort.Slice(s.entries, func(i, j int) bool { return less(s.entries[i], s.entries[j]) })
+
+	f, err := os.CreateTemp(s.dir, "verify-run-*")
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, f)
+
+	w := bufio.NewWriter(f)
+	var n [binary.MaxVarintLen64]byte
+	for _, e := range s.entries {
+		w.Write(n[:binary.PutUvarint(n[:], uint64(len(e.key)))])
+		w.WriteString(e.key)
+		w.Write(e.hash[:])
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	s.entries = s.entries[:0]
+	return nil
+}
+
+// sorted returns an iterator over every entry added, in order.
+func (s *sorter) sorted() (iterator, error) {
+	if len(s.runs) == 0 {
+		sort.Slice(s.entries, func(i, j int) bool { return less(s.entries[i], s.entries[j]) })
+		return &sliceIter{entries: s.entries}, nil
+	}
+
+	if len(s.entries) > 0 {
+		if err := s.spill(); err != nil {
+			return nil, err
+		}
+	}
+
+	m := merger{}
+	for _, f := range s.runs {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+
+		r := &runReader{r: bufio.NewReader(f)}
+		e, ok, err := r.next()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			m.heads = append(m.heads, head{e: e, r: r})
+		}
+	}
+	heap.Init(&m)
+
+	return &m, nil
+}
+
+// close removes the run files.
+func (s *sorter) close() {
+	for _, f := range s.runs {
+		f.Close()
+		os.Remove(f.Name())
+	}
+	s.runs = nil
+}
+
+// =============================================================================
+
+// sliceIter hands out entries sorted in memory.
+type sliceIter struct {
+	entries []entry
+}
+
+func (it *sliceIter) next() (entry, bool, error) {
+	if len(it.entries) == 0 {
+		return entry{}, false, nil
+	}
+
+	e := it.entries[0]
+	it.entries = it.entries[1:]
+	return e, true, nil
+}
+
+// runReader reads the entries of a run file back.
+type runReader struct {
+	r *bufio.Reader
+}
+
+func (rr *runReader) next() (entry, bool, error) {
+	n, err := binary.ReadUvarint(rr.r)
+	if err == io.EOF {
+		return entry{}, false, nil
+	}
+	if err != nil {
+		return entry{}, false, err
+	}
+
+	key := make([]byte, n)
+	var e entry
+	if _, err := io.ReadFull(rr.r, key); err != nil {
+		return entry{}, false, errors.New("run file is truncated")
+	}
+	if _, err := io.ReadFull(rr.r, e.hash[:]); err != nil {
+		return entry{}, false, errors.New("run file is truncated")
+	}
+	e.key = string(key)
+
+	return e, true, nil
+}
+
+// head is the next entry of a run.
+type head struct {
+	e entry
+	r *runReader
+}
+
+// merger merges sorted runs by keeping the next entry of every run in a
+// heap.
+type merger struct {
+	heads []head
+}
+
+func (m *merger) Len() int           { return len(m.heads) }
+func (m *merger) Less(i, j int) bool { return less(m.heads[i].e, m.heads[j].e) }
+func (m *merger) Swap(i, j int)      { m.heads[i], m.heads[j] = m.heads[j], m.heads[i] }
+func (m *merger) Push(x interface{}) { m.heads = append(m.heads, x.(head)) }
+func (m *merger) Pop() interface{} {
+	h := m.heads[len(m.heads)-1]
+	m.heads = m.heads[:len(m.heads)-1]
+	return h
+}
+
+func (m *merger) next() (entry, bool, error) {
+	if len(m.heads) == 0 {
+		return entry{}, false, nil
+	}
+
+	e := m.heads[0].e
+
+	ne, ok, err := m.heads[0].r.next()
+	switch {
+	case err != nil:
+		return entry{}, false, err
+	case ok:
+		m.heads[0].e = ne
+		heap.Fix(m, 0)
+	default:
+		heap.Pop(m)
+	}
+
+	return e, true, nil
+}
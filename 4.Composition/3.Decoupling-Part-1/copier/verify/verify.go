@@ -0,0 +1,254 @@
+// Package verify proves a copy is complete. It streams the records of the
+// source and of the destination read back, computes checksums for every
+// record and for each side as a whole, and reports the records that are
+// missing, extra or different.
+//
+// Memory is bounded. Each side keeps at most MaxInMemory records' worth of
+// keys and checksums and spills sorted runs to temporary files beyond
+// that, which are merged back to compare the two sides.
+package verify
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier"
+)
+
+// Options configures a verification.
+type Options struct {
+	Key         []string  // Fields that identify a record. Without any, a record is its own key and changes show up as missing and extra.
+	MaxInMemory int       // Records per side held in memory before a run is spilled. Zero means 100,000.
+	TempDir     string    // Where run files go. Empty means the system default.
+	Report      io.Writer // Where the diff report is written as JSON Lines. Nil writes none.
+}
+
+// Checksums describes one side of a copy.
+type Checksums struct {
+	Records   int    `json:"records"`
+	Ordered   string `json:"ordered"`   // Changes if the records change or come in a different order.
+	Unordered string `json:"unordered"` // Changes only if the records change.
+}
+
+// Result is the outcome of a verification.
+type Result struct {
+	Source     Checksums `json:"source"`
+	Dest       Checksums `json:"dest"`
+	Missing    int       `json:"missing"`    // Records in the source but not the destination.
+	Extra      int       `json:"extra"`      // Records in the destination but not the source.
+	Mismatched int       `json:"mismatched"` // Records with the same key and different values.
+}
+
+// OK reports whether the destination holds exactly what the source had.
+func (r Result) OK() bool {
+	return r.Missing == 0 && r.Extra == 0 && r.Mismatched == 0 && r.Source.Unordered == r.Dest.Unordered
+}
+
+// Diff is a line of the report.
+type Diff struct {
+	Kind string `json:"kind"` // missing, extra or mismatched.
+	Key  string `json:"key"`
+}
+
+// =============================================================================
+
+// Hash returns the checksum of a record. It covers the fields, with their
+// kinds, in name order, or the line for a record without fields.
+func Hash(d *copier.Data) [32]byte {
+	h := sha256.New()
+
+	if d.Fields == nil {
+		h.Write([]byte{0})
+		h.Write([]byte(d.Line))
+
+		var sum [32]byte
+		copy(sum[:], h.Sum(nil))
+		return sum
+	}
+
+	names := make([]string, 0, len(d.Fields))
+	for name := range d.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var n [binary.MaxVarintLen64]byte
+	write := func(s string) {
+		h.Write(n[:binary.PutUvarint(n[:], uint64(len(s)))])
+		h.Write([]byte(s))
+	}
+
+	h.Write([]byte{1})
+	for _, name := range names {
+		v := d.Fields[name]
+		write(name)
+		write(v.Kind().String())
+		write(v.String())
+	}
+
+	var sum [32]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+// side computes the checksums of one side and sorts its entries.
+type side struct {
+	key       []string
+	sorter    sorter
+	records   int
+	ordered   [32]byte
+	unordered uint64
+}
+
+// add takes a record into account.
+func (s *side) add(d *copier.Data) error {
+	hash := Hash(d)
+
+	s.records++
+	s.ordered = sha256.Sum256(append(s.ordered[:], hash[:]...))
+	s.unordered += binary.BigEndian.Uint64(hash[:8])
+
+	return s.sorter.add(entry{key: s.keyOf(d, hash), hash: hash})
+}
+
+// keyOf returns the key a record is matched on.
+func (s *side) keyOf(d *copier.Data, hash [32]byte) string {
+	if len(s.key) == 0 {
+		return hex.EncodeToString(hash[:])
+	}
+
+	vals := make([]string, len(s.key))
+	for i, k := range s.key {
+		vals[i] = strconv.Quote(d.Fields[k].String())
+	}
+	return strings.Join(vals, ",")
+}
+
+// checksums returns the checksums of the side.
+func (s *side) checksums() Checksums {
+	var u [8]byte
+	binary.BigEndian.PutUint64(u[:], s.unordered)
+
+	return Checksums{
+		Records:   s.records,
+		Ordered:   hex.EncodeToString(s.ordered[:]),
+		Unordered: hex.EncodeToString(u[:]),
+	}
+}
+
+// read pulls every record of p into the side.
+func (s *side) read(p copier.Puller) error {
+	for {
+		var d copier.Data
+		err := p.Pull(&d)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := s.add(&d); err != nil {
+			return err
+		}
+	}
+}
+
+// Verify compares what src hands out with what dst hands out. Both are
+// pulled until io.EOF.
+func Verify(src, dst copier.Puller, opts Options) (Result, error) {
+	if opts.MaxInMemory <= 0 {
+		opts.MaxInMemory = 100000
+	}
+
+	sides := [2]*side{}
+	for i := range sides {
+		sides[i] = &side{
+			key:    opts.Key,
+			sorter: sorter{dir: opts.TempDir, max: opts.MaxInMemory},
+		}
+		defer sides[i].sorter.close()
+	}
+
+	if err := sides[0].read(src); err != nil {
+		return Result{}, fmt.Errorf("read source: %w", err)
+	}
+	if err := sides[1].read(dst); err != nil {
+		return Result{}, fmt.Errorf("read destination: %w", err)
+	}
+
+	res := Result{
+		Source: sides[0].checksums(),
+		Dest:   sides[1].checksums(),
+	}
+
+	a, err := sides[0].sorter.sorted()
+	if err != nil {
+		return res, err
+	}
+	b, err := sides[1].sorter.sorted()
+	if err != nil {
+		return res, err
+	}
+
+	var enc *json.Encoder
+	if opts.Report != nil {
+		enc = json.NewEncoder(opts.Report)
+	}
+	report := func(kind, key string, count *int) error {
+		*count++
+		if enc == nil {
+			return nil
+		}
+		return enc.Encode(Diff{Kind: kind, Key: key})
+	}
+
+	ea, oka, err := a.next()
+	if err != nil {
+		return res, err
+	}
+	eb, okb, err := b.next()
+	if err != nil {
+		return res, err
+	}
+
+	for oka || okb {
+		switch {
+		case !okb || (oka && ea.key < eb.key):
+			err = report("missing", ea.key, &res.Missing)
+			if err == nil {
+				ea, oka, err = a.next()
+			}
+
+		case !oka || eb.key < ea.key:
+			err = report("extra", eb.key, &res.Extra)
+			if err == nil {
+				eb, okb, err = b.next()
+			}
+
+		default:
+			if ea.hash != eb.hash {
+				err = report("mismatched", ea.key, &res.Mismatched)
+			}
+			if err == nil {
+				ea, oka, err = a.next()
+			}
+			if err == nil {
+				eb, okb, err = b.next()
+			}
+		}
+
+		if err != nil {
+			return res, err
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,184 @@
+package verify_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier"
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier/verify"
+)
+
+const succeed = "\u2713"
+const failed = "\u2717"
+
+// records hands out a fixed set of records.
+type records []copier.Data
+
+func (r *records) Pull(d *copier.Data) error {
+	if len(*r) == 0 {
+		return io.EOF
+	}
+
+	*d = (*r)[0]
+	*r = (*r)[1:]
+	return nil
+}
+
+// rec returns a record with an id and a name.
+func rec(id int64, name string) copier.Data {
+	return copier.Data{Fields: map[string]copier.Value{
+		"id":   copier.Int(id),
+		"name": copier.String(name),
+	}}
+}
+
+// build returns the records with ids from 0 to n.
+func build(n int) records {
+	rs := make(records, n)
+	for i := range rs {
+		rs[i] = rec(int64(i), "System")
+	}
+	return rs
+}
+
+// reverse returns the records in the opposite order.
+func reverse(rs records) records {
+	out := make(records, len(rs))
+	for i, r := range rs {
+		out[len(rs)-1-i] = r
+	}
+	return out
+}
+
+// TestChecksums validates the ordered checksum notices the order of the
+// records and the unordered one doesn't.
+func TestChecksums(t *testing.T) {
+	t.Log("Given the need to checksum both sides of a copy.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the destination has the records in another order.", testID)
+		{
+			src, dst := build(10), reverse(build(10))
+
+			res, err := verify.Verify(&src, &dst, verify.Options{Key: []string{"id"}})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to verify : %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to verify.", succeed, testID)
+
+			if res.OK() && res.Source.Records == 10 && res.Dest.Records == 10 {
+				t.Logf("\t%s\tTest %d:\tShould find the copy complete.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould find the copy complete : %+v", failed, testID, res)
+			}
+
+			if res.Source.Unordered == res.Dest.Unordered {
+				t.Logf("\t%s\tTest %d:\tShould have the same unordered checksum.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould have the same unordered checksum : %s %s", failed, testID, res.Source.Unordered, res.Dest.Unordered)
+			}
+
+			if res.Source.Ordered != res.Dest.Ordered {
+				t.Logf("\t%s\tTest %d:\tShould have a different ordered checksum.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould have a different ordered checksum : %s", failed, testID, res.Source.Ordered)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen a value changes kind but not text.", testID)
+		{
+			a := copier.Data{Fields: map[string]copier.Value{"id": copier.Int(1)}}
+			b := copier.Data{Fields: map[string]copier.Value{"id": copier.String("1")}}
+
+			if verify.Hash(&a) != verify.Hash(&b) {
+				t.Logf("\t%s\tTest %d:\tShould checksum the records differently.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould checksum the records differently.", failed, testID)
+			}
+		}
+	}
+}
+
+// TestDiff validates the report names the missing, extra and mismatched
+// records, with and without spilling runs to disk.
+func TestDiff(t *testing.T) {
+	t.Log("Given the need to report what differs between the sides of a copy.")
+	{
+		for testID, max := range []int{0, 3} {
+			t.Logf("\tTest %d:\tWhen holding %d records in memory.", testID, max)
+			{
+				src := build(20)
+				dst := build(20)
+				dst = append(dst[:5], dst[6:]...)
+				dst[10] = rec(11, "Changed")
+				dst = append(dst, rec(50, "System"))
+
+				dir := t.TempDir()
+				var buf bytes.Buffer
+				res, err := verify.Verify(&src, &dst, verify.Options{
+					Key:         []string{"id"},
+					MaxInMemory: max,
+					TempDir:     dir,
+					Report:      &buf,
+				})
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to verify : %v", failed, testID, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould be able to verify.", succeed, testID)
+
+				if !res.OK() && res.Missing == 1 && res.Extra == 1 && res.Mismatched == 1 {
+					t.Logf("\t%s\tTest %d:\tShould count one of each difference.", succeed, testID)
+				} else {
+					t.Errorf("\t%s\tTest %d:\tShould count one of each difference : %+v", failed, testID, res)
+				}
+
+				got := map[string]string{}
+				s := bufio.NewScanner(&buf)
+				for s.Scan() {
+					var d verify.Diff
+					if err := json.Unmarshal(s.Bytes(), &d); err != nil {
+						t.Fatalf("\t%s\tTest %d:\tShould write JSON Lines : %v", failed, testID, err)
+					}
+					got[d.Kind] = d.Key
+				}
+
+				if got["missing"] == `"5"` && got["mismatched"] == `"11"` && got["extra"] == `"50"` && len(got) == 3 {
+					t.Logf("\t%s\tTest %d:\tShould report the keys that differ.", succeed, testID)
+				} else {
+					t.Errorf("\t%s\tTest %d:\tShould report the keys that differ : %v", failed, testID, got)
+				}
+
+				files, _ := os.ReadDir(dir)
+				if len(files) == 0 {
+					t.Logf("\t%s\tTest %d:\tShould remove the run files.", succeed, testID)
+				} else {
+					t.Errorf("\t%s\tTest %d:\tShould remove the run files : %s", failed, testID, filepath.Join(dir, files[0].Name()))
+				}
+			}
+		}
+
+		testID := 2
+		t.Logf("\tTest %d:\tWhen records have no key.", testID)
+		{
+			src := records{{Line: "A"}, {Line: "B"}, {Line: "B"}}
+			dst := records{{Line: "B"}, {Line: "C"}, {Line: "A"}}
+
+			res, err := verify.Verify(&src, &dst, verify.Options{MaxInMemory: 1, TempDir: t.TempDir()})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to verify : %v", failed, testID, err)
+			}
+
+			if res.Missing == 1 && res.Extra == 1 && res.Mismatched == 0 {
+				t.Logf("\t%s\tTest %d:\tShould report changes as missing and extra.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould report changes as missing and extra : %+v", failed, testID, res)
+			}
+		}
+	}
+}
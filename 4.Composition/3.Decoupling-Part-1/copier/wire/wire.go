@@ -0,0 +1,138 @@
+// Package wire is the protocol the copier systems speak over TCP. Every
+// message is a frame: a 4 byte big endian length, then a byte for the type
+// of the frame, then a JSON payload. The length covers the type and the
+// payload.
+//
+// A client pulls with a Pull frame naming the cursor to read from and gets
+// a Batch frame back with the records and the cursor after them. A client
+// stores with a Store frame and gets an Ack frame back. Requests carry
+// everything the server needs to answer them, so a client that loses its
+// connection can send the same request again on a new one.
+package wire
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MaxFrame is the largest frame a peer accepts.
+const MaxFrame = 16 << 20
+
+// The types of frame.
+const (
+	TypePull  byte = 1
+	TypeBatch byte = 2
+	TypeStore byte = 3
+	TypeAck   byte = 4
+)
+
+// ErrFrameSize is returned for a frame larger than MaxFrame.
+var ErrFrameSize = errors.New("frame too large")
+
+// Value is a typed value of a record with the value in its text form.
+type Value struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value,omitempty"`
+}
+
+// Record is a record as it travels.
+type Record struct {
+	Line   string           `json:"line,omitempty"`
+	Fields map[string]Value `json:"fields,omitempty"`
+}
+
+// Pull asks for up to Max records starting at Cursor. An empty cursor is
+// the start of the data.
+type Pull struct {
+	Cursor string `json:"cursor"`
+	Max    int    `json:"max"`
+}
+
+// Batch answers a Pull. Cursors holds the position after each record and
+// Cursor the position after all of them. EOF is set once there are no
+// records after them, and Error when the server failed to read past them.
+type Batch struct {
+	Records []Record `json:"records"`
+	Cursors []string `json:"cursors"`
+	Cursor  string   `json:"cursor"`
+	EOF     bool     `json:"eof,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// Store asks for records to be stored. A server stores a batch id once, so
+// a batch sent again after a lost Ack isn't stored twice.
+type Store struct {
+	Batch   string   `json:"batch"`
+	Records []Record `json:"records"`
+}
+
+// Ack answers a Store. Either every record was stored or, with Error set,
+// none of them were.
+type Ack struct {
+	Stored int    `json:"stored"`
+	Error  string `json:"error,omitempty"`
+}
+
+// =============================================================================
+
+// Write writes a frame of the specified type holding msg.
+func Write(w io.Writer, typ byte, msg interface{}) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if len(payload)+1 > MaxFrame {
+		return ErrFrameSize
+	}
+
+	buf := make([]byte, 5+len(payload))
+	binary.BigEndian.PutUint32(buf, uint32(len(payload)+1))
+	buf[4] = typ
+	copy(buf[5:], payload)
+
+	_, err = w.Write(buf)
+	return err
+}
+
+// Read reads the next frame and returns its type and payload.
+func Read(r io.Reader) (byte, []byte, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+
+	n := binary.BigEndian.Uint32(hdr[:4])
+	switch {
+	case n == 0:
+		return 0, nil, errors.New("empty frame")
+	case n > MaxFrame:
+		return 0, nil, ErrFrameSize
+	}
+
+	payload := make([]byte, n-1)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, err
+	}
+
+	return hdr[4], payload, nil
+}
+
+// ReadMsg reads the next frame, checks it is of the type expected and
+// decodes it into msg.
+func ReadMsg(r io.Reader, typ byte, msg interface{}) error {
+	got, payload, err := Read(r)
+	if err != nil {
+		return err
+	}
+	if got != typ {
+		return fmt.Errorf("expected frame type %d but got %d", typ, got)
+	}
+
+	return json.Unmarshal(payload, msg)
+}
@@ -0,0 +1,69 @@
+package wire_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/3.Decoupling-Part-1/copier/wire"
+)
+
+const succeed = "\u2713"
+const failed = "\u2717"
+
+// TestFrames validates frames survive the trip and bad frames are refused.
+func TestFrames(t *testing.T) {
+	t.Log("Given the need to send messages over a stream.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen writing two frames back to back.", testID)
+		{
+			var buf bytes.Buffer
+			wire.Write(&buf, wire.TypePull, wire.Pull{Cursor: "42", Max: 10})
+			wire.Write(&buf, wire.TypeAck, wire.Ack{Stored: 3})
+
+			var p wire.Pull
+			var a wire.Ack
+			err1 := wire.ReadMsg(&buf, wire.TypePull, &p)
+			err2 := wire.ReadMsg(&buf, wire.TypeAck, &a)
+
+			if err1 == nil && err2 == nil && p.Cursor == "42" && p.Max == 10 && a.Stored == 3 {
+				t.Logf("\t%s\tTest %d:\tShould read both messages back.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould read both messages back : %v %v %+v %+v", failed, testID, err1, err2, p, a)
+			}
+
+			if _, _, err := wire.Read(&buf); err == io.EOF {
+				t.Logf("\t%s\tTest %d:\tShould return io.EOF at the end.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould return io.EOF at the end : %v", failed, testID, err)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen reading bad frames.", testID)
+		{
+			var big bytes.Buffer
+			binary.Write(&big, binary.BigEndian, uint32(wire.MaxFrame+1))
+			big.WriteByte(wire.TypeBatch)
+
+			var short bytes.Buffer
+			wire.Write(&short, wire.TypeBatch, wire.Batch{Cursor: "1"})
+			short.Truncate(short.Len() - 2)
+
+			var wrong bytes.Buffer
+			wire.Write(&wrong, wire.TypeAck, wire.Ack{})
+
+			_, _, err1 := wire.Read(&big)
+			_, _, err2 := wire.Read(&short)
+			err3 := wire.ReadMsg(&wrong, wire.TypeBatch, &wire.Batch{})
+
+			if err1 == wire.ErrFrameSize && err2 == io.ErrUnexpectedEOF && err3 != nil {
+				t.Logf("\t%s\tTest %d:\tShould refuse large, short and unexpected frames.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould refuse large, short and unexpected frames : %v %v %v", failed, testID, err1, err2, err3)
+			}
+		}
+	}
+}
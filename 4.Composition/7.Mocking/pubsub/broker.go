@@ -0,0 +1,319 @@
+package pubsub
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultBuffer is the number of messages a subscriber can fall behind by
+// before messages are dropped for it.
+const DefaultBuffer = 64
+
+// ErrClosed is returned when using a broker or a client that was closed.
+var ErrClosed = errors.New("pubsub: closed")
+
+// Message is a value published for a key.
+type Message struct {
+	Key       string
+	ID        string // What the message is about within its key, like an order number. Optional.
+	Value     interface{}
+	Seq       uint64 // Order the broker received the message in, from 1. Zero when read from a log.
+	Offset    int64  // Position in the log of a durable topic.
+	Partition int    // Partition of a durable topic the message is in.
+	Published time.Time
+
+	claim *claim // Claim the message was read under, for committing it.
+}
+
+// Broker routes published messages to the subscribers of their key. It
+// lives in the process, and clients reach it through the host it was
+// registered for.
+//
+// Every subscriber has its own buffered channel. A publish never waits on
+// a subscriber: when a subscriber's buffer is full the message is dropped
+// for that subscriber and counted, the drop pattern, so one slow
+// subscriber can't hold up the others or the publisher.
+type Broker struct {
+	host   string
+	buffer int
+
+	// The lock also guards the subscriptions and the state of the clients,
+	// so a client can't be closed while a message is delivered to it.
+	mu      sync.RWMutex
+	clients map[*PubSub]bool
+	topics  *subjects
+	logs    map[string]*durable
+	seq     uint64
+	closed  bool
+}
+
+// subscriber is what the broker delivers messages to: a client's channel
+// or a subscription.
+type subscriber interface {
+	deliver(m Message)
+}
+
+// brokers are the brokers by the host they were registered for.
+var brokers = struct {
+	sync.Mutex
+	m map[string]*Broker
+}{m: make(map[string]*Broker)}
+
+// NewBroker constructs a broker and registers it for host, so clients
+// created with New(host) use it. Every subscriber gets a buffer of the
+// specified size, DefaultBuffer when it is zero.
+func NewBroker(host string, buffer int) (*Broker, error) {
+	if buffer <= 0 {
+		buffer = DefaultBuffer
+	}
+
+	brokers.Lock()
+	defer brokers.Unlock()
+
+	if _, ok := brokers.m[host]; ok {
+		return nil, errors.New("pubsub: a broker is already registered for " + host)
+	}
+
+	b := newBroker(host, buffer)
+	brokers.m[host] = b
+
+	return b, nil
+}
+
+// newBroker constructs a broker that isn't registered.
+func newBroker(host string, buffer int) *Broker {
+	return &Broker{
+		host:    host,
+		buffer:  buffer,
+		clients: make(map[*PubSub]bool),
+		topics:  &subjects{},
+		logs:    make(map[string]*durable),
+	}
+}
+
+// lookup returns the broker registered for host, registering one with the
+// default settings if there is none.
+func lookup(host string) *Broker {
+	brokers.Lock()
+	defer brokers.Unlock()
+
+	if b, ok := brokers.m[host]; ok {
+		return b
+	}
+
+	b := newBroker(host, DefaultBuffer)
+	brokers.m[host] = b
+
+	return b
+}
+
+// Close shuts the broker down. The channels of its subscribers are closed
+// once they were sent every message published before, and publishing to it
+// fails with ErrClosed. The host is free for a new broker afterwards.
+func (b *Broker) Close() error {
+	brokers.Lock()
+	if brokers.m[b.host] == b {
+		delete(brokers.m, b.host)
+	}
+	brokers.Unlock()
+
+	b.mu.Lock()
+
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+
+	var subs []*Subscription
+	for ps := range b.clients {
+		for s := range ps.subs {
+			s.shutdown()
+			subs = append(subs, s)
+		}
+		ps.shutdown()
+	}
+	b.clients = nil
+	b.topics = &subjects{}
+
+	b.mu.Unlock()
+
+	for _, s := range subs {
+		<-s.done
+	}
+
+	var err error
+	for _, d := range b.logs {
+		if err2 := d.close(); err == nil {
+			err = err2
+		}
+	}
+
+	return err
+}
+
+// join adds a client to the broker. A client of a closed broker starts
+// closed.
+func (b *Broker) join(ps *PubSub) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		ps.shutdown()
+		return
+	}
+	b.clients[ps] = true
+}
+
+// publish fans a message from ps out to the subscribers of its key,
+// appending it to the log of the key first if it is durable.
+func (b *Broker) publish(ps *PubSub, key string, id string, v interface{}) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed || ps.closed {
+		return ErrClosed
+	}
+
+	m := Message{
+		Key:       key,
+		ID:        id,
+		Value:     v,
+		Published: time.Now(),
+	}
+
+	if d, ok := b.logs[key]; ok {
+		p := d.partition(id)
+		off, err := d.parts[p].append(id, v)
+		if err != nil {
+			return err
+		}
+		m.Offset = off
+		m.Partition = p
+	}
+
+	b.seq++
+	m.Seq = b.seq
+
+	// A subscriber of several patterns the key matches gets the message
+	// once.
+	seen := make(map[subscriber]bool)
+	b.topics.match(key, func(sub subscriber) {
+		if !seen[sub] {
+			seen[sub] = true
+			sub.deliver(m)
+		}
+	})
+
+	return nil
+}
+
+// subscribe adds ps to the subscribers of key.
+func (b *Broker) subscribe(ps *PubSub, key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed || ps.closed {
+		return ErrClosed
+	}
+
+	b.add(ps, key)
+	ps.keys[key] = true
+
+	return nil
+}
+
+// add adds sub to the subscribers of key. The lock is held.
+func (b *Broker) add(sub subscriber, key string) {
+	b.topics.add(key, sub)
+}
+
+// unsubscribe removes ps from the subscribers of key.
+func (b *Broker) unsubscribe(ps *PubSub, key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.remove(ps, key)
+}
+
+// remove removes ps from the subscribers of key. The lock is held.
+func (b *Broker) remove(ps *PubSub, key string) {
+	b.drop(ps, key)
+	delete(ps.keys, key)
+}
+
+// drop removes sub from the subscribers of key. The lock is held.
+func (b *Broker) drop(sub subscriber, key string) {
+	b.topics.remove(key, sub)
+}
+
+// attach adds the subscription s of ps to the subscribers of its key. A
+// subscription to a durable topic starts reading the partitions, all of
+// them or those its group gives it.
+func (b *Broker) attach(ps *PubSub, s *Subscription) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed || ps.closed {
+		return ErrClosed
+	}
+
+	b.add(s, s.key)
+	ps.subs[s] = true
+
+	switch {
+	case s.group != nil:
+		s.group.join(s)
+	case s.topic != nil:
+		for p, t := range s.topic.parts {
+			s.start(&claim{part: p, log: t, sub: s, start: s.from.resolve(t.log)})
+		}
+	}
+
+	return nil
+}
+
+// detach removes the subscription s from the subscribers of its key and
+// stops it.
+func (b *Broker) detach(s *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.drop(s, s.key)
+	delete(s.ps.subs, s)
+	s.shutdown()
+}
+
+// leave removes ps from the broker and closes its channel. It returns the
+// subscriptions of ps, which were stopped.
+func (b *Broker) leave(ps *PubSub) []*Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for key := range ps.keys {
+		b.remove(ps, key)
+	}
+
+	var subs []*Subscription
+	for s := range ps.subs {
+		b.drop(s, s.key)
+		delete(ps.subs, s)
+		s.shutdown()
+		subs = append(subs, s)
+	}
+
+	delete(b.clients, ps)
+	ps.shutdown()
+
+	return subs
+}
+
+// Subscribers returns the number of subscribers of key, which can be a
+// pattern. Subscribers of other patterns matching key aren't counted.
+func (b *Broker) Subscribers(key string) int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.topics.count(key)
+}
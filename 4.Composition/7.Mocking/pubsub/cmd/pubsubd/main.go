@@ -0,0 +1,48 @@
+// This program serves a broker over TCP so clients in other processes can
+// publish and subscribe with pubsub.New("tcp://localhost:4222"). It runs
+// until interrupted.
+//
+//	go run ./cmd/pubsubd -addr localhost:4222 -buffer 256
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/7.Mocking/pubsub"
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/7.Mocking/pubsub/server"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:4222", "address to listen on")
+	buffer := flag.Int("buffer", pubsub.DefaultBuffer, "messages a client can fall behind by before they are dropped for it")
+	flag.Parse()
+
+	// The broker is registered for a host only this process knows, so it is
+	// reached through the server.
+	const host = "pubsubd"
+
+	b, err := pubsub.NewBroker(host, *buffer)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer b.Close()
+
+	srv := server.New(host)
+	listening, err := srv.Listen(*addr)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer srv.Close()
+
+	fmt.Printf("pubsubd listening on %s\n", listening)
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+}
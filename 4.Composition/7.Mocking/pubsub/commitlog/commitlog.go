@@ -0,0 +1,459 @@
+// Package commitlog implements an append-only log of records on local disk.
+// The log is split into segments, each a file of records with an index
+// file mapping the offsets of its records to their positions, so a record
+// is found with a binary search and a single read. Segments past their age
+// or beyond the size of the log are removed, and the closed segments can be
+// compacted down to the last record of every key.
+//
+//	l, err := commitlog.Open("data/orders", commitlog.Options{MaxAge: 24 * time.Hour})
+//	if err != nil {
+//		return err
+//	}
+//	defer l.Close()
+//
+//	off, err := l.Append("order-17", data)
+//	r, err := l.Read(off)
+package commitlog
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arjun1malhotra/a-labs-go/9.Channels/clock"
+)
+
+// DefaultSegmentBytes is the size a segment grows to before a new one is
+// started.
+const DefaultSegmentBytes = 1 << 20
+
+// ErrClosed is returned when using a log that was closed.
+var ErrClosed = errors.New("commitlog: closed")
+
+// Record is an entry of the log.
+type Record struct {
+	Offset int64 // Position in the log, from 0. Offsets only grow.
+	Time   time.Time
+	Key    string
+	Value  []byte
+}
+
+// Options configures a log.
+type Options struct {
+	SegmentBytes int64         // Size of a segment before a new one is started. Zero means DefaultSegmentBytes.
+	MaxAge       time.Duration // Age of the newest record of a segment before it is removed. Zero keeps them.
+	MaxBytes     int64         // Size of the log beyond which the oldest segments are removed. Zero keeps them.
+
+	// Compact compacts the closed segments whenever a new segment is
+	// started, keeping the last record of every key.
+	Compact bool
+
+	// Clock stamps the records and ages the segments. Zero means the real
+	// clock.
+	Clock clock.Clock
+}
+
+// Log is an append-only log of records split into segments. It is safe for
+// concurrent use. Records are written through to the operating system, not
+// synced to the disk, so they survive the process crashing but not the
+// machine.
+type Log struct {
+	dir  string
+	opts Options
+
+	mu       sync.RWMutex
+	segments []*segment // By base offset. The last one is appended to.
+	next     int64
+	wait     chan struct{}
+	closed   bool
+}
+
+// Open opens the log kept in dir, creating it if needed. A record torn by
+// a crash at the end of a segment is dropped.
+func Open(dir string, opts Options) (*Log, error) {
+	if opts.SegmentBytes <= 0 {
+		opts.SegmentBytes = DefaultSegmentBytes
+	}
+	if opts.Clock == nil {
+		opts.Clock = clock.New()
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	// Files of a compaction that didn't finish are dropped.
+	tmp, err := filepath.Glob(filepath.Join(dir, "*.compact"))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range tmp {
+		os.Remove(name)
+	}
+
+	names, err := filepath.Glob(filepath.Join(dir, "*.log"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	l := Log{
+		dir:  dir,
+		opts: opts,
+		wait: make(chan struct{}),
+	}
+
+	for _, name := range names {
+		base, err := strconv.ParseInt(strings.TrimSuffix(filepath.Base(name), ".log"), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		s, err := openSegment(dir, base, "")
+		if err != nil {
+			l.closeSegments()
+			return nil, err
+		}
+		l.segments = append(l.segments, s)
+	}
+
+	if len(l.segments) == 0 {
+		s, err := openSegment(dir, 0, "")
+		if err != nil {
+			return nil, err
+		}
+		l.segments = append(l.segments, s)
+	}
+
+	active := l.segments[len(l.segments)-1]
+	l.next = active.base
+	if len(active.entries) > 0 {
+		l.next = active.last().offset + 1
+	}
+
+	return &l, nil
+}
+
+// Append adds a record at the end of the log and returns its offset.
+func (l *Log) Append(key string, value []byte) (int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return 0, ErrClosed
+	}
+
+	active := l.segments[len(l.segments)-1]
+	if n := int64(headerSize + len(key) + len(value)); active.size > 0 && active.size+n > l.opts.SegmentBytes {
+		s, err := openSegment(l.dir, l.next, "")
+		if err != nil {
+			return 0, err
+		}
+		l.segments = append(l.segments, s)
+		active = s
+
+		// The record goes into the new segment on the next call if the
+		// maintenance fails, so nothing is lost.
+		if err := l.retain(); err != nil {
+			return 0, err
+		}
+		if l.opts.Compact {
+			if err := l.compact(); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	r := Record{
+		Offset: l.next,
+		Time:   l.opts.Clock.Now(),
+		Key:    key,
+		Value:  value,
+	}
+	if err := active.append(r); err != nil {
+		return 0, err
+	}
+	l.next++
+
+	close(l.wait)
+	l.wait = make(chan struct{})
+
+	return r.Offset, nil
+}
+
+// Read returns the first record at or after offset. Records can be missing
+// from the log because they were removed by retention or compaction. It
+// returns io.EOF when there is no such record yet.
+func (l *Log) Read(offset int64) (Record, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if l.closed {
+		return Record{}, ErrClosed
+	}
+
+	for _, s := range l.segments {
+		if len(s.entries) == 0 || s.last().offset < offset {
+			continue
+		}
+
+		i := sort.Search(len(s.entries), func(i int) bool {
+			return s.entries[i].offset >= offset
+		})
+		r, _, err := s.read(s.entries[i].pos, s.size)
+		return r, err
+	}
+
+	return Record{}, io.EOF
+}
+
+// Wait returns a channel that is closed once there is a record at offset
+// or after it, or the log is closed.
+func (l *Log) Wait(offset int64) <-chan struct{} {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if l.closed || offset < l.next {
+		ch := make(chan struct{})
+		close(ch)
+		return ch
+	}
+
+	return l.wait
+}
+
+// Earliest returns the offset of the first record in the log, or the
+// offset of the next record when it is empty.
+func (l *Log) Earliest() int64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for _, s := range l.segments {
+		if len(s.entries) > 0 {
+			return s.entries[0].offset
+		}
+	}
+
+	return l.next
+}
+
+// Latest returns the offset the next record will get.
+func (l *Log) Latest() int64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.next
+}
+
+// OffsetAt returns the offset of the first record appended at or after t,
+// or the offset of the next record when there is none.
+func (l *Log) OffsetAt(t time.Time) int64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	ns := t.UnixNano()
+	for _, s := range l.segments {
+		if len(s.entries) == 0 || s.last().time < ns {
+			continue
+		}
+
+		i := sort.Search(len(s.entries), func(i int) bool {
+			return s.entries[i].time >= ns
+		})
+		return s.entries[i].offset
+	}
+
+	return l.next
+}
+
+// Size returns the size of the log on disk, not counting the indexes.
+func (l *Log) Size() int64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	var size int64
+	for _, s := range l.segments {
+		size += s.size
+	}
+
+	return size
+}
+
+// Segments returns the number of segments of the log.
+func (l *Log) Segments() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return len(l.segments)
+}
+
+// Retain removes the segments past the maximum age and the oldest segments
+// while the log is beyond its maximum size. It runs whenever a new segment
+// is started, so a log that isn't appended to has to call it to age.
+func (l *Log) Retain() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return ErrClosed
+	}
+
+	return l.retain()
+}
+
+// retain implements Retain. The segment being appended to is never
+// removed. The lock is held.
+func (l *Log) retain() error {
+	now := l.opts.Clock.Now()
+
+	var total int64
+	for _, s := range l.segments {
+		total += s.size
+	}
+
+	for len(l.segments) > 1 {
+		s := l.segments[0]
+
+		empty := len(s.entries) == 0
+		old := l.opts.MaxAge > 0 && !empty && now.Sub(time.Unix(0, s.last().time)) > l.opts.MaxAge
+		big := l.opts.MaxBytes > 0 && total > l.opts.MaxBytes
+		if !empty && !old && !big {
+			break
+		}
+
+		if err := s.remove(); err != nil {
+			return err
+		}
+		total -= s.size
+		l.segments = l.segments[1:]
+	}
+
+	return nil
+}
+
+// Compact rewrites the closed segments keeping only the last record of
+// every key. Records with an empty key are always kept, and the offsets of
+// the records kept don't change.
+func (l *Log) Compact() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return ErrClosed
+	}
+
+	return l.compact()
+}
+
+// compact implements Compact. Only the segments with records to drop are
+// read and rewritten, which the keys kept for every segment tell without
+// reading the others. The lock is held.
+func (l *Log) compact() error {
+	if len(l.segments) < 2 {
+		return nil
+	}
+
+	latest := make(map[string]int64)
+	for _, s := range l.segments {
+		if err := s.scanKeys(); err != nil {
+			return err
+		}
+		for k, off := range s.keys {
+			latest[k] = off
+		}
+	}
+
+	for i, s := range l.segments[:len(l.segments)-1] {
+		if !s.stale(latest) {
+			continue
+		}
+
+		c, err := l.rewrite(s, latest)
+		if err != nil {
+			return err
+		}
+		l.segments[i] = c
+	}
+
+	return nil
+}
+
+// rewrite copies the records of s that are the latest of their key into a
+// new segment that replaces it. The index is removed before the log is
+// replaced, so a crash part way leaves a log that is indexed again when it
+// is opened.
+func (l *Log) rewrite(s *segment, latest map[string]int64) (*segment, error) {
+	var keep []Record
+	for _, e := range s.entries {
+		r, _, err := s.read(e.pos, s.size)
+		if err != nil {
+			return nil, err
+		}
+		if r.Key == "" || latest[r.Key] == r.Offset {
+			keep = append(keep, r)
+		}
+	}
+
+	c, err := openSegment(l.dir, s.base, ".compact")
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range keep {
+		if err := c.append(r); err != nil {
+			c.remove()
+			return nil, err
+		}
+	}
+	keys, keyed := c.keys, c.keyed
+	c.close()
+	s.close()
+
+	if err := os.Remove(s.idxPath); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(c.logPath, s.logPath); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(c.idxPath, s.idxPath); err != nil {
+		return nil, err
+	}
+
+	n, err := openSegment(l.dir, s.base, "")
+	if err != nil {
+		return nil, err
+	}
+	n.keys, n.keyed = keys, keyed
+
+	return n, nil
+}
+
+// Close closes the log. Channels returned by Wait are closed.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	close(l.wait)
+
+	return l.closeSegments()
+}
+
+// closeSegments closes the files of every segment.
+func (l *Log) closeSegments() error {
+	var err error
+	for _, s := range l.segments {
+		if err2 := s.close(); err == nil {
+			err = err2
+		}
+	}
+	return err
+}
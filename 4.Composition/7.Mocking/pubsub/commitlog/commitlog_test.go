@@ -0,0 +1,287 @@
+package commitlog_test
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/7.Mocking/pubsub/commitlog"
+	"github.com/arjun1malhotra/a-labs-go/9.Channels/clock"
+)
+
+const succeed = "\u2713"
+const failed = "\u2717"
+
+// start is the time the fake clocks of the tests start at.
+var start = time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+// fill appends n records with keys cycling through keys.
+func fill(t *testing.T, l *commitlog.Log, n int, keys int) {
+	t.Helper()
+
+	for i := 0; i < n; i++ {
+		if _, err := l.Append(fmt.Sprintf("key-%d", i%keys), []byte(fmt.Sprintf("value %d", i))); err != nil {
+			t.Fatalf("Should be able to append : %v", err)
+		}
+	}
+}
+
+// TestAppendRead validates records are read back by offset, across
+// segments and after the log is opened again.
+func TestAppendRead(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Log("Given the need to keep records on disk.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen records span several segments.", testID)
+		{
+			l, err := commitlog.Open(dir, commitlog.Options{SegmentBytes: 256})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould open the log : %v", failed, testID, err)
+			}
+			fill(t, l, 50, 50)
+
+			if n := l.Segments(); n > 1 {
+				t.Logf("\t%s\tTest %d:\tShould roll segments : %d", succeed, testID, n)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould roll segments : %d", failed, testID, n)
+			}
+
+			ok := true
+			for off := int64(0); off < 50; off++ {
+				r, err := l.Read(off)
+				if err != nil || r.Offset != off || string(r.Value) != fmt.Sprintf("value %d", off) {
+					t.Errorf("\t%s\tTest %d:\tShould read offset %d : %+v %v", failed, testID, off, r, err)
+					ok = false
+				}
+			}
+			if ok {
+				t.Logf("\t%s\tTest %d:\tShould read every record by offset.", succeed, testID)
+			}
+
+			if _, err := l.Read(50); err == io.EOF {
+				t.Logf("\t%s\tTest %d:\tShould report the end of the log.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould report the end of the log : %v", failed, testID, err)
+			}
+
+			l.Close()
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen the last record was torn by a crash.", testID)
+		{
+			names, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+			last := names[len(names)-1]
+			fi, _ := os.Stat(last)
+			os.Truncate(last, fi.Size()-3)
+
+			l, err := commitlog.Open(dir, commitlog.Options{SegmentBytes: 256})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould open the log : %v", failed, testID, err)
+			}
+			defer l.Close()
+
+			if n := l.Latest(); n == 49 {
+				t.Logf("\t%s\tTest %d:\tShould drop the torn record.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould drop the torn record : %d", failed, testID, n)
+			}
+
+			off, err := l.Append("key-49", []byte("again"))
+			r, _ := l.Read(off)
+			if err == nil && off == 49 && string(r.Value) == "again" {
+				t.Logf("\t%s\tTest %d:\tShould append where the log ends.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould append where the log ends : %d %v", failed, testID, off, err)
+			}
+		}
+	}
+}
+
+// TestRetention validates segments are removed by age and by size.
+func TestRetention(t *testing.T) {
+	t.Log("Given the need to bound the log.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen segments are older than the maximum age.", testID)
+		{
+			clk := clock.NewFake(start)
+			l, err := commitlog.Open(t.TempDir(), commitlog.Options{SegmentBytes: 256, MaxAge: time.Hour, Clock: clk})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould open the log : %v", failed, testID, err)
+			}
+			defer l.Close()
+
+			fill(t, l, 20, 20)
+			clk.Advance(90 * time.Minute)
+			fill(t, l, 20, 20)
+
+			if at := l.OffsetAt(start.Add(time.Minute)); at == 20 {
+				t.Logf("\t%s\tTest %d:\tShould find the offset for a time.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould find the offset for a time : %d", failed, testID, at)
+			}
+
+			// Retention removes whole segments, so records from before the
+			// gap can share a segment with newer ones and stay.
+			l.Retain()
+			r, err := l.Read(0)
+			if e := l.Earliest(); err == nil && e > 0 && e <= 20 && r.Offset == e {
+				t.Logf("\t%s\tTest %d:\tShould remove the old records : %d", succeed, testID, e)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould remove the old records : %d %+v %v", failed, testID, e, r, err)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen the log is beyond its maximum size.", testID)
+		{
+			l, err := commitlog.Open(t.TempDir(), commitlog.Options{SegmentBytes: 256, MaxBytes: 1024})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould open the log : %v", failed, testID, err)
+			}
+			defer l.Close()
+
+			fill(t, l, 200, 200)
+
+			if size := l.Size(); size <= 1024+256 && l.Earliest() > 0 && l.Latest() == 200 {
+				t.Logf("\t%s\tTest %d:\tShould remove the oldest segments : %d", succeed, testID, size)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould remove the oldest segments : %d", failed, testID, size)
+			}
+		}
+	}
+}
+
+// TestCompact validates compaction keeps the last record of every key.
+func TestCompact(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Log("Given the need to keep the last record of every key.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the log is compacted.", testID)
+		{
+			l, err := commitlog.Open(dir, commitlog.Options{SegmentBytes: 256})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould open the log : %v", failed, testID, err)
+			}
+			fill(t, l, 100, 5)
+			before := l.Size()
+
+			if err := l.Compact(); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould compact : %v", failed, testID, err)
+			}
+			l.Close()
+
+			// The compacted segments have to be read back from disk.
+			l, err = commitlog.Open(dir, commitlog.Options{SegmentBytes: 256})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould open the log : %v", failed, testID, err)
+			}
+			defer l.Close()
+
+			last := make(map[string]string)
+			var offsets []int64
+			for off := int64(0); ; {
+				r, err := l.Read(off)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould read the log : %v", failed, testID, err)
+				}
+				last[r.Key] = string(r.Value)
+				offsets = append(offsets, r.Offset)
+				off = r.Offset + 1
+			}
+
+			ok := len(last) == 5 && l.Size() < before
+			for k := 0; k < 5; k++ {
+				if last[fmt.Sprintf("key-%d", k)] != fmt.Sprintf("value %d", 95+k) {
+					ok = false
+				}
+			}
+			if ok {
+				t.Logf("\t%s\tTest %d:\tShould keep the last value of every key : %d of 100 records", succeed, testID, len(offsets))
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould keep the last value of every key : %v %d", failed, testID, last, l.Size())
+			}
+
+			if l.Latest() == 100 && offsets[len(offsets)-1] == 99 {
+				t.Logf("\t%s\tTest %d:\tShould keep the offsets.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould keep the offsets : %v", failed, testID, offsets)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen the log is compacted on every new segment.", testID)
+		{
+			dir := t.TempDir()
+			opts := commitlog.Options{SegmentBytes: 256, Compact: true}
+
+			l, err := commitlog.Open(dir, opts)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould open the log : %v", failed, testID, err)
+			}
+
+			// Records of their own key are never dropped, so the segments
+			// holding them don't change.
+			for i := 0; i < 20; i++ {
+				l.Append(fmt.Sprintf("customer-%d", i), []byte("created"))
+			}
+			names, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+			first, _ := os.Stat(names[0])
+
+			fill(t, l, 100, 5)
+			l.Close()
+
+			// The keys of segments opened from disk are read once.
+			if l, err = commitlog.Open(dir, opts); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould open the log : %v", failed, testID, err)
+			}
+			defer l.Close()
+			fill(t, l, 100, 5)
+
+			if now, err := os.Stat(names[0]); err == nil && os.SameFile(first, now) {
+				t.Logf("\t%s\tTest %d:\tShould leave the segments with nothing to drop alone.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould leave the segments with nothing to drop alone : %v", failed, testID, err)
+			}
+
+			if err := l.Compact(); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould compact : %v", failed, testID, err)
+			}
+
+			counts := make(map[string]int)
+			for off := int64(0); ; {
+				r, err := l.Read(off)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould read the log : %v", failed, testID, err)
+				}
+				counts[r.Key]++
+				off = r.Offset + 1
+			}
+
+			// The segment being appended to isn't compacted.
+			ok := len(counts) == 25
+			for k, n := range counts {
+				ok = ok && (n == 1 || k[:4] == "key-")
+			}
+			if ok {
+				t.Logf("\t%s\tTest %d:\tShould keep a record of every key.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould keep a record of every key : %v", failed, testID, counts)
+			}
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package commitlog
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// A record on disk is a header followed by its key and its value:
+//
+//	crc     uint32 of everything after it
+//	offset  int64
+//	time    int64 Unix nanoseconds
+//	key     uint32 length
+//	value   uint32 length
+const headerSize = 28
+
+// An index entry is the offset, position and time of a record, as three
+// int64.
+const entrySize = 24
+
+// errCorrupt reports a record that is torn or doesn't match its checksum.
+var errCorrupt = errors.New("commitlog: corrupt record")
+
+// entry locates a record in its segment.
+type entry struct {
+	offset int64
+	pos    int64
+	time   int64
+}
+
+// segment is a log file holding records from its base offset on and the
+// index file holding an entry for each of them.
+type segment struct {
+	base    int64
+	logPath string
+	idxPath string
+	log     *os.File
+	idx     *os.File
+	entries []entry
+	size    int64
+
+	// The offset of the last record of every key in the segment, and the
+	// number of records with a key, so compaction knows which segments
+	// have records to drop without reading them. Nil until the records
+	// of a segment opened from disk are scanned for them.
+	keys  map[string]int64
+	keyed int
+}
+
+// segmentPaths returns the paths of the files of the segment starting at
+// base. The names sort in the order of their base offsets.
+func segmentPaths(dir string, base int64, suffix string) (string, string) {
+	name := filepath.Join(dir, fmt.Sprintf("%020d", base))
+	return name + ".log" + suffix, name + ".index" + suffix
+}
+
+// openSegment opens the segment starting at base, creating it if it
+// doesn't exist. A record at the end of the log that was torn by a crash is
+// truncated away and the index is rebuilt from the log when it is behind.
+func openSegment(dir string, base int64, suffix string) (*segment, error) {
+	logPath, idxPath := segmentPaths(dir, base, suffix)
+
+	lf, err := os.OpenFile(logPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	xf, err := os.OpenFile(idxPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		lf.Close()
+		return nil, err
+	}
+
+	s := segment{
+		base:    base,
+		logPath: logPath,
+		idxPath: idxPath,
+		log:     lf,
+		idx:     xf,
+	}
+	if err := s.load(); err != nil {
+		s.close()
+		return nil, fmt.Errorf("commitlog: %s: %w", logPath, err)
+	}
+	if len(s.entries) == 0 {
+		s.keys = make(map[string]int64)
+	}
+
+	return &s, nil
+}
+
+// load reads the index and checks it against the log, scanning the log from
+// the last indexed record on.
+func (s *segment) load() error {
+	data, err := io.ReadAll(s.idx)
+	if err != nil {
+		return err
+	}
+	fi, err := s.log.Stat()
+	if err != nil {
+		return err
+	}
+	size := fi.Size()
+
+	entries := make([]entry, 0, len(data)/entrySize)
+	for b := data; len(b) >= entrySize; b = b[entrySize:] {
+		e := entry{
+			offset: int64(binary.BigEndian.Uint64(b[0:])),
+			pos:    int64(binary.BigEndian.Uint64(b[8:])),
+			time:   int64(binary.BigEndian.Uint64(b[16:])),
+		}
+		if e.pos >= size {
+			break
+		}
+		entries = append(entries, e)
+	}
+
+	var pos int64
+	if n := len(entries); n > 0 {
+		pos = entries[n-1].pos
+		entries = entries[:n-1]
+	}
+	for pos < size {
+		r, n, err := s.read(pos, size)
+		if err != nil {
+			break
+		}
+		entries = append(entries, entry{offset: r.Offset, pos: pos, time: r.Time.UnixNano()})
+		pos += n
+	}
+
+	if pos < size {
+		if err := s.log.Truncate(pos); err != nil {
+			return err
+		}
+	}
+	s.entries = entries
+	s.size = pos
+
+	return s.writeIndex()
+}
+
+// writeIndex writes the index from the entries in memory.
+func (s *segment) writeIndex() error {
+	buf := make([]byte, 0, len(s.entries)*entrySize)
+	for _, e := range s.entries {
+		buf = appendEntry(buf, e)
+	}
+
+	if err := s.idx.Truncate(0); err != nil {
+		return err
+	}
+	_, err := s.idx.WriteAt(buf, 0)
+	return err
+}
+
+// read reads the record at pos, which has to end before limit. It returns
+// the record and its size on disk.
+func (s *segment) read(pos, limit int64) (Record, int64, error) {
+	var h [headerSize]byte
+	if pos+headerSize > limit {
+		return Record{}, 0, errCorrupt
+	}
+	if _, err := s.log.ReadAt(h[:], pos); err != nil {
+		return Record{}, 0, err
+	}
+
+	kl := int64(binary.BigEndian.Uint32(h[20:]))
+	vl := int64(binary.BigEndian.Uint32(h[24:]))
+	n := headerSize + kl + vl
+	if pos+n > limit {
+		return Record{}, 0, errCorrupt
+	}
+
+	body := make([]byte, kl+vl)
+	if _, err := s.log.ReadAt(body, pos+headerSize); err != nil {
+		return Record{}, 0, err
+	}
+
+	crc := crc32.NewIEEE()
+	crc.Write(h[4:])
+	crc.Write(body)
+	if crc.Sum32() != binary.BigEndian.Uint32(h[0:]) {
+		return Record{}, 0, errCorrupt
+	}
+
+	r := Record{
+		Offset: int64(binary.BigEndian.Uint64(h[4:])),
+		Time:   time.Unix(0, int64(binary.BigEndian.Uint64(h[12:]))),
+		Key:    string(body[:kl]),
+		Value:  body[kl:],
+	}
+
+	return r, n, nil
+}
+
+// append writes a record at the end of the segment.
+func (s *segment) append(r Record) error {
+	buf := make([]byte, headerSize, headerSize+len(r.Key)+len(r.Value))
+	binary.BigEndian.PutUint64(buf[4:], uint64(r.Offset))
+	binary.BigEndian.PutUint64(buf[12:], uint64(r.Time.UnixNano()))
+	binary.BigEndian.PutUint32(buf[20:], uint32(len(r.Key)))
+	binary.BigEndian.PutUint32(buf[24:], uint32(len(r.Value)))
+	buf = append(buf, r.Key...)
+	buf = append(buf, r.Value...)
+	binary.BigEndian.PutUint32(buf[0:], crc32.ChecksumIEEE(buf[4:]))
+
+	if _, err := s.log.WriteAt(buf, s.size); err != nil {
+		return err
+	}
+
+	e := entry{offset: r.Offset, pos: s.size, time: r.Time.UnixNano()}
+	if _, err := s.idx.WriteAt(appendEntry(nil, e), int64(len(s.entries))*entrySize); err != nil {
+		return err
+	}
+
+	s.entries = append(s.entries, e)
+	s.size += int64(len(buf))
+	if s.keys != nil && r.Key != "" {
+		s.keys[r.Key] = r.Offset
+		s.keyed++
+	}
+
+	return nil
+}
+
+// scanKeys reads the keys of the records of the segment, unless they are
+// known already.
+func (s *segment) scanKeys() error {
+	if s.keys != nil {
+		return nil
+	}
+
+	keys := make(map[string]int64)
+	var keyed int
+	for _, e := range s.entries {
+		r, _, err := s.read(e.pos, s.size)
+		if err != nil {
+			return err
+		}
+		if r.Key != "" {
+			keys[r.Key] = r.Offset
+			keyed++
+		}
+	}
+	s.keys, s.keyed = keys, keyed
+
+	return nil
+}
+
+// stale reports whether the segment has records that aren't the latest of
+// their key.
+func (s *segment) stale(latest map[string]int64) bool {
+	if s.keyed > len(s.keys) {
+		return true
+	}
+	for k, off := range s.keys {
+		if latest[k] != off {
+			return true
+		}
+	}
+	return false
+}
+
+// last returns the entry of the last record. The segment isn't empty.
+func (s *segment) last() entry {
+	return s.entries[len(s.entries)-1]
+}
+
+// close closes the files of the segment.
+func (s *segment) close() error {
+	err := s.log.Close()
+	if err2 := s.idx.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// remove closes the segment and removes its files.
+func (s *segment) remove() error {
+	s.close()
+	if err := os.Remove(s.logPath); err != nil {
+		return err
+	}
+	return os.Remove(s.idxPath)
+}
+
+// appendEntry appends the encoding of an index entry to buf.
+func appendEntry(buf []byte, e entry) []byte {
+	var b [entrySize]byte
+	binary.BigEndian.PutUint64(b[0:], uint64(e.offset))
+	binary.BigEndian.PutUint64(b[8:], uint64(e.pos))
+	binary.BigEndian.PutUint64(b[16:], uint64(e.time))
+	return append(buf, b[:]...)
+}
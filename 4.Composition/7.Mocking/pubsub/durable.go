@@ -0,0 +1,366 @@
+package pubsub
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/7.Mocking/pubsub/commitlog"
+)
+
+// Codec turns the values of a durable topic into the bytes kept in its log
+// and back.
+type Codec interface {
+	Encode(v interface{}) ([]byte, error)
+	Decode(data []byte) (interface{}, error)
+}
+
+// JSON is the default Codec. Values come back the way encoding/json
+// decodes into an interface{}: objects as map[string]interface{} and
+// numbers as float64.
+type JSON struct{}
+
+// Encode implements the Codec interface.
+func (JSON) Encode(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Decode implements the Codec interface.
+func (JSON) Decode(data []byte) (interface{}, error) {
+	var v interface{}
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+// TopicOptions configures a durable topic.
+type TopicOptions struct {
+	Dir   string // Directory the logs of the topic are kept in.
+	Log   commitlog.Options
+	Codec Codec // Zero means JSON.
+}
+
+// topicLog is the log of a partition of a durable topic.
+type topicLog struct {
+	log   *commitlog.Log
+	codec Codec
+}
+
+// append encodes v and appends it to the log.
+func (t *topicLog) append(id string, v interface{}) (int64, error) {
+	data, err := t.codec.Encode(v)
+	if err != nil {
+		return 0, err
+	}
+
+	return t.log.Append(id, data)
+}
+
+// durable is a durable topic, with a log for each of its partitions. The
+// fields are guarded by the lock of the broker.
+type durable struct {
+	dir    string
+	parts  []*topicLog
+	next   uint64 // Partition of the next message without an ID.
+	groups map[string]*group
+}
+
+// partition returns the partition of a message. Messages with the same ID
+// go to the same partition, so they stay in order, and the others are
+// spread over the partitions in turn.
+func (d *durable) partition(id string) int {
+	n := uint32(len(d.parts))
+
+	if id == "" {
+		p := d.next % uint64(n)
+		d.next++
+		return int(p)
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return int(h.Sum32() % n)
+}
+
+// close saves the offsets of the groups of the topic and closes its logs.
+func (d *durable) close() error {
+	var err error
+	for _, g := range d.groups {
+		if err2 := g.close(); err == nil {
+			err = err2
+		}
+	}
+	for _, t := range d.parts {
+		if err2 := t.log.Close(); err == nil {
+			err = err2
+		}
+	}
+	return err
+}
+
+// Durable makes the topic for key durable, keeping every message published
+// for it from then on in a log on disk. Subscriptions to a durable topic
+// read the log, so they can start from an earlier message and receive the
+// values as the codec decodes them.
+func (b *Broker) Durable(key string, opts TopicOptions) error {
+	return b.Partitioned(key, 1, opts)
+}
+
+// Partitioned makes the topic for key durable with n partitions, each with
+// its own log in a directory of opts.Dir. Messages are partitioned by the
+// hash of their ID, so the messages about the same thing stay in order.
+// Members of a group share the partitions between them.
+func (b *Broker) Partitioned(key string, n int, opts TopicOptions) error {
+	if n <= 0 {
+		return errors.New("pubsub: need at least one partition")
+	}
+	if err := checkSubject(key); err != nil {
+		return err
+	}
+	if opts.Codec == nil {
+		opts.Codec = JSON{}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return ErrClosed
+	}
+	if _, ok := b.logs[key]; ok {
+		return errors.New("pubsub: " + key + " is already durable")
+	}
+
+	d := durable{
+		dir:    opts.Dir,
+		groups: make(map[string]*group),
+	}
+	for i := 0; i < n; i++ {
+		dir := opts.Dir
+		if n > 1 {
+			dir = filepath.Join(opts.Dir, fmt.Sprintf("partition-%03d", i))
+		}
+
+		l, err := commitlog.Open(dir, opts.Log)
+		if err != nil {
+			d.close()
+			return err
+		}
+		d.parts = append(d.parts, &topicLog{log: l, codec: opts.Codec})
+	}
+	b.logs[key] = &d
+
+	return nil
+}
+
+// Logs returns the logs of the partitions of the durable topic for key, or
+// nil if the topic isn't durable. Use them to apply retention or compaction
+// on demand.
+func (b *Broker) Logs(key string) []*commitlog.Log {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	d, ok := b.logs[key]
+	if !ok {
+		return nil
+	}
+
+	logs := make([]*commitlog.Log, len(d.parts))
+	for i, t := range d.parts {
+		logs[i] = t.log
+	}
+	return logs
+}
+
+// topic returns the durable topic for key, or nil.
+func (b *Broker) topic(key string) *durable {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.logs[key]
+}
+
+// =============================================================================
+
+// The places a subscription can start reading a durable topic from.
+const (
+	fromLatest = iota
+	fromEarliest
+	fromOffset
+	fromTime
+)
+
+// Position is where a subscription to a durable topic starts reading each
+// partition. The zero value is Latest.
+type Position struct {
+	from   int
+	offset int64
+	time   time.Time
+}
+
+// Latest starts with the messages published after subscribing.
+func Latest() Position {
+	return Position{from: fromLatest}
+}
+
+// Earliest starts with the oldest message the log still holds.
+func Earliest() Position {
+	return Position{from: fromEarliest}
+}
+
+// AtOffset starts with the message at offset, or the first one after it
+// that the log still holds.
+func AtOffset(offset int64) Position {
+	return Position{from: fromOffset, offset: offset}
+}
+
+// AtTime starts with the first message published at t or after.
+func AtTime(t time.Time) Position {
+	return Position{from: fromTime, time: t}
+}
+
+// resolve returns the offset the position stands for in l.
+func (p Position) resolve(l *commitlog.Log) int64 {
+	switch p.from {
+	case fromEarliest:
+		return l.Earliest()
+	case fromOffset:
+		return p.offset
+	case fromTime:
+		return l.OffsetAt(p.time)
+	}
+	return l.Latest()
+}
+
+// =============================================================================
+
+// claim is the reading of a partition by a subscription. For a member of a
+// group it is the ownership of the partition, which is revoked when the
+// group rebalances.
+type claim struct {
+	part  int
+	log   *topicLog
+	sub   *Subscription
+	start int64
+	group *group        // Nil for a subscription that isn't in a group.
+	stop  chan struct{} // Closed when the claim is revoked.
+
+	// These are guarded by the lock of the group.
+	next    int64 // Offset after the last message read.
+	out     map[int64]bool
+	revoked bool
+}
+
+// start reads the partition of c in a goroutine of the subscription.
+func (s *Subscription) start(c *claim) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.follow(c)
+	}()
+}
+
+// follow reads the log of a partition and hands the messages to the
+// subscription, waiting for more at the end of the log, until the claim is
+// revoked or the subscription is stopped. A subscription that falls behind
+// holds the reading up instead of having messages dropped. A log that
+// fails to read ends the subscription.
+func (s *Subscription) follow(c *claim) {
+	offset := c.start
+	for {
+		r, err := c.log.log.Read(offset)
+		if err == io.EOF {
+			select {
+			case <-c.log.log.Wait(offset):
+				continue
+			case <-c.stop:
+				return
+			case <-s.stop:
+				return
+			}
+		}
+		if err != nil {
+			if err != commitlog.ErrClosed {
+				s.fail(fmt.Errorf("pubsub: read partition %d of %s at offset %d: %w", c.part, s.key, offset, err))
+			}
+			return
+		}
+		offset = r.Offset + 1
+
+		if !c.read(r.Offset) {
+			return
+		}
+
+		v, err := c.log.codec.Decode(r.Value)
+		if err != nil {
+			atomic.AddUint64(&s.dropped, 1)
+			c.settle(r.Offset)
+			continue
+		}
+
+		m := Message{
+			Key:       s.key,
+			ID:        r.Key,
+			Value:     v,
+			Offset:    r.Offset,
+			Partition: c.part,
+			Published: r.Time,
+			claim:     c,
+		}
+
+		select {
+		case s.in <- m:
+		case <-c.stop:
+			return
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// read records the message at offset was read. It reports false when the
+// claim was revoked.
+func (c *claim) read(offset int64) bool {
+	if c.group == nil {
+		return true
+	}
+
+	c.group.mu.Lock()
+	defer c.group.mu.Unlock()
+
+	if c.revoked {
+		return false
+	}
+	c.out[offset] = true
+	c.next = offset + 1
+
+	return true
+}
+
+// settle records the message at offset is done with, committing the offset
+// of the group up to the first message that isn't.
+func (c *claim) settle(offset int64) {
+	if c.group == nil {
+		return
+	}
+
+	c.group.mu.Lock()
+	defer c.group.mu.Unlock()
+
+	delete(c.out, offset)
+	if c.revoked {
+		return
+	}
+
+	commit := c.next
+	for off := range c.out {
+		if off < commit {
+			commit = off
+		}
+	}
+	c.group.commit(c.part, commit)
+}
@@ -0,0 +1,177 @@
+package pubsub_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/7.Mocking/pubsub"
+	"github.com/arjun1malhotra/a-labs-go/911.Testing/leaktest"
+)
+
+// drain acks n deliveries of a subscription and returns their offsets and
+// values.
+func drain(t *testing.T, s *pubsub.Subscription, n int) ([]int64, []interface{}) {
+	t.Helper()
+
+	var offsets []int64
+	var values []interface{}
+	for i := 0; i < n; i++ {
+		d := next(t, s)
+		d.Ack()
+		offsets = append(offsets, d.Offset)
+		values = append(values, d.Value)
+	}
+	return offsets, values
+}
+
+// TestDurable validates subscriptions to a durable topic can start from
+// earlier messages, also after the broker was restarted.
+func TestDurable(t *testing.T) {
+	leaktest.Check(t)
+
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	b, err := pubsub.NewBroker(t.Name(), 0)
+	if err != nil {
+		t.Fatalf("Should be able to create a broker : %v", err)
+	}
+	if err := b.Durable("orders", pubsub.TopicOptions{Dir: dir}); err != nil {
+		t.Fatalf("Should be able to make the topic durable : %v", err)
+	}
+
+	t.Log("Given the need to read messages published while a subscriber was down.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen subscribing from the earliest message.", testID)
+		{
+			pub := pubsub.New(t.Name())
+			for i := 0; i < 5; i++ {
+				if err := pub.PublishKeyed("orders", fmt.Sprintf("order-%d", i), fmt.Sprintf("placed %d", i)); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould publish : %v", failed, testID, err)
+				}
+			}
+
+			sub, err := pubsub.New(t.Name()).SubscribeWith(ctx, "orders", pubsub.SubscribeOptions{From: pubsub.Earliest()})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould subscribe : %v", failed, testID, err)
+			}
+			offsets, values := drain(t, sub, 5)
+			sub.Unsubscribe()
+
+			if fmt.Sprint(offsets) == "[0 1 2 3 4]" && values[4] == "placed 4" {
+				t.Logf("\t%s\tTest %d:\tShould replay the log in order.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould replay the log in order : %v %v", failed, testID, offsets, values)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen subscribing from an offset.", testID)
+		{
+			sub, err := pubsub.New(t.Name()).SubscribeWith(ctx, "orders", pubsub.SubscribeOptions{From: pubsub.AtOffset(3)})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould subscribe : %v", failed, testID, err)
+			}
+			pubsub.New(t.Name()).PublishKeyed("orders", "order-5", "placed 5")
+			offsets, _ := drain(t, sub, 3)
+			sub.Unsubscribe()
+
+			if fmt.Sprint(offsets) == "[3 4 5]" {
+				t.Logf("\t%s\tTest %d:\tShould read on into the live messages.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould read on into the live messages : %v", failed, testID, offsets)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen subscribing from the latest message.", testID)
+		{
+			sub, err := pubsub.New(t.Name()).SubscribeWith(ctx, "orders", pubsub.SubscribeOptions{})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould subscribe : %v", failed, testID, err)
+			}
+			pubsub.New(t.Name()).PublishKeyed("orders", "order-6", "placed 6")
+			offsets, values := drain(t, sub, 1)
+			sub.Unsubscribe()
+
+			if offsets[0] == 6 && values[0] == "placed 6" {
+				t.Logf("\t%s\tTest %d:\tShould only read new messages.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould only read new messages : %v", failed, testID, offsets)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen the broker is restarted.", testID)
+		{
+			b.Close()
+
+			b, err = pubsub.NewBroker(t.Name(), 0)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould create a broker : %v", failed, testID, err)
+			}
+			defer b.Close()
+			if err := b.Durable("orders", pubsub.TopicOptions{Dir: dir}); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould open the topic again : %v", failed, testID, err)
+			}
+
+			sub, err := pubsub.New(t.Name()).SubscribeWith(ctx, "orders", pubsub.SubscribeOptions{From: pubsub.AtTime(time.Now().Add(-time.Hour))})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould subscribe : %v", failed, testID, err)
+			}
+			offsets, _ := drain(t, sub, 7)
+			sub.Unsubscribe()
+
+			if fmt.Sprint(offsets) == "[0 1 2 3 4 5 6]" {
+				t.Logf("\t%s\tTest %d:\tShould keep the messages on disk.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould keep the messages on disk : %v", failed, testID, offsets)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen the topic isn't durable.", testID)
+		{
+			_, err := pubsub.New(t.Name()).SubscribeWith(ctx, "invoices", pubsub.SubscribeOptions{From: pubsub.Earliest()})
+			if err != nil {
+				t.Logf("\t%s\tTest %d:\tShould refuse to replay : %v", succeed, testID, err)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould refuse to replay.", failed, testID)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen the log can't be read.", testID)
+		{
+			names, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+			f, err := os.OpenFile(names[0], os.O_RDWR, 0)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould open the log : %v", failed, testID, err)
+			}
+			f.WriteAt([]byte{0xff, 0xff, 0xff, 0xff}, 8)
+			f.Close()
+
+			sub, err := pubsub.New(t.Name()).SubscribeWith(ctx, "orders", pubsub.SubscribeOptions{From: pubsub.Earliest()})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould subscribe : %v", failed, testID, err)
+			}
+
+			select {
+			case <-sub.Done():
+			case <-time.After(time.Second):
+			}
+
+			_, ok := <-sub.C()
+			if err := sub.Err(); err != nil && !ok {
+				t.Logf("\t%s\tTest %d:\tShould end the subscription with the error : %v", succeed, testID, err)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould end the subscription with the error : %v", failed, testID, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package pubsub
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// saveInterval is how often a group saves the offsets it committed.
+const saveInterval = time.Second
+
+// group shares the partitions of a durable topic between the subscriptions
+// that are its members, so every message is delivered to one member. Each
+// partition is owned by a single member at a time, which keeps the messages
+// of a partition in order.
+//
+// The offset committed for a partition is the first message that wasn't
+// acked yet, so a member taking a partition over starts where the last
+// owner left off, redelivering what it didn't finish. The offsets are kept
+// in a file next to the logs of the topic, which is saved every so often,
+// when the partitions are rebalanced and when the topic is closed, rather
+// than on every commit.
+type group struct {
+	topic *durable
+	path  string
+
+	mu        sync.Mutex
+	members   []*Subscription // In the order they joined.
+	claims    []*claim        // By partition, nil when it has no owner.
+	committed []int64         // By partition, -1 when nothing was committed.
+	dirty     bool            // The offsets changed since they were saved.
+
+	flush chan struct{} // Asks for the offsets to be saved now.
+	stop  chan struct{}
+	done  chan struct{}
+	err   error // Of the last save, read once done is closed.
+}
+
+// group returns the group of the durable topic with the specified name,
+// creating it with the offsets it committed before.
+func (b *Broker) group(d *durable, name string) (*group, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || name[0] == '.' {
+		return nil, errors.New("pubsub: invalid group name " + name)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if g, ok := d.groups[name]; ok {
+		return g, nil
+	}
+
+	g := group{
+		topic:     d,
+		path:      filepath.Join(d.dir, "groups", name+".json"),
+		claims:    make([]*claim, len(d.parts)),
+		committed: make([]int64, len(d.parts)),
+		flush:     make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	for i := range g.committed {
+		g.committed[i] = -1
+	}
+
+	data, err := os.ReadFile(g.path)
+	switch {
+	case err == nil:
+		var committed []int64
+		if err := json.Unmarshal(data, &committed); err != nil {
+			return nil, err
+		}
+		copy(g.committed, committed)
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+
+	d.groups[name] = &g
+	go g.saver()
+
+	return &g, nil
+}
+
+// join adds a member to the group and rebalances the partitions.
+func (g *group) join(s *Subscription) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.members = append(g.members, s)
+	g.rebalance()
+}
+
+// leave removes a member from the group and rebalances its partitions over
+// the members left.
+func (g *group) leave(s *Subscription) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for i, m := range g.members {
+		if m == s {
+			g.members = append(g.members[:i], g.members[i+1:]...)
+			break
+		}
+	}
+	g.rebalance()
+}
+
+// rebalance deals the partitions out to the members in turn, so no member
+// has more than one partition more than another. A partition that changes
+// owner has its claim revoked and the new owner reads it from the offset
+// committed for it. The lock is held.
+func (g *group) rebalance() {
+	for p := range g.claims {
+		var owner *Subscription
+		if len(g.members) > 0 {
+			owner = g.members[p%len(g.members)]
+		}
+
+		c := g.claims[p]
+		if c != nil && c.sub == owner {
+			continue
+		}
+		if c != nil {
+			c.revoked = true
+			close(c.stop)
+			g.claims[p] = nil
+		}
+		if owner == nil {
+			continue
+		}
+
+		log := g.topic.parts[p]
+		start := g.committed[p]
+		if start < 0 {
+			start = owner.from.resolve(log.log)
+		}
+
+		c = &claim{
+			part:  p,
+			log:   log,
+			sub:   owner,
+			start: start,
+			group: g,
+			stop:  make(chan struct{}),
+			next:  start,
+			out:   make(map[int64]bool),
+		}
+		g.claims[p] = c
+		owner.start(c)
+	}
+
+	select {
+	case g.flush <- struct{}{}:
+	default:
+	}
+}
+
+// commit moves the offset committed for a partition forward. The offsets
+// are saved later. The lock is held.
+func (g *group) commit(part int, offset int64) {
+	if offset <= g.committed[part] {
+		return
+	}
+	g.committed[part] = offset
+	g.dirty = true
+}
+
+// saver saves the offsets every so often and when asked to, until the
+// group is closed, when it saves them a last time.
+func (g *group) saver() {
+	defer close(g.done)
+
+	t := time.NewTicker(saveInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-g.flush:
+		case <-g.stop:
+			g.err = g.save()
+			return
+		}
+
+		// A save that fails is made again the next time.
+		g.save()
+	}
+}
+
+// save writes the offsets to the file if they changed since they were last
+// saved. The file is written outside the lock, so commits don't wait for
+// the disk.
+func (g *group) save() error {
+	g.mu.Lock()
+	if !g.dirty {
+		g.mu.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(g.committed)
+	g.dirty = false
+	g.mu.Unlock()
+
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(g.path), 0755)
+	}
+	if err == nil {
+		err = writeFileAtomic(g.path, data)
+	}
+
+	if err != nil {
+		g.mu.Lock()
+		g.dirty = true
+		g.mu.Unlock()
+	}
+	return err
+}
+
+// close stops saving the offsets once they are saved a last time.
+func (g *group) close() error {
+	close(g.stop)
+	<-g.done
+
+	return g.err
+}
+
+// writeFileAtomic replaces the file at path with b, so a crash leaves either
+// the old offsets or the new ones.
+func writeFileAtomic(path string, b []byte) error {
+	dir := filepath.Dir(path)
+
+	f, err := os.CreateTemp(dir, filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	// Sync the directory so the rename itself survives a crash.
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+// partitions returns the partitions s owns.
+func (g *group) partitions(s *Subscription) []int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var parts []int
+	for p, c := range g.claims {
+		if c != nil && c.sub == s {
+			parts = append(parts, p)
+		}
+	}
+	return parts
+}
+
+// offsets returns a copy of the committed offsets.
+func (g *group) offsets() []int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return append([]int64(nil), g.committed...)
+}
+
+// Committed returns the offsets the group committed for the partitions of
+// the durable topic for key, -1 for a partition it committed nothing for.
+// It returns nil when there is no such group.
+func (b *Broker) Committed(key string, name string) []int64 {
+	b.mu.RLock()
+	d, ok := b.logs[key]
+	var g *group
+	if ok {
+		g = d.groups[name]
+	}
+	b.mu.RUnlock()
+
+	if g == nil {
+		return nil
+	}
+	return g.offsets()
+}
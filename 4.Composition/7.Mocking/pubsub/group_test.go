@@ -0,0 +1,241 @@
+package pubsub_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/7.Mocking/pubsub"
+	"github.com/arjun1malhotra/a-labs-go/911.Testing/leaktest"
+)
+
+// publishOrders publishes the orders from up to but not including to, for
+// eight customers.
+func publishOrders(t *testing.T, host string, from, to int) {
+	t.Helper()
+
+	pub := pubsub.New(host)
+	defer pub.Close()
+
+	for i := from; i < to; i++ {
+		if err := pub.PublishKeyed("orders", fmt.Sprintf("customer-%d", i%8), i); err != nil {
+			t.Fatalf("Should be able to publish : %v", err)
+		}
+	}
+}
+
+// collect receives n deliveries from the members of a group and returns
+// the deliveries of each member.
+func collect(t *testing.T, members []*pubsub.Subscription, n int) [][]*pubsub.Delivery {
+	t.Helper()
+
+	got := make([][]*pubsub.Delivery, len(members))
+	timeout := time.After(2 * time.Second)
+	for total := 0; total < n; {
+		for i, m := range members {
+			select {
+			case d := <-m.C():
+				got[i] = append(got[i], d)
+				total++
+			case <-timeout:
+				t.Fatalf("Should receive %d deliveries : got %d", n, total)
+			default:
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return got
+}
+
+// ackAll acks the deliveries and returns the orders they were for.
+func ackAll(ds []*pubsub.Delivery) []int {
+	for _, d := range ds {
+		d.Ack()
+	}
+	return orders(ds)
+}
+
+// orders returns the orders the deliveries were for.
+func orders(ds []*pubsub.Delivery) []int {
+	var orders []int
+	for _, d := range ds {
+		orders = append(orders, int(d.Value.(float64)))
+	}
+	return orders
+}
+
+// committedBy waits for the offsets committed by the billing group to add
+// up to n, since acks are committed after they are sent, and returns them.
+func committedBy(b *pubsub.Broker, n int64) []int64 {
+	deadline := time.Now().Add(time.Second)
+	for sum(b.Committed("orders", "billing")) != n && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	return b.Committed("orders", "billing")
+}
+
+// sum returns the sum of the offsets.
+func sum(offsets []int64) int64 {
+	var n int64
+	for _, off := range offsets {
+		n += off
+	}
+	return n
+}
+
+// inOrder reports whether the orders of every customer are in order and
+// every order in [from, to) was received exactly once.
+func inOrder(got [][]int, from, to int) bool {
+	seen := make(map[int]bool)
+	for _, orders := range got {
+		last := make(map[int]int)
+		for _, o := range orders {
+			if seen[o] {
+				return false
+			}
+			seen[o] = true
+
+			if prev, ok := last[o%8]; ok && prev > o {
+				return false
+			}
+			last[o%8] = o
+		}
+	}
+
+	for o := from; o < to; o++ {
+		if !seen[o] {
+			return false
+		}
+	}
+	return len(seen) == to-from
+}
+
+// TestGroup validates the members of a group share the partitions of a
+// topic, keep the order per key and pick up where others left off.
+func TestGroup(t *testing.T) {
+	leaktest.Check(t)
+
+	dir := t.TempDir()
+	ctx := context.Background()
+	opts := pubsub.SubscribeOptions{Group: "billing", From: pubsub.Earliest()}
+
+	b, err := pubsub.NewBroker(t.Name(), 0)
+	if err != nil {
+		t.Fatalf("Should be able to create a broker : %v", err)
+	}
+	if err := b.Partitioned("orders", 4, pubsub.TopicOptions{Dir: dir}); err != nil {
+		t.Fatalf("Should be able to partition the topic : %v", err)
+	}
+
+	t.Log("Given the need to share a topic between the instances of a service.")
+	{
+		var first, second *pubsub.Subscription
+
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a group has a single member.", testID)
+		{
+			publishOrders(t, t.Name(), 0, 40)
+
+			first, err = pubsub.New(t.Name()).SubscribeWith(ctx, "orders", opts)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould join the group : %v", failed, testID, err)
+			}
+
+			got := [][]int{ackAll(collect(t, []*pubsub.Subscription{first}, 40)[0])}
+			if inOrder(got, 0, 40) && len(first.Partitions()) == 4 {
+				t.Logf("\t%s\tTest %d:\tShould receive every partition in order per key.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould receive every partition in order per key : %v", failed, testID, got)
+			}
+
+			if committed := committedBy(b, 40); sum(committed) == 40 {
+				t.Logf("\t%s\tTest %d:\tShould commit the offsets : %v", succeed, testID, committed)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould commit the offsets : %v", failed, testID, committed)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen a second member joins.", testID)
+		{
+			second, err = pubsub.New(t.Name()).SubscribeWith(ctx, "orders", opts)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould join the group : %v", failed, testID, err)
+			}
+
+			if len(first.Partitions()) == 2 && len(second.Partitions()) == 2 {
+				t.Logf("\t%s\tTest %d:\tShould rebalance the partitions.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould rebalance the partitions : %v %v", failed, testID, first.Partitions(), second.Partitions())
+			}
+
+			publishOrders(t, t.Name(), 40, 80)
+			ds := collect(t, []*pubsub.Subscription{first, second}, 40)
+			got := [][]int{ackAll(ds[0]), ackAll(ds[1])}
+			if inOrder(got, 40, 80) && len(got[0]) > 0 && len(got[1]) > 0 {
+				t.Logf("\t%s\tTest %d:\tShould share the messages : %d and %d", succeed, testID, len(got[0]), len(got[1]))
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould share the messages : %v", failed, testID, got)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen a member leaves without acking.", testID)
+		{
+			publishOrders(t, t.Name(), 80, 120)
+			ds := collect(t, []*pubsub.Subscription{first, second}, 40)
+			ackAll(ds[0])
+			second.Unsubscribe()
+
+			if len(first.Partitions()) == 4 {
+				t.Logf("\t%s\tTest %d:\tShould take the partitions over.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould take the partitions over : %v", failed, testID, first.Partitions())
+			}
+
+			var unacked []int
+			for _, d := range ds[1] {
+				unacked = append(unacked, int(d.Value.(float64)))
+			}
+			again := ackAll(collect(t, []*pubsub.Subscription{first}, len(unacked))[0])
+			if inOrder([][]int{orders(ds[0]), again}, 80, 120) {
+				t.Logf("\t%s\tTest %d:\tShould redeliver what wasn't acked : %d", succeed, testID, len(unacked))
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould redeliver what wasn't acked : %v %v", failed, testID, again, unacked)
+			}
+
+			committedBy(b, 120)
+			first.Unsubscribe()
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen the broker is restarted.", testID)
+		{
+			b.Close()
+
+			b, err = pubsub.NewBroker(t.Name(), 0)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould create a broker : %v", failed, testID, err)
+			}
+			defer b.Close()
+			if err := b.Partitioned("orders", 4, pubsub.TopicOptions{Dir: dir}); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould open the topic again : %v", failed, testID, err)
+			}
+
+			sub, err := pubsub.New(t.Name()).SubscribeWith(ctx, "orders", opts)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould join the group : %v", failed, testID, err)
+			}
+			defer sub.Unsubscribe()
+
+			publishOrders(t, t.Name(), 120, 128)
+			got := ackAll(collect(t, []*pubsub.Subscription{sub}, 8)[0])
+			if inOrder([][]int{got}, 120, 128) {
+				t.Logf("\t%s\tTest %d:\tShould resume from the committed offsets.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould resume from the committed offsets : %v", failed, testID, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,206 @@
+// Package pubsub provides publication/subscription type services. It is the
+// pubsub package from the mocking lesson with the implementation filled in
+// by an in-process broker, so the API can be used for local development.
+//
+// Clients created for the same host share a broker. A client receives the
+// messages published for the keys it subscribed to on the channel returned
+// by Messages.
+//
+//	ps := pubsub.New("localhost")
+//	defer ps.Close()
+//
+//	ps.Subscribe("orders")
+//	go func() {
+//		for m := range ps.Messages() {
+//			fmt.Println(m.Key, m.Value)
+//		}
+//	}()
+//
+//	ps.Publish("orders", order)
+//
+// Keys are subjects of dot separated tokens, and subscriptions can use the
+// wildcards * for a single token and > for the rest of the key, as in
+// orders.*.created or orders.>.
+//
+// Messages on that channel are delivered at most once. SubscribeWith sets
+// up a Subscription instead, whose deliveries have to be acked and are made
+// again when they aren't, up to a maximum before the message is
+// dead-lettered.
+//
+// A topic made durable with Broker.Durable keeps its messages in a log on
+// disk, so a subscription can start from an earlier offset or time and
+// pick up what was published while it was down. A topic made durable with
+// Broker.Partitioned is split into partitions by the ID of the messages,
+// and the subscriptions of a group share the partitions between them.
+//
+//	sub, err := ps.SubscribeWith(ctx, "orders", pubsub.SubscribeOptions{Group: "billing"})
+//
+// A host starting with tcp:// is the address of a pubsubd server, which
+// serves a broker to other processes. The client speaks the wire protocol
+// to it, dialing it again whenever the connection is lost and subscribing
+// again to its keys. Values travel as JSON and are received the way the
+// JSON codec decodes them. Subscriptions with acks, durable topics and
+// groups need a broker in the process.
+//
+//	ps := pubsub.New("tcp://localhost:4222")
+package pubsub
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+)
+
+// PubSub provides access to a queue system.
+type PubSub struct {
+	dropped uint64 // First, so it is aligned for atomic use on 32-bit systems.
+
+	host   string
+	broker *Broker
+	remote *remote // Set instead of the broker for a client of a server.
+
+	// These are guarded by the lock of the broker.
+	keys   map[string]bool
+	subs   map[*Subscription]bool
+	ch     chan Message
+	closed bool
+
+	done chan struct{}
+}
+
+// New creates a pubsub value for use.
+func New(host string) *PubSub {
+	if strings.HasPrefix(host, RemotePrefix) {
+		return newRemote(host)
+	}
+
+	b := lookup(host)
+
+	ps := PubSub{
+		host:   host,
+		broker: b,
+		keys:   make(map[string]bool),
+		subs:   make(map[*Subscription]bool),
+		ch:     make(chan Message, b.buffer),
+		done:   make(chan struct{}),
+	}
+	b.join(&ps)
+
+	return &ps
+}
+
+// Publish sends the data for the specified key.
+func (ps *PubSub) Publish(key string, v interface{}) error {
+	if err := checkSubject(key); err != nil {
+		return err
+	}
+
+	if ps.remote != nil {
+		return ps.remote.publish(key, "", v)
+	}
+	return ps.broker.publish(ps, key, "", v)
+}
+
+// PublishKeyed sends the data for the specified key with the ID of what
+// it is about. Durable topics compact by the ID.
+func (ps *PubSub) PublishKeyed(key string, id string, v interface{}) error {
+	if err := checkSubject(key); err != nil {
+		return err
+	}
+
+	if ps.remote != nil {
+		return ps.remote.publish(key, id, v)
+	}
+	return ps.broker.publish(ps, key, id, v)
+}
+
+// Subscribe sets up an request to receive messages for the specified key,
+// which can be a pattern with wildcards. The messages arrive on the channel
+// returned by Messages.
+func (ps *PubSub) Subscribe(key string) error {
+	// A server checks the key itself, so it decides what it accepts.
+	if ps.remote != nil {
+		return ps.remote.subscribe(key)
+	}
+
+	if err := checkPattern(key); err != nil {
+		return err
+	}
+	return ps.broker.subscribe(ps, key)
+}
+
+// SubscribeContext behaves like Subscribe except the subscription is
+// cancelled once ctx is done.
+func (ps *PubSub) SubscribeContext(ctx context.Context, key string) error {
+	if err := ps.Subscribe(key); err != nil {
+		return err
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			ps.Unsubscribe(key)
+		case <-ps.done:
+		}
+	}()
+
+	return nil
+}
+
+// Unsubscribe cancels the subscription to the specified key. Messages
+// already delivered stay on the channel.
+func (ps *PubSub) Unsubscribe(key string) error {
+	if ps.remote != nil {
+		ps.remote.unsubscribe(key)
+		return nil
+	}
+
+	ps.broker.unsubscribe(ps, key)
+	return nil
+}
+
+// Messages returns the channel the messages for the subscribed keys are
+// delivered on. It is closed when the client or its broker is closed.
+func (ps *PubSub) Messages() <-chan Message {
+	return ps.ch
+}
+
+// Dropped returns the number of messages dropped because the client had
+// fallen too far behind to take them.
+func (ps *PubSub) Dropped() int {
+	return int(atomic.LoadUint64(&ps.dropped))
+}
+
+// Close cancels every subscription and closes the channel of messages.
+// The messages already delivered can still be received from it.
+func (ps *PubSub) Close() error {
+	if ps.remote != nil {
+		ps.remote.close()
+		return nil
+	}
+
+	for _, s := range ps.broker.leave(ps) {
+		<-s.done
+	}
+	return nil
+}
+
+// deliver hands a message to the client without waiting, dropping it if
+// the client's buffer is full. The broker's lock is held.
+func (ps *PubSub) deliver(m Message) {
+	select {
+	case ps.ch <- m:
+	default:
+		atomic.AddUint64(&ps.dropped, 1)
+	}
+}
+
+// shutdown closes the channel of messages. The broker's lock is held, or
+// the remote connection was stopped.
+func (ps *PubSub) shutdown() {
+	if !ps.closed {
+		ps.closed = true
+		close(ps.ch)
+		close(ps.done)
+	}
+}
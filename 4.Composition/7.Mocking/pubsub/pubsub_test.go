@@ -0,0 +1,255 @@
+package pubsub_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/7.Mocking/pubsub"
+	"github.com/arjun1malhotra/a-labs-go/911.Testing/leaktest"
+)
+
+const succeed = "\u2713"
+const failed = "\u2717"
+
+// publisher is the part of the API a service publishing needs, the way the
+// mocking lesson has the user declare the interface they use.
+type publisher interface {
+	Publish(key string, v interface{}) error
+	Subscribe(key string) error
+}
+
+var _ publisher = (*pubsub.PubSub)(nil)
+
+// receive returns the next message or fails the test.
+func receive(t *testing.T, ps *pubsub.PubSub) pubsub.Message {
+	t.Helper()
+
+	select {
+	case m, ok := <-ps.Messages():
+		if !ok {
+			t.Fatal("Should receive a message : channel closed")
+		}
+		return m
+	case <-time.After(time.Second):
+		t.Fatal("Should receive a message : timed out")
+	}
+	return pubsub.Message{}
+}
+
+// TestFanOut validates every subscriber of a key gets every message
+// published for it, in order.
+func TestFanOut(t *testing.T) {
+	leaktest.Check(t)
+
+	b, err := pubsub.NewBroker(t.Name(), 16)
+	if err != nil {
+		t.Fatalf("Should be able to create a broker : %v", err)
+	}
+	defer b.Close()
+
+	t.Log("Given the need to fan messages out to subscribers.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen two clients subscribe to a key.", testID)
+		{
+			pub := pubsub.New(t.Name())
+			subs := []*pubsub.PubSub{pubsub.New(t.Name()), pubsub.New(t.Name())}
+			other := pubsub.New(t.Name())
+			for _, s := range subs {
+				if err := s.Subscribe("orders"); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould subscribe : %v", failed, testID, err)
+				}
+			}
+			other.Subscribe("invoices")
+
+			if n := b.Subscribers("orders"); n == 2 {
+				t.Logf("\t%s\tTest %d:\tShould count the subscribers.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould count the subscribers : %d", failed, testID, n)
+			}
+
+			for i := 0; i < 3; i++ {
+				if err := pub.Publish("orders", i); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould publish : %v", failed, testID, err)
+				}
+			}
+
+			for _, s := range subs {
+				for i := 0; i < 3; i++ {
+					if m := receive(t, s); m.Key != "orders" || m.Value != i {
+						t.Fatalf("\t%s\tTest %d:\tShould receive message %d in order : %+v", failed, testID, i, m)
+					}
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould deliver every message to every subscriber in order.", succeed, testID)
+
+			select {
+			case m := <-other.Messages():
+				t.Errorf("\t%s\tTest %d:\tShould not deliver other keys : %+v", failed, testID, m)
+			default:
+				t.Logf("\t%s\tTest %d:\tShould not deliver other keys.", succeed, testID)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen a client unsubscribes.", testID)
+		{
+			pub := pubsub.New(t.Name())
+			sub := pubsub.New(t.Name())
+			sub.Subscribe("payments")
+			sub.Unsubscribe("payments")
+			pub.Publish("payments", "late")
+
+			select {
+			case m := <-sub.Messages():
+				t.Errorf("\t%s\tTest %d:\tShould not deliver after unsubscribing : %+v", failed, testID, m)
+			default:
+				t.Logf("\t%s\tTest %d:\tShould not deliver after unsubscribing.", succeed, testID)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen a subscription's context is cancelled.", testID)
+		{
+			pub := pubsub.New(t.Name())
+			sub := pubsub.New(t.Name())
+			defer sub.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			sub.SubscribeContext(ctx, "refunds")
+			cancel()
+
+			deadline := time.Now().Add(time.Second)
+			for b.Subscribers("refunds") != 0 && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			pub.Publish("refunds", "late")
+
+			select {
+			case m := <-sub.Messages():
+				t.Errorf("\t%s\tTest %d:\tShould cancel the subscription : %+v", failed, testID, m)
+			default:
+				t.Logf("\t%s\tTest %d:\tShould cancel the subscription.", succeed, testID)
+			}
+		}
+	}
+}
+
+// TestSlowSubscriber validates a subscriber that falls behind has messages
+// dropped without holding up the publisher or the other subscribers.
+func TestSlowSubscriber(t *testing.T) {
+	leaktest.Check(t)
+
+	b, err := pubsub.NewBroker(t.Name(), 4)
+	if err != nil {
+		t.Fatalf("Should be able to create a broker : %v", err)
+	}
+	defer b.Close()
+
+	t.Log("Given the need to keep publishing when a subscriber falls behind.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen one subscriber never receives.", testID)
+		{
+			pub := pubsub.New(t.Name())
+			slow := pubsub.New(t.Name())
+			fast := pubsub.New(t.Name())
+			slow.Subscribe("ticks")
+			fast.Subscribe("ticks")
+
+			var wg sync.WaitGroup
+			wg.Add(1)
+			got := 0
+			go func() {
+				defer wg.Done()
+				for range fast.Messages() {
+					got++
+				}
+			}()
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for i := 0; i < 100; i++ {
+					pub.Publish("ticks", i)
+					time.Sleep(10 * time.Microsecond)
+				}
+			}()
+
+			select {
+			case <-done:
+				t.Logf("\t%s\tTest %d:\tShould never block the publisher.", succeed, testID)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("\t%s\tTest %d:\tShould never block the publisher.", failed, testID)
+			}
+
+			if d := slow.Dropped(); d == 96 && len(slow.Messages()) == 4 {
+				t.Logf("\t%s\tTest %d:\tShould drop what doesn't fit the buffer : %d", succeed, testID, d)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould drop what doesn't fit the buffer : %d", failed, testID, d)
+			}
+
+			fast.Close()
+			wg.Wait()
+			if got+fast.Dropped() == 100 {
+				t.Logf("\t%s\tTest %d:\tShould account for every message to the other subscriber.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould account for every message to the other subscriber : %d %d", failed, testID, got, fast.Dropped())
+			}
+		}
+	}
+}
+
+// TestShutdown validates closing the broker closes every client.
+func TestShutdown(t *testing.T) {
+	leaktest.Check(t)
+
+	b, err := pubsub.NewBroker(t.Name(), 0)
+	if err != nil {
+		t.Fatalf("Should be able to create a broker : %v", err)
+	}
+
+	t.Log("Given the need to shut the broker down cleanly.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the broker is closed with messages buffered.", testID)
+		{
+			pub := pubsub.New(t.Name())
+			sub := pubsub.New(t.Name())
+			idle := pubsub.New(t.Name())
+			sub.SubscribeContext(context.Background(), "orders")
+			pub.Publish("orders", "last")
+
+			b.Close()
+
+			if m := receive(t, sub); m.Value == "last" {
+				t.Logf("\t%s\tTest %d:\tShould keep the messages already delivered.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould keep the messages already delivered : %+v", failed, testID, m)
+			}
+
+			_, open1 := <-sub.Messages()
+			_, open2 := <-idle.Messages()
+			if !open1 && !open2 {
+				t.Logf("\t%s\tTest %d:\tShould close every client.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould close every client.", failed, testID)
+			}
+
+			if err := pub.Publish("orders", "after"); err == pubsub.ErrClosed {
+				t.Logf("\t%s\tTest %d:\tShould refuse to publish.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould refuse to publish : %v", failed, testID, err)
+			}
+
+			if b2, err := pubsub.NewBroker(t.Name(), 0); err == nil {
+				b2.Close()
+				t.Logf("\t%s\tTest %d:\tShould free the host.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould free the host : %v", failed, testID, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,443 @@
+package pubsub
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/7.Mocking/pubsub/wire"
+)
+
+// RemotePrefix marks a host as the address of a pubsubd server instead of
+// the name of an in-process broker, as in tcp://localhost:4222.
+const RemotePrefix = "tcp://"
+
+// ErrNotConnected is returned when publishing while a remote client is
+// reconnecting to its server and it didn't get through in time.
+var ErrNotConnected = errors.New("pubsub: not connected")
+
+// How a remote client keeps its connection.
+const (
+	dialTimeout  = 2 * time.Second
+	writeTimeout = 5 * time.Second
+	minBackoff   = 50 * time.Millisecond
+	maxBackoff   = 2 * time.Second
+	pingInterval = 20 * time.Second
+	maxPingsOut  = 2 // PINGs without a PONG before the server is given up on.
+)
+
+// remote is the connection of a client to a pubsubd server. It dials the
+// server again whenever the connection is lost, waiting longer after each
+// failure, and subscribes again to every key the client is subscribed to.
+type remote struct {
+	ps   *PubSub
+	addr string
+
+	mu     sync.Mutex
+	conn   net.Conn      // Nil while reconnecting.
+	up     chan struct{} // Closed once connected.
+	w      *wire.Writer
+	sids   map[string]uint64 // Subscriptions by key.
+	keys   map[uint64]string // Subscriptions by sid.
+	next   uint64
+	pongs  []*pending // Waiting for the PONG of each PING, nil for the keepalives.
+	closed bool
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// pending is a command waiting for the PONG of the PING sent after it,
+// which tells it the server carried the command out. The server answers in
+// order, so a -ERR that comes before the PONG is the error of the command.
+type pending struct {
+	done chan struct{} // Closed when the PONG arrives or the connection is lost.
+	err  error
+}
+
+// newRemote constructs a client of the server at addr. It connects in the
+// background.
+func newRemote(host string) *PubSub {
+	ps := PubSub{
+		host: host,
+		ch:   make(chan Message, DefaultBuffer),
+		done: make(chan struct{}),
+	}
+
+	r := remote{
+		ps:   &ps,
+		addr: strings.TrimPrefix(host, RemotePrefix),
+		sids: make(map[string]uint64),
+		keys: make(map[uint64]string),
+		up:   make(chan struct{}),
+		stop: make(chan struct{}),
+	}
+	ps.remote = &r
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.run()
+	}()
+
+	return &ps
+}
+
+// run keeps the client connected until it is closed.
+func (r *remote) run() {
+	backoff := minBackoff
+	for {
+		conn, err := net.DialTimeout("tcp", r.addr, dialTimeout)
+		if err == nil {
+			if r.connected(conn) {
+				backoff = minBackoff
+				r.read(conn)
+			}
+			r.disconnected(conn)
+		}
+
+		t := time.NewTimer(backoff)
+		select {
+		case <-t.C:
+		case <-r.stop:
+			t.Stop()
+			return
+		}
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// connected introduces the client on a new connection and subscribes to
+// the keys again. It reports false when the client was closed meanwhile.
+func (r *remote) connected(conn net.Conn) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return false
+	}
+	r.conn = conn
+	r.w = wire.NewWriter(conn)
+	close(r.up)
+
+	info, _ := json.Marshal(wire.ConnectInfo{Name: r.ps.host})
+	ops := []wire.Op{{Name: wire.Connect, Payload: info}}
+
+	sids := make([]uint64, 0, len(r.keys))
+	for sid := range r.keys {
+		sids = append(sids, sid)
+	}
+	sort.Slice(sids, func(i, j int) bool { return sids[i] < sids[j] })
+	for _, sid := range sids {
+		ops = append(ops, wire.Op{Name: wire.Sub, Args: []string{r.keys[sid], strconv.FormatUint(sid, 10)}})
+	}
+
+	// A failed write closes the connection, which read finds out.
+	r.send(ops...)
+
+	return true
+}
+
+// disconnected forgets a lost connection. Whoever waits for a PONG on it
+// stops waiting.
+func (r *remote) disconnected(conn net.Conn) {
+	conn.Close()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.conn == conn {
+		r.conn = nil
+		r.w = nil
+		r.up = make(chan struct{})
+	}
+	for _, p := range r.pongs {
+		if p != nil {
+			close(p.done)
+		}
+	}
+	r.pongs = nil
+}
+
+// read handles the operations of the server until the connection is lost,
+// pinging the server meanwhile to find out when it went away without the
+// connection being closed.
+func (r *remote) read(conn net.Conn) {
+	done := make(chan struct{})
+	defer close(done)
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.keepalive(conn, done)
+	}()
+
+	rd := wire.NewReader(conn)
+	for {
+		op, err := rd.Read()
+		if err != nil {
+			return
+		}
+
+		switch op.Name {
+		case wire.Msg:
+			r.msg(op)
+
+		case wire.Ping:
+			r.mu.Lock()
+			r.send(wire.Op{Name: wire.Pong})
+			r.mu.Unlock()
+
+		case wire.Pong:
+			r.mu.Lock()
+			if len(r.pongs) > 0 {
+				if r.pongs[0] != nil {
+					close(r.pongs[0].done)
+				}
+				r.pongs = r.pongs[1:]
+			}
+			r.mu.Unlock()
+
+		case wire.Err:
+			r.mu.Lock()
+			if len(r.pongs) > 0 && r.pongs[0] != nil && r.pongs[0].err == nil && len(op.Args) > 0 {
+				r.pongs[0].err = errors.New("pubsub: " + op.Args[0])
+			}
+			r.mu.Unlock()
+		}
+	}
+}
+
+// keepalive pings the server until done is closed, closing the connection
+// once too many PINGs went unanswered.
+func (r *remote) keepalive(conn net.Conn, done chan struct{}) {
+	t := time.NewTicker(pingInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-done:
+			return
+		}
+
+		r.mu.Lock()
+		if len(r.pongs) >= maxPingsOut {
+			conn.Close()
+		} else if r.send(wire.Op{Name: wire.Ping}) == nil {
+			r.pongs = append(r.pongs, nil)
+		}
+		r.mu.Unlock()
+	}
+}
+
+// msg delivers a MSG to the client. A message for a subscription that was
+// cancelled is dropped, unless another key of the client matches it.
+func (r *remote) msg(op wire.Op) {
+	if len(op.Args) != 4 && len(op.Args) != 5 {
+		return
+	}
+
+	sid, _ := strconv.ParseUint(op.Args[1], 10, 64)
+	seq, _ := strconv.ParseUint(op.Args[2], 10, 64)
+	published, _ := strconv.ParseInt(op.Args[3], 10, 64)
+
+	m := Message{
+		Key:       op.Args[0],
+		Seq:       seq,
+		Published: time.Unix(0, published),
+	}
+	if len(op.Args) == 5 {
+		m.ID = op.Args[4]
+	}
+
+	v, err := JSON{}.Decode(op.Payload)
+	if err != nil {
+		return
+	}
+	m.Value = v
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.keys[sid]; !ok && !r.matches(m.Key) {
+		return
+	}
+	r.ps.deliver(m)
+}
+
+// matches reports whether a key of the client matches subject. The lock is
+// held.
+func (r *remote) matches(subject string) bool {
+	for key := range r.sids {
+		if Match(key, subject) {
+			return true
+		}
+	}
+	return false
+}
+
+// send writes ops to the server. A connection that fails is closed, so it
+// is dialed again. The lock is held.
+func (r *remote) send(ops ...wire.Op) error {
+	if r.conn == nil {
+		return ErrNotConnected
+	}
+
+	for _, op := range ops {
+		if err := r.w.Write(op); err != nil {
+			return err
+		}
+	}
+
+	r.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if err := r.w.Flush(); err != nil {
+		r.conn.Close()
+		return err
+	}
+
+	return nil
+}
+
+// connect waits for the client to be connected, for as long as a dial can
+// take, and returns with the lock held.
+func (r *remote) connect() {
+	r.mu.Lock()
+	if r.conn != nil || r.closed {
+		return
+	}
+	up := r.up
+	r.mu.Unlock()
+
+	t := time.NewTimer(dialTimeout)
+	defer t.Stop()
+
+	select {
+	case <-up:
+	case <-t.C:
+	case <-r.stop:
+	}
+
+	r.mu.Lock()
+}
+
+// publish sends the value v for key to the server.
+func (r *remote) publish(key string, id string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	op := wire.Op{Name: wire.Pub, Args: []string{key}, Payload: data}
+	if id != "" {
+		op.Args = append(op.Args, id)
+	}
+
+	r.connect()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return ErrClosed
+	}
+	return r.send(op)
+}
+
+// subscribe subscribes to key and waits for the server to have it in
+// place, returning the error of a server that refuses it. When the client
+// doesn't get through in time the subscription is made once it does.
+func (r *remote) subscribe(key string) error {
+	if strings.ContainsAny(key, " \t\r\n") {
+		return errors.New("pubsub: white space in " + key)
+	}
+
+	r.connect()
+
+	if r.closed {
+		r.mu.Unlock()
+		return ErrClosed
+	}
+	if _, ok := r.sids[key]; ok {
+		r.mu.Unlock()
+		return nil
+	}
+
+	r.next++
+	sid := r.next
+	r.sids[key] = sid
+	r.keys[sid] = key
+
+	p := pending{done: make(chan struct{})}
+	err := r.send(wire.Op{Name: wire.Sub, Args: []string{key, strconv.FormatUint(sid, 10)}}, wire.Op{Name: wire.Ping})
+	if err == nil {
+		r.pongs = append(r.pongs, &p)
+	}
+
+	r.mu.Unlock()
+
+	if err != nil {
+		return nil
+	}
+
+	t := time.NewTimer(writeTimeout)
+	defer t.Stop()
+
+	select {
+	case <-p.done:
+	case <-t.C:
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if p.err == nil {
+		return nil
+	}
+	if r.sids[key] == sid {
+		delete(r.sids, key)
+		delete(r.keys, sid)
+	}
+	return p.err
+}
+
+// unsubscribe cancels the subscription to key.
+func (r *remote) unsubscribe(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sid, ok := r.sids[key]
+	if !ok {
+		return
+	}
+	delete(r.sids, key)
+	delete(r.keys, sid)
+
+	r.send(wire.Op{Name: wire.Unsub, Args: []string{strconv.FormatUint(sid, 10)}})
+}
+
+// close disconnects from the server and closes the channel of messages.
+func (r *remote) close() {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return
+	}
+	r.closed = true
+	if r.conn != nil {
+		r.conn.Close()
+	}
+	close(r.stop)
+	r.mu.Unlock()
+
+	r.wg.Wait()
+	r.ps.shutdown()
+}
@@ -0,0 +1,208 @@
+package pubsub_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/7.Mocking/pubsub"
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/7.Mocking/pubsub/server"
+	"github.com/arjun1malhotra/a-labs-go/911.Testing/leaktest"
+)
+
+// serve starts a server on loopback for the broker of host and returns its
+// address.
+func serve(t *testing.T, host string, addr string) (*server.Server, string) {
+	t.Helper()
+
+	srv := server.New(host)
+	addr, err := srv.Listen(addr)
+	if err != nil {
+		t.Fatalf("Should be able to serve on loopback : %v", err)
+	}
+	return srv, addr
+}
+
+// TestRemote validates clients of a server publish and subscribe like
+// clients in the process, and get their subscriptions back after the
+// server restarts.
+func TestRemote(t *testing.T) {
+	leaktest.Check(t)
+
+	b, err := pubsub.NewBroker(t.Name(), 0)
+	if err != nil {
+		t.Fatalf("Should be able to create a broker : %v", err)
+	}
+	defer b.Close()
+
+	srv, addr := serve(t, t.Name(), "127.0.0.1:0")
+	defer func() {
+		srv.Close()
+	}()
+	host := pubsub.RemotePrefix + addr
+
+	t.Log("Given the need to use a broker from other processes.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen clients publish and subscribe over the network.", testID)
+		{
+			pub := pubsub.New(host)
+			defer pub.Close()
+			sub := pubsub.New(host)
+			defer sub.Close()
+			local := pubsub.New(t.Name())
+			defer local.Close()
+
+			sub.Subscribe("orders.*.created")
+			sub.Subscribe("orders.>")
+			local.Subscribe("orders.>")
+
+			if n := b.Subscribers("orders.>"); n == 2 {
+				t.Logf("\t%s\tTest %d:\tShould have the subscriptions in place once subscribed.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould have the subscriptions in place once subscribed : %d", failed, testID, n)
+			}
+
+			pub.PublishKeyed("orders.eu.created", "order-7", map[string]int{"lines": 3})
+			pub.Publish("orders.eu.shipped", "parcel")
+			pub.Publish("invoices.eu.created", 1)
+
+			m1, m2 := receive(t, sub), receive(t, sub)
+			v, _ := m1.Value.(map[string]interface{})
+			if m1.Key == "orders.eu.created" && m1.ID == "order-7" && v["lines"] == 3.0 && m2.Value == "parcel" && m1.Seq < m2.Seq {
+				t.Logf("\t%s\tTest %d:\tShould deliver the values as JSON decodes them, in order.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould deliver the values as JSON decodes them, in order : %+v %+v", failed, testID, m1, m2)
+			}
+
+			time.Sleep(50 * time.Millisecond)
+			if len(sub.Messages()) == 0 {
+				t.Logf("\t%s\tTest %d:\tShould deliver once to a client of several matching patterns.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould deliver once to a client of several matching patterns : %d left", failed, testID, len(sub.Messages()))
+			}
+
+			m := receive(t, local)
+			if raw, ok := m.Value.(json.RawMessage); ok && string(raw) == `{"lines":3}` {
+				t.Logf("\t%s\tTest %d:\tShould hand clients in the process the JSON.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould hand clients in the process the JSON : %+v", failed, testID, m)
+			}
+
+			local.Publish("orders.us.created", 9)
+			if m := receive(t, sub); m.Value == 9.0 {
+				t.Logf("\t%s\tTest %d:\tShould deliver what clients in the process publish.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould deliver what clients in the process publish : %+v", failed, testID, m)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen a client unsubscribes.", testID)
+		{
+			pub := pubsub.New(host)
+			defer pub.Close()
+			sub := pubsub.New(host)
+			defer sub.Close()
+
+			sub.Subscribe("payments.*")
+			sub.Subscribe("refunds")
+			sub.Unsubscribe("payments.*")
+			pub.Publish("payments.card", "late")
+			pub.Publish("refunds", "marker")
+
+			if m := receive(t, sub); m.Value == "marker" {
+				t.Logf("\t%s\tTest %d:\tShould not deliver after unsubscribing.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould not deliver after unsubscribing : %+v", failed, testID, m)
+			}
+
+			if _, err := sub.SubscribeWith(context.Background(), "refunds", pubsub.SubscribeOptions{}); err != nil {
+				t.Logf("\t%s\tTest %d:\tShould refuse subscriptions with acks.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould refuse subscriptions with acks.", failed, testID)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen the server restarts.", testID)
+		{
+			pub := pubsub.New(host)
+			defer pub.Close()
+			sub := pubsub.New(host)
+			defer sub.Close()
+
+			sub.Subscribe("shipments")
+			pub.Publish("shipments", "before")
+			receive(t, sub)
+
+			srv.Close()
+			srv, _ = serve(t, t.Name(), addr)
+
+			// The publisher can get through before the subscriber
+			// subscribed again, so publish until a message arrives.
+			var m pubsub.Message
+			deadline := time.Now().Add(5 * time.Second)
+			for time.Now().Before(deadline) {
+				pub.Publish("shipments", "after")
+
+				select {
+				case m = <-sub.Messages():
+				case <-time.After(50 * time.Millisecond):
+					continue
+				}
+				break
+			}
+
+			if m.Value == "after" {
+				t.Logf("\t%s\tTest %d:\tShould reconnect and subscribe again.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould reconnect and subscribe again : %+v", failed, testID, m)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen the server refuses a subscription.", testID)
+		{
+			pub := pubsub.New(host)
+			defer pub.Close()
+			sub := pubsub.New(host)
+			defer sub.Close()
+
+			if err := sub.Subscribe("orders.>.eu"); err != nil {
+				t.Logf("\t%s\tTest %d:\tShould return the error of the server : %v", succeed, testID, err)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould return the error of the server.", failed, testID)
+			}
+
+			if err := sub.Subscribe("returns"); err == nil {
+				t.Logf("\t%s\tTest %d:\tShould still subscribe to a valid subject.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould still subscribe to a valid subject : %v", failed, testID, err)
+			}
+
+			pub.Publish("returns", "marker")
+			if m := receive(t, sub); m.Value == "marker" {
+				t.Logf("\t%s\tTest %d:\tShould deliver on the valid subject.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould deliver on the valid subject : %+v", failed, testID, m)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen a client is closed.", testID)
+		{
+			ps := pubsub.New(host)
+			ps.Subscribe("orders")
+			ps.Close()
+
+			_, ok := <-ps.Messages()
+			if err := ps.Publish("orders", 1); err == pubsub.ErrClosed && !ok {
+				t.Logf("\t%s\tTest %d:\tShould close the channel and refuse to publish.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould close the channel and refuse to publish : %v", failed, testID, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,328 @@
+// Package server serves the broker registered for a host over TCP with the
+// wire protocol, so clients in other processes can use it. Every connection
+// is an in-process client of the broker: what it publishes reaches the
+// subscribers in the process and on other connections, and what it
+// subscribes to is sent to it as MSG operations.
+//
+// Values travel as JSON. Values published over a connection are handed to
+// the subscribers in the process as a json.RawMessage.
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/7.Mocking/pubsub"
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/7.Mocking/pubsub/wire"
+)
+
+// writeTimeout is how long a write to a connection can take before the
+// client is given up on.
+const writeTimeout = 5 * time.Second
+
+// Server accepts connections and serves the broker of its host on them.
+type Server struct {
+	host string
+
+	mu     sync.Mutex
+	ln     net.Listener
+	conns  map[net.Conn]struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// New constructs a server for the broker registered for host.
+func New(host string) *Server {
+	return &Server{
+		host:  host,
+		conns: make(map[net.Conn]struct{}),
+	}
+}
+
+// Listen starts serving on addr and returns the address it listens on,
+// which tells the port picked for an addr like "localhost:0".
+func (s *Server) Listen(addr string) (string, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	s.ln = ln
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			s.mu.Lock()
+			if s.closed {
+				s.mu.Unlock()
+				nc.Close()
+				return
+			}
+			s.conns[nc] = struct{}{}
+			s.mu.Unlock()
+
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.serve(nc)
+			}()
+		}
+	}()
+
+	return ln.Addr().String(), nil
+}
+
+// Close stops the server and closes every connection.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	var err error
+	if s.ln != nil {
+		err = s.ln.Close()
+	}
+	for nc := range s.conns {
+		nc.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+// serve handles the operations of a connection until it closes.
+func (s *Server) serve(nc net.Conn) {
+	c := conn{
+		nc:   nc,
+		w:    wire.NewWriter(nc),
+		subs: make(map[string]string),
+	}
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, nc)
+		s.mu.Unlock()
+		nc.Close()
+	}()
+
+	r := wire.NewReader(nc)
+
+	op, err := r.Read()
+	if err != nil {
+		return
+	}
+	if op.Name != wire.Connect {
+		c.fail("expected " + wire.Connect)
+		return
+	}
+	var info wire.ConnectInfo
+	if err := json.Unmarshal(op.Payload, &info); err != nil {
+		c.fail("bad " + wire.Connect + " : " + err.Error())
+		return
+	}
+
+	c.ps = pubsub.New(s.host)
+	defer c.ps.Close()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		c.forward()
+	}()
+
+	for {
+		op, err := r.Read()
+		if err != nil {
+			if _, ok := err.(net.Error); !ok && err != io.EOF {
+				c.fail(err.Error())
+			}
+			return
+		}
+
+		if err := c.handle(op); err != nil {
+			c.fail(err.Error())
+		}
+	}
+}
+
+// =============================================================================
+
+// conn is a client connected to the server.
+type conn struct {
+	nc net.Conn
+	ps *pubsub.PubSub
+
+	// The lock is held while writing, so operations aren't interleaved,
+	// and guards the subscriptions the forwarder looks at.
+	mu   sync.Mutex
+	w    *wire.Writer
+	subs map[string]string // Subject of each subscription by its sid.
+}
+
+// handle carries out an operation of the client.
+func (c *conn) handle(op wire.Op) error {
+	switch op.Name {
+	case wire.Pub:
+		if len(op.Args) != 1 && len(op.Args) != 2 {
+			return errArgs(op)
+		}
+		if !json.Valid(op.Payload) {
+			return errors.New("payload of " + wire.Pub + " isn't JSON")
+		}
+
+		v := json.RawMessage(op.Payload)
+		if len(op.Args) == 2 {
+			return c.ps.PublishKeyed(op.Args[0], op.Args[1], v)
+		}
+		return c.ps.Publish(op.Args[0], v)
+
+	case wire.Sub:
+		if len(op.Args) != 2 {
+			return errArgs(op)
+		}
+		return c.subscribe(op.Args[0], op.Args[1])
+
+	case wire.Unsub:
+		if len(op.Args) != 1 {
+			return errArgs(op)
+		}
+		return c.unsubscribe(op.Args[0])
+
+	case wire.Ping:
+		return c.send(wire.Op{Name: wire.Pong}, true)
+
+	case wire.Pong:
+		return nil
+	}
+
+	return errors.New("unknown operation " + op.Name)
+}
+
+// subscribe subscribes the client to subject under sid.
+func (c *conn) subscribe(subject string, sid string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.subs[sid]; ok {
+		return errors.New("sid " + sid + " is in use")
+	}
+	if err := c.ps.Subscribe(subject); err != nil {
+		return err
+	}
+	c.subs[sid] = subject
+
+	return nil
+}
+
+// unsubscribe cancels the subscription sid, and the subscription to its
+// subject unless another sid has it too.
+func (c *conn) unsubscribe(sid string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	subject, ok := c.subs[sid]
+	if !ok {
+		return nil
+	}
+	delete(c.subs, sid)
+
+	for _, s := range c.subs {
+		if s == subject {
+			return nil
+		}
+	}
+	return c.ps.Unsubscribe(subject)
+}
+
+// forward sends the messages for the subscriptions of the client to it
+// until the client is closed.
+func (c *conn) forward() {
+	ch := c.ps.Messages()
+	for m := range ch {
+		c.mu.Lock()
+		c.msg(m)
+
+		// Flush once the messages waiting went out, instead of for each.
+		var err error
+		if len(ch) == 0 {
+			err = c.w.Flush()
+		}
+		c.mu.Unlock()
+
+		if err != nil {
+			c.nc.Close()
+		}
+	}
+}
+
+// msg writes m to the client as a MSG. It goes out once, under a sid that
+// matches, the way a client in the process gets it once. A message that
+// can't travel, like one with a value JSON can't encode, is skipped.
+// Failing to write is reported by the next flush. The lock is held.
+func (c *conn) msg(m pubsub.Message) {
+	data, err := json.Marshal(m.Value)
+	if err != nil {
+		return
+	}
+
+	var sid string
+	for s, subject := range c.subs {
+		if pubsub.Match(subject, m.Key) {
+			sid = s
+			break
+		}
+	}
+	if sid == "" {
+		return
+	}
+
+	op := wire.Op{
+		Name:    wire.Msg,
+		Args:    []string{m.Key, sid, strconv.FormatUint(m.Seq, 10), strconv.FormatInt(m.Published.UnixNano(), 10)},
+		Payload: data,
+	}
+	if m.ID != "" {
+		op.Args = append(op.Args, m.ID)
+	}
+
+	c.nc.SetWriteDeadline(time.Now().Add(writeTimeout))
+	c.w.Write(op)
+}
+
+// send writes op to the client, flushing it if asked.
+func (c *conn) send(op wire.Op, flush bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.nc.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if err := c.w.Write(op); err != nil {
+		return err
+	}
+	if !flush {
+		return nil
+	}
+	return c.w.Flush()
+}
+
+// fail reports an error to the client.
+func (c *conn) fail(msg string) {
+	c.send(wire.Op{Name: wire.Err, Args: []string{msg}}, true)
+}
+
+// errArgs returns the error for an operation with the wrong arguments.
+func errArgs(op wire.Op) error {
+	return errors.New("wrong number of arguments to " + op.Name)
+}
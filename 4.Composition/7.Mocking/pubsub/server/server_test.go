@@ -0,0 +1,174 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/7.Mocking/pubsub"
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/7.Mocking/pubsub/server"
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/7.Mocking/pubsub/wire"
+	"github.com/arjun1malhotra/a-labs-go/911.Testing/leaktest"
+)
+
+const succeed = "\u2713"
+const failed = "\u2717"
+
+// client speaks the protocol to a server by hand.
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	r    *wire.Reader
+	w    *wire.Writer
+}
+
+// dial connects to the server at addr.
+func dial(t *testing.T, addr string) *client {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Should be able to connect : %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	return &client{t: t, conn: conn, r: wire.NewReader(conn), w: wire.NewWriter(conn)}
+}
+
+// send writes ops to the server.
+func (c *client) send(ops ...wire.Op) {
+	c.t.Helper()
+
+	for _, op := range ops {
+		if err := c.w.Write(op); err != nil {
+			c.t.Fatalf("Should be able to write %s : %v", op.Name, err)
+		}
+	}
+	if err := c.w.Flush(); err != nil {
+		c.t.Fatalf("Should be able to send : %v", err)
+	}
+}
+
+// read returns the next operation from the server.
+func (c *client) read() wire.Op {
+	c.t.Helper()
+
+	op, err := c.r.Read()
+	if err != nil {
+		c.t.Fatalf("Should be able to read : %v", err)
+	}
+	return op
+}
+
+// TestServer validates the server speaks the protocol.
+func TestServer(t *testing.T) {
+	leaktest.Check(t)
+
+	b, err := pubsub.NewBroker(t.Name(), 0)
+	if err != nil {
+		t.Fatalf("Should be able to create a broker : %v", err)
+	}
+	defer b.Close()
+
+	srv := server.New(t.Name())
+	addr, err := srv.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Should be able to serve on loopback : %v", err)
+	}
+	defer srv.Close()
+
+	connect := wire.Op{Name: wire.Connect, Payload: []byte(`{"name":"test"}`)}
+
+	t.Log("Given the need to serve a broker over TCP.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a client doesn't start with CONNECT.", testID)
+		{
+			c := dial(t, addr)
+			defer c.conn.Close()
+
+			c.send(wire.Op{Name: wire.Ping})
+			op := c.read()
+			_, err := c.r.Read()
+
+			if op.Name == wire.Err && err != nil {
+				t.Logf("\t%s\tTest %d:\tShould report an error and hang up : %s", succeed, testID, op.Args[0])
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould report an error and hang up : %+v %v", failed, testID, op, err)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen a client subscribes and publishes.", testID)
+		{
+			c := dial(t, addr)
+			defer c.conn.Close()
+
+			c.send(connect, wire.Op{Name: wire.Sub, Args: []string{"orders.*", "7"}}, wire.Op{Name: wire.Ping})
+			if op := c.read(); op.Name == wire.Pong && b.Subscribers("orders.*") == 1 {
+				t.Logf("\t%s\tTest %d:\tShould answer PING once the subscription is in place.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould answer PING once the subscription is in place : %+v", failed, testID, op)
+			}
+
+			local := pubsub.New(t.Name())
+			defer local.Close()
+			local.Subscribe("orders.eu")
+
+			c.send(wire.Op{Name: wire.Pub, Args: []string{"orders.eu", "order-1"}, Payload: []byte(`{"total":10}`)})
+
+			op := c.read()
+			if op.Name == wire.Msg && len(op.Args) == 5 && op.Args[0] == "orders.eu" && op.Args[1] == "7" && op.Args[4] == "order-1" && string(op.Payload) == `{"total":10}` {
+				t.Logf("\t%s\tTest %d:\tShould send the message under the sid.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould send the message under the sid : %+v", failed, testID, op)
+			}
+
+			select {
+			case m := <-local.Messages():
+				if raw, ok := m.Value.(json.RawMessage); ok && m.ID == "order-1" && string(raw) == `{"total":10}` {
+					t.Logf("\t%s\tTest %d:\tShould publish to the clients in the process.", succeed, testID)
+				} else {
+					t.Errorf("\t%s\tTest %d:\tShould publish to the clients in the process : %+v", failed, testID, m)
+				}
+			case <-time.After(time.Second):
+				t.Errorf("\t%s\tTest %d:\tShould publish to the clients in the process.", failed, testID)
+			}
+
+			c.send(wire.Op{Name: wire.Unsub, Args: []string{"7"}}, wire.Op{Name: wire.Ping})
+			if op := c.read(); op.Name == wire.Pong && b.Subscribers("orders.*") == 0 {
+				t.Logf("\t%s\tTest %d:\tShould cancel the subscription.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould cancel the subscription : %+v", failed, testID, op)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen a client sends bad operations.", testID)
+		{
+			c := dial(t, addr)
+			defer c.conn.Close()
+
+			c.send(connect,
+				wire.Op{Name: "FOO"},
+				wire.Op{Name: wire.Pub, Args: []string{"orders"}, Payload: []byte("not json")},
+				wire.Op{Name: wire.Sub, Args: []string{"orders.>.eu", "1"}},
+				wire.Op{Name: wire.Ping},
+			)
+
+			var errs int
+			op := c.read()
+			for op.Name == wire.Err {
+				errs++
+				op = c.read()
+			}
+
+			if errs == 3 && op.Name == wire.Pong {
+				t.Logf("\t%s\tTest %d:\tShould report each error and carry on.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould report each error and carry on : %d errors, then %+v", failed, testID, errs, op)
+			}
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package pubsub
+
+import (
+	"errors"
+	"strings"
+)
+
+// Keys are subjects made of tokens separated by dots, like orders.eu.created.
+// A subscription can use wildcards in place of whole tokens: * matches any
+// single token and > matches one or more tokens at the end.
+//
+//	orders.*.created  matches orders.eu.created but not orders.created
+//	orders.>          matches orders.eu and orders.eu.created but not orders
+const (
+	wildcardOne  = "*"
+	wildcardRest = ">"
+)
+
+// checkSubject validates a key to publish to, which can't have wildcards.
+func checkSubject(key string) error {
+	if key == "" {
+		return errors.New("pubsub: empty key")
+	}
+
+	for _, tok := range strings.Split(key, ".") {
+		switch tok {
+		case "":
+			return errors.New("pubsub: empty token in " + key)
+		case wildcardOne, wildcardRest:
+			return errors.New("pubsub: wildcard in " + key)
+		}
+	}
+
+	return nil
+}
+
+// checkPattern validates a key to subscribe to.
+func checkPattern(key string) error {
+	if key == "" {
+		return errors.New("pubsub: empty key")
+	}
+
+	toks := strings.Split(key, ".")
+	for i, tok := range toks {
+		switch {
+		case tok == "":
+			return errors.New("pubsub: empty token in " + key)
+		case tok == wildcardRest && i != len(toks)-1:
+			return errors.New("pubsub: > isn't the last token of " + key)
+		}
+	}
+
+	return nil
+}
+
+// wildcard reports whether a pattern has wildcards.
+func wildcard(key string) bool {
+	for _, tok := range strings.Split(key, ".") {
+		if tok == wildcardOne || tok == wildcardRest {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether subject matches pattern.
+func Match(pattern, subject string) bool {
+	for {
+		ptok, prest, pmore := strings.Cut(pattern, ".")
+		if ptok == wildcardRest {
+			return subject != ""
+		}
+
+		stok, srest, smore := strings.Cut(subject, ".")
+		if ptok != wildcardOne && ptok != stok {
+			return false
+		}
+		if !pmore || !smore {
+			return pmore == smore
+		}
+
+		pattern, subject = prest, srest
+	}
+}
+
+// =============================================================================
+
+// subjects is a trie of the patterns subscribed to, with a level for each
+// token. Finding the subscribers of a subject walks one path per wildcard
+// that matches on the way, so it costs the length of the subject and the
+// matches instead of the number of patterns.
+type subjects struct {
+	root snode
+}
+
+// snode is a level of the trie. Wildcards are children like any other
+// token.
+type snode struct {
+	next map[string]*snode
+	subs map[subscriber]bool // Subscribers of the pattern ending here.
+}
+
+// add adds sub to the subscribers of pattern.
+func (t *subjects) add(pattern string, sub subscriber) {
+	n := &t.root
+	for _, tok := range strings.Split(pattern, ".") {
+		c, ok := n.next[tok]
+		if !ok {
+			if n.next == nil {
+				n.next = make(map[string]*snode)
+			}
+			c = &snode{}
+			n.next[tok] = c
+		}
+		n = c
+	}
+
+	if n.subs == nil {
+		n.subs = make(map[subscriber]bool)
+	}
+	n.subs[sub] = true
+}
+
+// remove removes sub from the subscribers of pattern, pruning the levels
+// left empty.
+func (t *subjects) remove(pattern string, sub subscriber) {
+	toks := strings.Split(pattern, ".")
+	path := make([]*snode, 0, len(toks)+1)
+
+	n := &t.root
+	path = append(path, n)
+	for _, tok := range toks {
+		c, ok := n.next[tok]
+		if !ok {
+			return
+		}
+		n = c
+		path = append(path, n)
+	}
+	delete(n.subs, sub)
+
+	for i := len(toks); i > 0; i-- {
+		n := path[i]
+		if len(n.subs) > 0 || len(n.next) > 0 {
+			return
+		}
+		delete(path[i-1].next, toks[i-1])
+	}
+}
+
+// count returns the number of subscribers of pattern itself.
+func (t *subjects) count(pattern string) int {
+	n := &t.root
+	for _, tok := range strings.Split(pattern, ".") {
+		c, ok := n.next[tok]
+		if !ok {
+			return 0
+		}
+		n = c
+	}
+	return len(n.subs)
+}
+
+// match calls visit for the subscribers of every pattern subject matches.
+// A subscriber of several matching patterns is visited for each.
+func (t *subjects) match(subject string, visit func(sub subscriber)) {
+	t.root.match(strings.Split(subject, "."), visit)
+}
+
+// match matches the tokens left against the levels below n.
+func (n *snode) match(toks []string, visit func(sub subscriber)) {
+	if len(toks) == 0 {
+		for sub := range n.subs {
+			visit(sub)
+		}
+		return
+	}
+
+	if c, ok := n.next[wildcardRest]; ok {
+		for sub := range c.subs {
+			visit(sub)
+		}
+	}
+	if c, ok := n.next[wildcardOne]; ok {
+		c.match(toks[1:], visit)
+	}
+	if c, ok := n.next[toks[0]]; ok {
+		c.match(toks[1:], visit)
+	}
+}
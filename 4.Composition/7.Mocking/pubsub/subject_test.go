@@ -0,0 +1,131 @@
+package pubsub_test
+
+import (
+	"testing"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/7.Mocking/pubsub"
+	"github.com/arjun1malhotra/a-labs-go/911.Testing/leaktest"
+)
+
+// TestMatch validates the wildcards of patterns.
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		subject string
+		match   bool
+	}{
+		{"orders", "orders", true},
+		{"orders", "orders.created", false},
+		{"orders.*.created", "orders.eu.created", true},
+		{"orders.*.created", "orders.created", false},
+		{"orders.*.created", "orders.eu.west.created", false},
+		{"orders.*", "orders", false},
+		{"orders.>", "orders.eu", true},
+		{"orders.>", "orders.eu.created", true},
+		{"orders.>", "orders", false},
+		{">", "orders", true},
+		{"*.*.created", "orders.eu.created", true},
+		{"*.eu.>", "orders.us.created", false},
+	}
+
+	t.Log("Given the need to match subjects against patterns.")
+	{
+		for testID, tt := range tests {
+			t.Logf("\tTest %d:\tWhen matching %q against %q.", testID, tt.subject, tt.pattern)
+			{
+				if got := pubsub.Match(tt.pattern, tt.subject); got == tt.match {
+					t.Logf("\t%s\tTest %d:\tShould report %v.", succeed, testID, tt.match)
+				} else {
+					t.Errorf("\t%s\tTest %d:\tShould report %v.", failed, testID, tt.match)
+				}
+			}
+		}
+	}
+}
+
+// TestWildcard validates messages reach the subscribers of every pattern
+// their key matches.
+func TestWildcard(t *testing.T) {
+	leaktest.Check(t)
+
+	b, err := pubsub.NewBroker(t.Name(), 0)
+	if err != nil {
+		t.Fatalf("Should be able to create a broker : %v", err)
+	}
+	defer b.Close()
+
+	t.Log("Given the need to subscribe to families of keys.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen clients subscribe with wildcards.", testID)
+		{
+			pub := pubsub.New(t.Name())
+			created := pubsub.New(t.Name())
+			all := pubsub.New(t.Name())
+			created.Subscribe("orders.*.created")
+			all.Subscribe("orders.>")
+			all.Subscribe("orders.eu.*")
+
+			pub.Publish("orders.eu.created", 1)
+			pub.Publish("orders.eu.shipped", 2)
+			pub.Publish("invoices.eu.created", 3)
+
+			if m := receive(t, created); m.Value == 1 && m.Key == "orders.eu.created" && len(created.Messages()) == 0 {
+				t.Logf("\t%s\tTest %d:\tShould deliver the keys matching a single token.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould deliver the keys matching a single token : %+v", failed, testID, m)
+			}
+
+			m1, m2 := receive(t, all), receive(t, all)
+			if m1.Value == 1 && m2.Value == 2 && len(all.Messages()) == 0 {
+				t.Logf("\t%s\tTest %d:\tShould deliver once to a client of several matching patterns.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould deliver once to a client of several matching patterns : %+v %+v", failed, testID, m1, m2)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen a subscription is cancelled.", testID)
+		{
+			sub := pubsub.New(t.Name())
+			sub.Subscribe("payments.*")
+			sub.Unsubscribe("payments.*")
+			pubsub.New(t.Name()).Publish("payments.card", "late")
+
+			select {
+			case m := <-sub.Messages():
+				t.Errorf("\t%s\tTest %d:\tShould not deliver after unsubscribing : %+v", failed, testID, m)
+			default:
+				if b.Subscribers("payments.*") == 0 {
+					t.Logf("\t%s\tTest %d:\tShould not deliver after unsubscribing.", succeed, testID)
+				} else {
+					t.Errorf("\t%s\tTest %d:\tShould not deliver after unsubscribing.", failed, testID)
+				}
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen keys are invalid.", testID)
+		{
+			ps := pubsub.New(t.Name())
+			errs := []error{
+				ps.Publish("orders.*", 1),
+				ps.Publish("orders..created", 1),
+				ps.Subscribe("orders.>.created"),
+				ps.Subscribe(""),
+			}
+
+			ok := true
+			for _, err := range errs {
+				if err == nil {
+					ok = false
+				}
+			}
+			if ok {
+				t.Logf("\t%s\tTest %d:\tShould refuse them.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould refuse them : %v", failed, testID, errs)
+			}
+		}
+	}
+}
@@ -0,0 +1,458 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/arjun1malhotra/a-labs-go/9.Channels/clock"
+)
+
+// Defaults for the options of a subscription.
+const (
+	DefaultAckTimeout    = 30 * time.Second
+	DefaultMaxDeliveries = 5
+)
+
+// SubscribeOptions configures a subscription.
+type SubscribeOptions struct {
+	// Handler, when set, is called with every delivery, one at a time,
+	// instead of the deliveries being sent on C. Returning nil acks the
+	// delivery and returning an error nacks it. Its context is cancelled
+	// when the subscription ends.
+	Handler func(ctx context.Context, d *Delivery) error
+
+	Buffer        int           // Messages waiting to be delivered. Zero means the broker's buffer.
+	AckTimeout    time.Duration // How long a delivery can go unacked before it's redelivered. Zero means DefaultAckTimeout.
+	MaxDeliveries int           // Deliveries of a message before it's dead-lettered. Zero means DefaultMaxDeliveries.
+
+	// DeadLetterKey is the key dead-lettered messages are published to as
+	// DeadLetter values. They are only counted when it is empty.
+	DeadLetterKey string
+
+	// From is where a subscription to a durable topic starts reading.
+	// Other topics can only be read from the latest message. A member of
+	// a group only uses it for partitions the group committed nothing for.
+	From Position
+
+	// Group makes the subscription a member of the named group of a
+	// durable topic, sharing its partitions with the other members.
+	Group string
+
+	// Clock is the clock timing the acks. Zero means the real clock.
+	Clock clock.Clock
+}
+
+// DeadLetter is published to the dead letter key of a subscription for a
+// message that wasn't acked after the maximum number of deliveries.
+type DeadLetter struct {
+	Message    Message
+	Deliveries int
+}
+
+// SubscriptionStats describes what a subscription did with its messages.
+type SubscriptionStats struct {
+	Delivered    int // Deliveries, counting redeliveries.
+	Redelivered  int
+	Acked        int
+	DeadLettered int
+	Dropped      int // Messages dropped because the buffer was full.
+}
+
+// Delivery is a message handed to a subscriber. It has to be acked once it
+// was handled, or it is delivered again after the ack timeout.
+type Delivery struct {
+	Message
+	Attempt int // 1 for the first delivery of the message.
+
+	id  uint64
+	sub *Subscription
+}
+
+// Ack reports the message was handled. Acking a delivery that was already
+// settled, or that timed out and was delivered again, does nothing.
+func (d *Delivery) Ack() error {
+	return d.sub.settle(d.id, true)
+}
+
+// Nack reports the message couldn't be handled, so it is delivered again
+// right away, or dead-lettered once it was delivered the maximum number of
+// times.
+func (d *Delivery) Nack() error {
+	return d.sub.settle(d.id, false)
+}
+
+// =============================================================================
+
+// Subscription receives the messages for a key with at-least-once
+// delivery. A message stays with the subscription until a delivery of it
+// is acked: a delivery that is nacked or not acked in time is made again,
+// after the messages already waiting, up to the maximum number of
+// deliveries.
+type Subscription struct {
+	// Counters first, so they are aligned for atomic use on 32-bit systems.
+	delivered    uint64
+	redelivered  uint64
+	acked        uint64
+	deadLettered uint64
+	dropped      uint64
+
+	ps      *PubSub
+	key     string
+	timeout time.Duration
+	max     int
+	dead    string
+	clock   clock.Clock
+
+	// A durable topic feeds in from its logs instead of the broker.
+	topic *durable
+	group *group
+	from  Position
+	wg    sync.WaitGroup
+
+	in   chan Message
+	out  chan *Delivery
+	acks chan ack
+	ids  uint64
+
+	// stopped is guarded by the lock of the broker.
+	stopped bool
+	stop    chan struct{}
+	done    chan struct{}
+
+	mu  sync.Mutex
+	err error // Why the subscription ended on its own.
+}
+
+// ack is the outcome of a delivery.
+type ack struct {
+	id uint64
+	ok bool
+}
+
+// inflight is a delivery waiting for its ack.
+type inflight struct {
+	d       *Delivery
+	due     time.Time
+	settled bool
+}
+
+// SubscribeWith sets up a subscription to the specified key. It ends when
+// ctx is done, when it is unsubscribed, when the client is closed or when
+// the log of a partition it reads fails, which Err reports. A key
+// with wildcards receives the messages published from then on for the keys
+// it matches, durable or not. It isn't available to a client of a server.
+func (ps *PubSub) SubscribeWith(ctx context.Context, key string, opts SubscribeOptions) (*Subscription, error) {
+	if err := checkPattern(key); err != nil {
+		return nil, err
+	}
+	if ps.remote != nil {
+		return nil, errors.New("pubsub: subscriptions with acks need a broker in the process")
+	}
+
+	s := Subscription{
+		ps:      ps,
+		key:     key,
+		timeout: opts.AckTimeout,
+		max:     opts.MaxDeliveries,
+		dead:    opts.DeadLetterKey,
+		clock:   opts.Clock,
+		out:     make(chan *Delivery),
+		acks:    make(chan ack),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if s.timeout <= 0 {
+		s.timeout = DefaultAckTimeout
+	}
+	if s.max <= 0 {
+		s.max = DefaultMaxDeliveries
+	}
+	if s.clock == nil {
+		s.clock = clock.New()
+	}
+
+	buffer := opts.Buffer
+	if buffer <= 0 {
+		buffer = ps.broker.buffer
+	}
+	s.in = make(chan Message, buffer)
+
+	if !wildcard(key) {
+		s.topic = ps.broker.topic(key)
+	}
+	s.from = opts.From
+	if s.topic == nil && (opts.From.from != fromLatest || opts.Group != "") {
+		return nil, errors.New("pubsub: " + key + " isn't durable")
+	}
+
+	if opts.Group != "" {
+		g, err := ps.broker.group(s.topic, opts.Group)
+		if err != nil {
+			return nil, err
+		}
+		s.group = g
+	}
+
+	if err := ps.broker.attach(ps, &s); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	go s.run(ctx, cancel)
+
+	if opts.Handler != nil {
+		go func() {
+			for d := range s.out {
+				if err := opts.Handler(ctx, d); err != nil {
+					d.Nack()
+					continue
+				}
+				d.Ack()
+			}
+		}()
+	}
+
+	return &s, nil
+}
+
+// C returns the channel the deliveries are sent on. It is closed when the
+// subscription ends. Nothing is sent on it when the subscription has a
+// handler.
+func (s *Subscription) C() <-chan *Delivery {
+	return s.out
+}
+
+// Key returns the key the subscription is for.
+func (s *Subscription) Key() string {
+	return s.key
+}
+
+// Unsubscribe ends the subscription. The messages that weren't acked are
+// dropped. A call of the handler that is in progress runs to its end.
+func (s *Subscription) Unsubscribe() error {
+	s.ps.broker.detach(s)
+	<-s.done
+	return nil
+}
+
+// Partitions returns the partitions of a durable topic the subscription
+// reads. For a member of a group they change as members join and leave.
+func (s *Subscription) Partitions() []int {
+	if s.group != nil {
+		return s.group.partitions(s)
+	}
+	if s.topic == nil {
+		return nil
+	}
+
+	parts := make([]int, len(s.topic.parts))
+	for i := range parts {
+		parts[i] = i
+	}
+	return parts
+}
+
+// Done returns a channel that is closed once the subscription ended.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns the error that ended the subscription. It is nil while the
+// subscription runs and after it ended any other way.
+func (s *Subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err
+}
+
+// fail ends the subscription because of err, unless it ended already.
+func (s *Subscription) fail(err error) {
+	select {
+	case <-s.stop:
+		return
+	default:
+	}
+
+	s.mu.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.mu.Unlock()
+
+	s.ps.broker.detach(s)
+}
+
+// Stats returns what the subscription did with its messages so far.
+func (s *Subscription) Stats() SubscriptionStats {
+	return SubscriptionStats{
+		Delivered:    int(atomic.LoadUint64(&s.delivered)),
+		Redelivered:  int(atomic.LoadUint64(&s.redelivered)),
+		Acked:        int(atomic.LoadUint64(&s.acked)),
+		DeadLettered: int(atomic.LoadUint64(&s.deadLettered)),
+		Dropped:      int(atomic.LoadUint64(&s.dropped)),
+	}
+}
+
+// deliver hands a message to the subscription without waiting, dropping
+// it if the buffer is full. The broker's lock is held. Messages of a
+// durable topic are read from its log instead.
+func (s *Subscription) deliver(m Message) {
+	if s.topic != nil {
+		return
+	}
+
+	select {
+	case s.in <- m:
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+	}
+}
+
+// shutdown stops the subscription, handing its partitions to the other
+// members of its group. The broker's lock is held.
+func (s *Subscription) shutdown() {
+	if !s.stopped {
+		s.stopped = true
+		if s.group != nil {
+			s.group.leave(s)
+		}
+		close(s.stop)
+	}
+}
+
+// settle sends the outcome of a delivery to the subscription.
+func (s *Subscription) settle(id uint64, ok bool) error {
+	select {
+	case s.acks <- ack{id: id, ok: ok}:
+		return nil
+	case <-s.done:
+		return ErrClosed
+	}
+}
+
+// run hands the messages out and keeps track of the deliveries until the
+// subscription ends. Only a single message waits in ready at a time unless
+// deliveries are being made again, so the buffer bounds what is held.
+func (s *Subscription) run(ctx context.Context, cancel context.CancelFunc) {
+	defer close(s.done)
+
+	// Every way out closes stop, which ends reading the logs, and the
+	// subscription left its group by then so no more are started.
+	defer s.wg.Wait()
+
+	defer close(s.out)
+	defer cancel()
+
+	timer := s.clock.NewTimer(s.timeout)
+	timer.Stop()
+	defer timer.Stop()
+
+	var (
+		ready   []*Delivery
+		flights = make(map[uint64]*inflight)
+		order   []*inflight // By due time, since the timeout doesn't change.
+		armed   *inflight
+	)
+
+	for {
+		var in <-chan Message
+		var out chan *Delivery
+		var next *Delivery
+		if len(ready) > 0 {
+			out, next = s.out, ready[0]
+		} else {
+			in = s.in
+		}
+
+		select {
+		case m := <-in:
+			ready = append(ready, s.delivery(m, 1))
+
+		case out <- next:
+			ready = ready[1:]
+			f := inflight{d: next, due: s.clock.Now().Add(s.timeout)}
+			flights[next.id] = &f
+			order = append(order, &f)
+
+			atomic.AddUint64(&s.delivered, 1)
+			if next.Attempt > 1 {
+				atomic.AddUint64(&s.redelivered, 1)
+			}
+
+		case a := <-s.acks:
+			f, ok := flights[a.id]
+			if !ok {
+				continue
+			}
+			delete(flights, a.id)
+			f.settled = true
+
+			if a.ok {
+				atomic.AddUint64(&s.acked, 1)
+				if c := f.d.claim; c != nil {
+					c.settle(f.d.Offset)
+				}
+			} else {
+				ready = s.retry(ready, f.d)
+			}
+
+		case <-timer.C():
+			armed = nil
+			now := s.clock.Now()
+			for len(order) > 0 && (order[0].settled || !order[0].due.After(now)) {
+				f := order[0]
+				order = order[1:]
+				if f.settled {
+					continue
+				}
+				delete(flights, f.d.id)
+				ready = s.retry(ready, f.d)
+			}
+
+		case <-ctx.Done():
+			s.ps.broker.detach(s)
+			return
+
+		case <-s.stop:
+			return
+		}
+
+		for len(order) > 0 && order[0].settled {
+			order = order[1:]
+		}
+		if len(order) > 0 && order[0] != armed {
+			armed = order[0]
+			timer.Reset(armed.due.Sub(s.clock.Now()))
+		}
+	}
+}
+
+// delivery returns a new delivery of m.
+func (s *Subscription) delivery(m Message, attempt int) *Delivery {
+	s.ids++
+	return &Delivery{Message: m, Attempt: attempt, id: s.ids, sub: s}
+}
+
+// retry queues d to be delivered again, or dead-letters its message when
+// it was delivered the maximum number of times.
+func (s *Subscription) retry(ready []*Delivery, d *Delivery) []*Delivery {
+	if d.Attempt < s.max {
+		return append(ready, s.delivery(d.Message, d.Attempt+1))
+	}
+
+	atomic.AddUint64(&s.deadLettered, 1)
+	if s.dead != "" {
+		m := d.Message
+		m.claim = nil
+		s.ps.broker.publish(s.ps, s.dead, d.ID, DeadLetter{Message: m, Deliveries: d.Attempt})
+	}
+	if c := d.claim; c != nil {
+		c.settle(d.Offset)
+	}
+
+	return ready
+}
@@ -0,0 +1,214 @@
+package pubsub_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/7.Mocking/pubsub"
+	"github.com/arjun1malhotra/a-labs-go/9.Channels/clock"
+	"github.com/arjun1malhotra/a-labs-go/911.Testing/leaktest"
+)
+
+// next returns the next delivery of a subscription or fails the test.
+func next(t *testing.T, s *pubsub.Subscription) *pubsub.Delivery {
+	t.Helper()
+
+	select {
+	case d, ok := <-s.C():
+		if !ok {
+			t.Fatal("Should receive a delivery : subscription ended")
+		}
+		return d
+	case <-time.After(time.Second):
+		t.Fatal("Should receive a delivery : timed out")
+	}
+	return nil
+}
+
+// TestAck validates deliveries are made again until they are acked and
+// dead-lettered after the maximum number of deliveries.
+func TestAck(t *testing.T) {
+	leaktest.Check(t)
+
+	b, err := pubsub.NewBroker(t.Name(), 0)
+	if err != nil {
+		t.Fatalf("Should be able to create a broker : %v", err)
+	}
+	defer b.Close()
+
+	t.Log("Given the need to deliver messages until they are handled.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the subscriber acks.", testID)
+		{
+			pub := pubsub.New(t.Name())
+			sub, err := pubsub.New(t.Name()).SubscribeWith(context.Background(), "orders", pubsub.SubscribeOptions{})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould subscribe : %v", failed, testID, err)
+			}
+
+			pub.Publish("orders", 1)
+			d := next(t, sub)
+			if d.Value != 1 || d.Attempt != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould deliver the message : %+v", failed, testID, d)
+			}
+			d.Ack()
+			sub.Unsubscribe()
+
+			if st := sub.Stats(); st.Acked == 1 && st.Delivered == 1 {
+				t.Logf("\t%s\tTest %d:\tShould count the ack.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould count the ack : %+v", failed, testID, st)
+			}
+
+			if _, ok := <-sub.C(); !ok && b.Subscribers("orders") == 0 {
+				t.Logf("\t%s\tTest %d:\tShould end the subscription.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould end the subscription.", failed, testID)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen the subscriber never acks.", testID)
+		{
+			clk := clock.NewFake(time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC))
+
+			pub := pubsub.New(t.Name())
+			dead := pubsub.New(t.Name())
+			dead.Subscribe("orders.dead")
+
+			sub, err := pubsub.New(t.Name()).SubscribeWith(context.Background(), "orders", pubsub.SubscribeOptions{
+				AckTimeout:    time.Minute,
+				MaxDeliveries: 3,
+				DeadLetterKey: "orders.dead",
+				Clock:         clk,
+			})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould subscribe : %v", failed, testID, err)
+			}
+			defer sub.Unsubscribe()
+
+			pub.Publish("orders", "lost")
+			for attempt := 1; attempt <= 3; attempt++ {
+				d := next(t, sub)
+				if d.Value != "lost" || d.Attempt != attempt {
+					t.Fatalf("\t%s\tTest %d:\tShould deliver the message again : %+v", failed, testID, d)
+				}
+
+				clk.BlockUntil(1)
+				clk.Advance(time.Minute)
+			}
+			t.Logf("\t%s\tTest %d:\tShould deliver the message again after the ack timeout.", succeed, testID)
+
+			m := receive(t, dead)
+			if dl, ok := m.Value.(pubsub.DeadLetter); ok && dl.Message.Value == "lost" && dl.Deliveries == 3 {
+				t.Logf("\t%s\tTest %d:\tShould dead-letter the message.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould dead-letter the message : %+v", failed, testID, m)
+			}
+
+			if st := sub.Stats(); st.Delivered == 3 && st.Redelivered == 2 && st.DeadLettered == 1 && st.Acked == 0 {
+				t.Logf("\t%s\tTest %d:\tShould count the redeliveries.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould count the redeliveries : %+v", failed, testID, st)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen a handler fails on the first delivery.", testID)
+		{
+			pub := pubsub.New(t.Name())
+
+			handled := make(chan int, 2)
+			sub, err := pubsub.New(t.Name()).SubscribeWith(context.Background(), "payments", pubsub.SubscribeOptions{
+				Handler: func(ctx context.Context, d *pubsub.Delivery) error {
+					handled <- d.Attempt
+					if d.Attempt == 1 {
+						return errors.New("payment service unavailable")
+					}
+					return nil
+				},
+			})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould subscribe : %v", failed, testID, err)
+			}
+
+			pub.Publish("payments", 42)
+			<-handled
+			<-handled
+
+			deadline := time.Now().Add(time.Second)
+			for sub.Stats().Acked == 0 && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			sub.Unsubscribe()
+
+			if st := sub.Stats(); st.Acked == 1 && st.Redelivered == 1 {
+				t.Logf("\t%s\tTest %d:\tShould nack on an error and ack on success.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould nack on an error and ack on success : %+v", failed, testID, st)
+			}
+		}
+	}
+}
+
+// TestSubscriptionLifetime validates a subscription ends with its context
+// and its client.
+func TestSubscriptionLifetime(t *testing.T) {
+	leaktest.Check(t)
+
+	b, err := pubsub.NewBroker(t.Name(), 0)
+	if err != nil {
+		t.Fatalf("Should be able to create a broker : %v", err)
+	}
+	defer b.Close()
+
+	t.Log("Given the need to scope a subscription.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the context of the subscription is cancelled.", testID)
+		{
+			ctx, cancel := context.WithCancel(context.Background())
+			sub, err := pubsub.New(t.Name()).SubscribeWith(ctx, "orders", pubsub.SubscribeOptions{})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould subscribe : %v", failed, testID, err)
+			}
+
+			pubsub.New(t.Name()).Publish("orders", 1)
+			d := next(t, sub)
+			cancel()
+			<-sub.Done()
+
+			if err := d.Ack(); err == pubsub.ErrClosed && b.Subscribers("orders") == 0 {
+				t.Logf("\t%s\tTest %d:\tShould end the subscription.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould end the subscription : %v", failed, testID, err)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen the client is closed.", testID)
+		{
+			ps := pubsub.New(t.Name())
+			sub, err := ps.SubscribeWith(context.Background(), "orders", pubsub.SubscribeOptions{})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould subscribe : %v", failed, testID, err)
+			}
+			ps.Close()
+
+			if _, ok := <-sub.C(); !ok && b.Subscribers("orders") == 0 {
+				t.Logf("\t%s\tTest %d:\tShould end the subscription.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould end the subscription.", failed, testID)
+			}
+
+			if _, err := ps.SubscribeWith(context.Background(), "orders", pubsub.SubscribeOptions{}); err == pubsub.ErrClosed {
+				t.Logf("\t%s\tTest %d:\tShould refuse to subscribe.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould refuse to subscribe : %v", failed, testID, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,210 @@
+// Package wire is the protocol pubsub clients speak to a pubsubd server over
+// TCP. It is a text protocol of lines ending in CRLF. A line starts with the
+// name of an operation followed by its arguments, separated by spaces. The
+// operations carrying a payload end the line with the size of the payload in
+// bytes, and the payload follows it, ending in CRLF too.
+//
+//	CONNECT <size>                                  client introduces itself with a JSON Connect
+//	PUB <subject> [id] <size>                       client publishes a JSON value
+//	SUB <subject> <sid>                             client subscribes, naming the subscription sid
+//	UNSUB <sid>                                     client cancels a subscription
+//	MSG <subject> <sid> <seq> <published> [id] <size>  server delivers a message
+//	PING                                            either side checks the other is there
+//	PONG                                            answers a PING
+//	-ERR <message>                                  server reports an error
+//
+// A client starts with CONNECT. The server answers a PING once it handled
+// everything sent before it, so a client knows a SUB followed by a PING
+// is in place when the PONG arrives.
+package wire
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// The operations of the protocol.
+const (
+	Connect = "CONNECT"
+	Pub     = "PUB"
+	Sub     = "SUB"
+	Unsub   = "UNSUB"
+	Msg     = "MSG"
+	Ping    = "PING"
+	Pong    = "PONG"
+	Err     = "-ERR"
+)
+
+// MaxLine is the longest line, payload aside, a peer accepts.
+const MaxLine = 4096
+
+// MaxPayload is the largest payload a peer accepts.
+const MaxPayload = 1 << 20
+
+var (
+	// ErrLineSize is returned for a line longer than MaxLine.
+	ErrLineSize = errors.New("wire: line too long")
+
+	// ErrPayloadSize is returned for a payload larger than MaxPayload.
+	ErrPayloadSize = errors.New("wire: payload too large")
+)
+
+// Op is an operation as it travels. Args don't include the size of the
+// payload, which the Writer adds and the Reader takes off.
+type Op struct {
+	Name    string
+	Args    []string
+	Payload []byte
+}
+
+// ConnectInfo is the payload of CONNECT.
+type ConnectInfo struct {
+	Name string `json:"name,omitempty"` // Name of the client, for the logs of the server.
+}
+
+// payload reports whether the operation carries a payload.
+func payload(name string) bool {
+	switch name {
+	case Connect, Pub, Msg:
+		return true
+	}
+	return false
+}
+
+// =============================================================================
+
+// Reader reads operations from a stream.
+type Reader struct {
+	r *bufio.Reader
+}
+
+// NewReader constructs a reader for r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReaderSize(r, MaxLine)}
+}
+
+// Read reads the next operation. Empty lines are skipped.
+func (r *Reader) Read() (Op, error) {
+	var line []byte
+	for len(line) == 0 {
+		l, err := r.r.ReadSlice('\n')
+		switch {
+		case err == bufio.ErrBufferFull:
+			return Op{}, ErrLineSize
+		case err == io.EOF && len(l) > 0:
+			return Op{}, io.ErrUnexpectedEOF
+		case err != nil:
+			return Op{}, err
+		}
+		line = bytes.TrimSuffix(bytes.TrimSuffix(l, []byte("\n")), []byte("\r"))
+	}
+
+	name, rest, _ := strings.Cut(string(line), " ")
+	op := Op{Name: strings.ToUpper(name)}
+
+	if op.Name == Err {
+		op.Args = []string{rest}
+		return op, nil
+	}
+	op.Args = strings.Fields(rest)
+
+	if !payload(op.Name) {
+		return op, nil
+	}
+
+	if len(op.Args) == 0 {
+		return Op{}, fmt.Errorf("wire: %s without a size", op.Name)
+	}
+	n, err := strconv.Atoi(op.Args[len(op.Args)-1])
+	switch {
+	case err != nil || n < 0:
+		return Op{}, fmt.Errorf("wire: bad size for %s", op.Name)
+	case n > MaxPayload:
+		return Op{}, ErrPayloadSize
+	}
+	op.Args = op.Args[:len(op.Args)-1]
+
+	buf := make([]byte, n+2)
+	if _, err := io.ReadFull(r.r, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return Op{}, err
+	}
+	if !bytes.HasSuffix(buf, []byte("\r\n")) {
+		return Op{}, fmt.Errorf("wire: payload of %s doesn't end the line", op.Name)
+	}
+	op.Payload = buf[:n]
+
+	return op, nil
+}
+
+// =============================================================================
+
+// Writer writes operations to a stream. Operations are buffered until
+// Flush is called.
+type Writer struct {
+	w *bufio.Writer
+}
+
+// NewWriter constructs a writer for w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// Write writes an operation. Nothing is written when the operation can't
+// travel: an argument is empty or has white space in it, or the line or
+// payload is too long.
+func (w *Writer) Write(op Op) error {
+	if op.Name == "" || strings.ContainsAny(op.Name, " \t\r\n") {
+		return fmt.Errorf("wire: bad operation %q", op.Name)
+	}
+
+	size := len(op.Name)
+	for _, arg := range op.Args {
+		switch {
+		case op.Name == Err && strings.ContainsAny(arg, "\r\n"):
+			return fmt.Errorf("wire: bad argument %q to %s", arg, op.Name)
+		case op.Name != Err && (arg == "" || strings.ContainsAny(arg, " \t\r\n")):
+			return fmt.Errorf("wire: bad argument %q to %s", arg, op.Name)
+		}
+		size += 1 + len(arg)
+	}
+
+	var n string
+	if payload(op.Name) {
+		if len(op.Payload) > MaxPayload {
+			return ErrPayloadSize
+		}
+		n = strconv.Itoa(len(op.Payload))
+		size += 1 + len(n)
+	}
+	if size+2 > MaxLine {
+		return ErrLineSize
+	}
+
+	w.w.WriteString(op.Name)
+	for _, arg := range op.Args {
+		w.w.WriteByte(' ')
+		w.w.WriteString(arg)
+	}
+	if n != "" {
+		w.w.WriteByte(' ')
+		w.w.WriteString(n)
+		w.w.WriteString("\r\n")
+		w.w.Write(op.Payload)
+	}
+	_, err := w.w.WriteString("\r\n")
+
+	return err
+}
+
+// Flush writes the buffered operations to the stream.
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
@@ -0,0 +1,115 @@
+package wire_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/arjun1malhotra/a-labs-go/4.Composition/7.Mocking/pubsub/wire"
+)
+
+const succeed = "\u2713"
+const failed = "\u2717"
+
+// TestOps validates operations survive the trip and bad lines are refused.
+func TestOps(t *testing.T) {
+	t.Log("Given the need to send operations over a stream.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen writing operations back to back.", testID)
+		{
+			ops := []wire.Op{
+				{Name: wire.Connect, Payload: []byte(`{"name":"billing"}`)},
+				{Name: wire.Sub, Args: []string{"orders.>", "1"}},
+				{Name: wire.Pub, Args: []string{"orders.eu", "order-7"}, Payload: []byte("{\"lines\":\"a\\r\\nb\"}")},
+				{Name: wire.Pub, Args: []string{"orders.us"}, Payload: []byte{}},
+				{Name: wire.Ping},
+				{Name: wire.Err, Args: []string{"unknown operation FOO"}},
+			}
+
+			var buf bytes.Buffer
+			w := wire.NewWriter(&buf)
+			for _, op := range ops {
+				if err := w.Write(op); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to write %s : %v", failed, testID, op.Name, err)
+				}
+			}
+			w.Flush()
+
+			if strings.HasPrefix(buf.String(), "CONNECT 18\r\n{\"name\":\"billing\"}\r\nSUB orders.> 1\r\n") {
+				t.Logf("\t%s\tTest %d:\tShould write lines of text with the size of the payloads.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould write lines of text with the size of the payloads : %q", failed, testID, buf.String())
+			}
+
+			r := wire.NewReader(&buf)
+			for _, want := range ops {
+				got, err := r.Read()
+				if err != nil || got.Name != want.Name || strings.Join(got.Args, "|") != strings.Join(want.Args, "|") || !bytes.Equal(got.Payload, want.Payload) {
+					t.Fatalf("\t%s\tTest %d:\tShould read %s back : %v %+v", failed, testID, want.Name, err, got)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould read the operations back.", succeed, testID)
+
+			if _, err := r.Read(); err == io.EOF {
+				t.Logf("\t%s\tTest %d:\tShould return io.EOF at the end.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould return io.EOF at the end : %v", failed, testID, err)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen reading bad lines.", testID)
+		{
+			lines := []struct {
+				name string
+				line string
+				err  error
+			}{
+				{"a long line", "PUB " + strings.Repeat("a", wire.MaxLine) + " 1\r\n", wire.ErrLineSize},
+				{"a large payload", "PUB orders 2000000\r\n", wire.ErrPayloadSize},
+				{"a short payload", "PUB orders 10\r\n{}\r\n", io.ErrUnexpectedEOF},
+				{"a cut line", "SUB orders", io.ErrUnexpectedEOF},
+				{"a payload too long", "PUB orders 2\r\n{}}\r\n", nil},
+				{"a missing size", "PUB orders.eu x\r\n", nil},
+			}
+
+			for _, l := range lines {
+				_, err := wire.NewReader(strings.NewReader(l.line)).Read()
+				if err != nil && (l.err == nil || err == l.err) {
+					t.Logf("\t%s\tTest %d:\tShould refuse %s : %v", succeed, testID, l.name, err)
+				} else {
+					t.Errorf("\t%s\tTest %d:\tShould refuse %s : got %v, want %v", failed, testID, l.name, err, l.err)
+				}
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen writing operations that can't travel.", testID)
+		{
+			ops := []wire.Op{
+				{Name: wire.Pub, Args: []string{"orders", "order 7"}},
+				{Name: wire.Sub, Args: []string{"", "1"}},
+				{Name: wire.Err, Args: []string{"two\r\nlines"}},
+				{Name: wire.Pub, Args: []string{"orders"}, Payload: make([]byte, wire.MaxPayload+1)},
+			}
+
+			var buf bytes.Buffer
+			w := wire.NewWriter(&buf)
+			ok := true
+			for _, op := range ops {
+				if err := w.Write(op); err == nil {
+					ok = false
+				}
+			}
+			w.Flush()
+
+			if ok && buf.Len() == 0 {
+				t.Logf("\t%s\tTest %d:\tShould refuse them without writing anything.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould refuse them without writing anything : %q", failed, testID, buf.String())
+			}
+		}
+	}
+}
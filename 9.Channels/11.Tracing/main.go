@@ -0,0 +1,76 @@
+/*
+	Reading thousands of "child : sent signal" lines is not a good way to understand how the goroutines
+	of a pattern interleave. What we really want is to see them on a timeline.
+
+	The trace package lets every goroutine ask for its own lane, "env.Trace.G("child 3")", and then record
+	spans of time (work, being blocked) and single events (send, receive, drop, cancel) on it.
+	The patterns package is already instrumented, so all we have to do is give the environment a tracer
+	and write the result out once the pattern returns.
+
+	The output is in the Chrome Trace Event Format. Open chrome://tracing or https://ui.perfetto.dev
+	and load the file.
+
+	go run . -pattern fanoutsem -out trace.json
+
+	With "fanoutsem" we can see the semaphore at work, only GOMAXPROCS lanes are doing work at any given
+	time and everybody else is sitting in a "wait for semaphore" block.
+	With "drop" we can see the parent's drops pile up on its lane as soon as the buffer fills up.
+*/
+
+// This sample program runs one of the channel patterns with tracing turned
+// on and writes the trace out for a trace viewer.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/arjun1malhotra/a-labs-go/9.Channels/patterns"
+	"github.com/arjun1malhotra/a-labs-go/9.Channels/trace"
+)
+
+func main() {
+	pattern := flag.String("pattern", "fanoutsem", "pattern to run: fanout, fanoutsem, pooling, bounded, drop, cancellation")
+	out := flag.String("out", "trace.json", "file to write the trace to")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "seed for the simulated latency")
+	flag.Parse()
+
+	env := patterns.NewEnv(*seed)
+	env.Out = io.Discard
+	env.Trace = trace.New(env.Clock)
+
+	switch *pattern {
+	case "fanout":
+		patterns.FanOut(env, 100)
+	case "fanoutsem":
+		patterns.FanOutSem(env, 100)
+	case "pooling":
+		patterns.Pooling(env, 100)
+	case "bounded":
+		patterns.BoundedWorkPooling(env, make([]string, 2000))
+	case "drop":
+		patterns.Drop(env, 100, 2000)
+	case "cancellation":
+		patterns.Cancellation(env, 150*time.Millisecond)
+	default:
+		fmt.Println("unknown pattern:", *pattern)
+		os.Exit(1)
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	if err := env.Trace.WriteJSON(f); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("seed %d : %d events written to %s\n", *seed, len(env.Trace.Events()), *out)
+}
@@ -0,0 +1,184 @@
+// Package clock provides an abstraction over the passing of time so the
+// channel patterns can be run against either the real wall clock or a fake
+// clock whose time is moved forward by hand inside a test.
+package clock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Clock represents the set of time behaviors the patterns depend on.
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	Sleep(d time.Duration)
+	After(d time.Duration) <-chan time.Time
+	AfterFunc(d time.Duration, f func()) Timer
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer represents a single event. When the Timer expires, the current time
+// will be sent on C, unless the Timer was created by AfterFunc.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// Ticker delivers ticks of a clock at intervals.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+	Reset(d time.Duration)
+}
+
+// =============================================================================
+
+// Real is a Clock backed by the time package.
+type Real struct{}
+
+// New returns a Clock backed by the time package.
+func New() Clock {
+	return Real{}
+}
+
+// Now returns the current local time.
+func (Real) Now() time.Time {
+	return time.Now()
+}
+
+// Since returns the time elapsed since t.
+func (Real) Since(t time.Time) time.Duration {
+	return time.Since(t)
+}
+
+// Sleep pauses the current goroutine for at least the duration d.
+func (Real) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// After waits for the duration to elapse and then sends the current time on
+// the returned channel.
+func (Real) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// AfterFunc waits for the duration to elapse and then calls f in its own
+// goroutine.
+func (Real) AfterFunc(d time.Duration, f func()) Timer {
+	return realTimer{time.AfterFunc(d, f)}
+}
+
+// NewTimer creates a new Timer that will send the current time on its
+// channel after at least duration d.
+func (Real) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+// NewTicker returns a new Ticker containing a channel that will send the
+// time with a period specified by the duration argument.
+func (Real) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+// realTimer adapts a time.Timer to the Timer interface.
+type realTimer struct {
+	t *time.Timer
+}
+
+func (r realTimer) C() <-chan time.Time        { return r.t.C }
+func (r realTimer) Stop() bool                 { return r.t.Stop() }
+func (r realTimer) Reset(d time.Duration) bool { return r.t.Reset(d) }
+
+// realTicker adapts a time.Ticker to the Ticker interface.
+type realTicker struct {
+	t *time.Ticker
+}
+
+func (r realTicker) C() <-chan time.Time   { return r.t.C }
+func (r realTicker) Stop()                 { r.t.Stop() }
+func (r realTicker) Reset(d time.Duration) { r.t.Reset(d) }
+
+// =============================================================================
+
+// WithTimeout behaves like context.WithTimeout except the deadline is
+// measured against the specified clock. With a fake clock the returned
+// context is only cancelled when the clock is advanced past the deadline.
+func WithTimeout(parent context.Context, c Clock, d time.Duration) (context.Context, context.CancelFunc) {
+	return WithDeadline(parent, c, c.Now().Add(d))
+}
+
+// WithDeadline behaves like context.WithDeadline except the deadline is
+// measured against the specified clock.
+func WithDeadline(parent context.Context, c Clock, deadline time.Time) (context.Context, context.CancelFunc) {
+	if _, ok := c.(Real); ok {
+		return context.WithDeadline(parent, deadline)
+	}
+
+	cctx, cancel := context.WithCancel(parent)
+	ctx := timerCtx{
+		Context:  cctx,
+		deadline: deadline,
+		expired:  new(expired),
+	}
+
+	d := deadline.Sub(c.Now())
+	if d <= 0 {
+		ctx.expired.set()
+		cancel()
+		return ctx, cancel
+	}
+
+	t := c.AfterFunc(d, func() {
+		ctx.expired.set()
+		cancel()
+	})
+
+	return ctx, func() {
+		t.Stop()
+		cancel()
+	}
+}
+
+// timerCtx is a cancel context that reports a deadline taken from a Clock.
+type timerCtx struct {
+	context.Context
+	deadline time.Time
+	expired  *expired
+}
+
+// Deadline returns the time when work done on behalf of this context
+// should be canceled.
+func (c timerCtx) Deadline() (time.Time, bool) {
+	return c.deadline, true
+}
+
+// Err reports DeadlineExceeded when the clock moved past the deadline.
+func (c timerCtx) Err() error {
+	err := c.Context.Err()
+	if err != nil && c.expired.get() {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+// expired records whether a timerCtx was cancelled by its timer.
+type expired struct {
+	mu sync.Mutex
+	ok bool
+}
+
+func (e *expired) set() {
+	e.mu.Lock()
+	e.ok = true
+	e.mu.Unlock()
+}
+
+func (e *expired) get() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.ok
+}
@@ -0,0 +1,231 @@
+package clock_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arjun1malhotra/a-labs-go/9.Channels/clock"
+)
+
+const succeed = "\u2713"
+const failed = "\u2717"
+
+var epoch = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// recv waits a short amount of real time for a value on the channel.
+func recv(ch <-chan time.Time) (time.Time, bool) {
+	select {
+	case t := <-ch:
+		return t, true
+	case <-time.After(time.Second):
+		return time.Time{}, false
+	}
+}
+
+// TestFakeSleep validates a sleeping goroutine only wakes up once the
+// fake clock is advanced past its duration.
+func TestFakeSleep(t *testing.T) {
+	t.Log("Given the need to control when a sleeping goroutine wakes up.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen sleeping for 200ms.", testID)
+		{
+			f := clock.NewFake(epoch)
+			done := make(chan struct{})
+
+			go func() {
+				f.Sleep(200 * time.Millisecond)
+				close(done)
+			}()
+
+			f.BlockUntil(1)
+			f.Advance(199 * time.Millisecond)
+
+			select {
+			case <-done:
+				t.Fatalf("\t%s\tTest %d:\tShould still be sleeping after 199ms.", failed, testID)
+			case <-time.After(10 * time.Millisecond):
+				t.Logf("\t%s\tTest %d:\tShould still be sleeping after 199ms.", succeed, testID)
+			}
+
+			f.Advance(time.Millisecond)
+
+			select {
+			case <-done:
+				t.Logf("\t%s\tTest %d:\tShould wake up after 200ms.", succeed, testID)
+			case <-time.After(time.Second):
+				t.Fatalf("\t%s\tTest %d:\tShould wake up after 200ms.", failed, testID)
+			}
+		}
+	}
+}
+
+// TestFakeTimer validates timers can be stopped and reset.
+func TestFakeTimer(t *testing.T) {
+	t.Log("Given the need to stop and reset timers on a fake clock.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen stopping a pending timer.", testID)
+		{
+			f := clock.NewFake(epoch)
+			tm := f.NewTimer(time.Second)
+
+			if !tm.Stop() {
+				t.Fatalf("\t%s\tTest %d:\tShould report the timer was pending.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould report the timer was pending.", succeed, testID)
+
+			f.Advance(time.Minute)
+			select {
+			case <-tm.C():
+				t.Errorf("\t%s\tTest %d:\tShould not fire once stopped.", failed, testID)
+			default:
+				t.Logf("\t%s\tTest %d:\tShould not fire once stopped.", succeed, testID)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen resetting a pending timer.", testID)
+		{
+			f := clock.NewFake(epoch)
+			tm := f.NewTimer(time.Second)
+			tm.Reset(3 * time.Second)
+
+			f.Advance(2 * time.Second)
+			select {
+			case <-tm.C():
+				t.Fatalf("\t%s\tTest %d:\tShould not fire at the original deadline.", failed, testID)
+			default:
+				t.Logf("\t%s\tTest %d:\tShould not fire at the original deadline.", succeed, testID)
+			}
+
+			f.Advance(time.Second)
+			got, ok := recv(tm.C())
+			if !ok {
+				t.Fatalf("\t%s\tTest %d:\tShould fire at the new deadline.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould fire at the new deadline.", succeed, testID)
+
+			if want := epoch.Add(3 * time.Second); got.Equal(want) {
+				t.Logf("\t%s\tTest %d:\tShould deliver the time it fired at.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould deliver the time it fired at : got %v, want %v", failed, testID, got, want)
+			}
+		}
+	}
+}
+
+// TestFakeTicker validates a ticker fires once per period crossed.
+func TestFakeTicker(t *testing.T) {
+	t.Log("Given the need to deliver ticks from a fake clock.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen advancing one period at a time.", testID)
+		{
+			f := clock.NewFake(epoch)
+			tk := f.NewTicker(time.Second)
+			defer tk.Stop()
+
+			for i := 1; i <= 3; i++ {
+				f.Advance(time.Second)
+				got, ok := recv(tk.C())
+				if !ok {
+					t.Fatalf("\t%s\tTest %d:\tShould receive tick %d.", failed, testID, i)
+				}
+				if want := epoch.Add(time.Duration(i) * time.Second); !got.Equal(want) {
+					t.Fatalf("\t%s\tTest %d:\tShould receive tick %d at %v : %v", failed, testID, i, want, got)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a tick for every period.", succeed, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen advancing several periods without reading.", testID)
+		{
+			f := clock.NewFake(epoch)
+			tk := f.NewTicker(time.Second)
+			defer tk.Stop()
+
+			f.Advance(5 * time.Second)
+
+			var ticks int
+			for {
+				if _, ok := recvNow(tk.C()); !ok {
+					break
+				}
+				ticks++
+			}
+
+			if ticks == 1 {
+				t.Logf("\t%s\tTest %d:\tShould drop ticks for a slow receiver.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould drop ticks for a slow receiver : got %d ticks", failed, testID, ticks)
+			}
+		}
+	}
+}
+
+// recvNow returns a value from the channel only if one is ready.
+func recvNow(ch <-chan time.Time) (time.Time, bool) {
+	select {
+	case t := <-ch:
+		return t, true
+	default:
+		return time.Time{}, false
+	}
+}
+
+// TestWithTimeout validates a context deadline follows the fake clock.
+func TestWithTimeout(t *testing.T) {
+	t.Log("Given the need to drive a context deadline from a fake clock.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen setting a 150ms timeout.", testID)
+		{
+			f := clock.NewFake(epoch)
+			ctx, cancel := clock.WithTimeout(context.Background(), f, 150*time.Millisecond)
+			defer cancel()
+
+			if d, ok := ctx.Deadline(); ok && d.Equal(epoch.Add(150*time.Millisecond)) {
+				t.Logf("\t%s\tTest %d:\tShould report the deadline from the clock.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould report the deadline from the clock : %v", failed, testID, d)
+			}
+
+			f.Advance(149 * time.Millisecond)
+			if ctx.Err() == nil {
+				t.Logf("\t%s\tTest %d:\tShould not be done before the deadline.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould not be done before the deadline : %v", failed, testID, ctx.Err())
+			}
+
+			f.Advance(time.Millisecond)
+			if ctx.Err() == context.DeadlineExceeded {
+				t.Logf("\t%s\tTest %d:\tShould exceed the deadline once advanced.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould exceed the deadline once advanced : %v", failed, testID, ctx.Err())
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen cancelling before the deadline.", testID)
+		{
+			f := clock.NewFake(epoch)
+			ctx, cancel := clock.WithTimeout(context.Background(), f, time.Second)
+			cancel()
+
+			if ctx.Err() == context.Canceled {
+				t.Logf("\t%s\tTest %d:\tShould report the context was canceled.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould report the context was canceled : %v", failed, testID, ctx.Err())
+			}
+
+			if f.Waiters() == 0 {
+				t.Logf("\t%s\tTest %d:\tShould release the timer.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould release the timer : %d waiters", failed, testID, f.Waiters())
+			}
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Fake is a Clock whose time only moves when Advance or Set is called. It
+// lets a test decide exactly when a sleeping goroutine wakes up or a timer
+// fires, so the outcome of a pattern no longer depends on the scheduler.
+type Fake struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	seq     int
+	waiters []*waiter
+}
+
+// waiter is a pending timer, ticker or sleep registered with a Fake clock.
+type waiter struct {
+	seq    int
+	when   time.Time
+	period time.Duration
+	ch     chan time.Time
+	fn     func()
+}
+
+// NewFake constructs a Fake clock set to the specified time.
+func NewFake(now time.Time) *Fake {
+	f := Fake{
+		now: now,
+	}
+	f.cond = sync.NewCond(&f.mu)
+
+	return &f
+}
+
+// Now returns the current time of the fake clock.
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.now
+}
+
+// Since returns the fake time elapsed since t.
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+// Sleep blocks until the clock has been advanced by at least d.
+func (f *Fake) Sleep(d time.Duration) {
+	<-f.After(d)
+}
+
+// After returns a channel that receives the fake time once the clock has
+// been advanced by at least d.
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	return f.NewTimer(d).C()
+}
+
+// AfterFunc calls fn once the clock has been advanced by at least d. Unlike
+// the time package, fn runs on the goroutine calling Advance, so its effects
+// are visible as soon as Advance returns.
+func (f *Fake) AfterFunc(d time.Duration, fn func()) Timer {
+	w := waiter{
+		fn: fn,
+	}
+	f.add(&w, d)
+
+	return &fakeTimer{f: f, w: &w}
+}
+
+// NewTimer creates a Timer that fires once the clock has been advanced by
+// at least d.
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	w := waiter{
+		ch: make(chan time.Time, 1),
+	}
+	f.add(&w, d)
+
+	return &fakeTimer{f: f, w: &w}
+}
+
+// NewTicker creates a Ticker that fires every time the clock moves across
+// a multiple of d. It panics if d is not positive, like time.NewTicker.
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+
+	w := waiter{
+		period: d,
+		ch:     make(chan time.Time, 1),
+	}
+	f.add(&w, d)
+
+	return &fakeTicker{f: f, w: &w}
+}
+
+// Advance moves the clock forward by d, firing every timer, ticker and
+// sleep whose deadline falls inside the window in deadline order.
+func (f *Fake) Advance(d time.Duration) {
+	f.Set(f.Now().Add(d))
+}
+
+// Set moves the clock to t, firing everything that is due on the way.
+// Moving the clock backwards only changes the value reported by Now.
+func (f *Fake) Set(t time.Time) {
+	for {
+		f.mu.Lock()
+		if len(f.waiters) == 0 || f.waiters[0].when.After(t) {
+			f.now = t
+			f.mu.Unlock()
+			return
+		}
+
+		w := f.waiters[0]
+		f.now = w.when
+		if w.period > 0 {
+			w.when = w.when.Add(w.period)
+			f.seq++
+			w.seq = f.seq
+			f.sort()
+		} else {
+			f.waiters = f.waiters[1:]
+		}
+		now := f.now
+		f.mu.Unlock()
+
+		f.fire(w, now)
+	}
+}
+
+// Waiters returns the number of timers, tickers and sleeps currently
+// registered with the clock.
+func (f *Fake) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return len(f.waiters)
+}
+
+// BlockUntil blocks until at least n timers, tickers or sleeps are
+// registered with the clock. Tests use it to know that the goroutines under
+// test have reached the point where they wait on time before advancing it.
+func (f *Fake) BlockUntil(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for len(f.waiters) < n {
+		f.cond.Wait()
+	}
+}
+
+// fire delivers the time to the waiter's channel or calls its function.
+// Like the time package, a tick is dropped if the last one wasn't read.
+func (f *Fake) fire(w *waiter, now time.Time) {
+	if w.fn != nil {
+		w.fn()
+		return
+	}
+
+	select {
+	case w.ch <- now:
+	default:
+	}
+}
+
+// add registers a waiter due d from now. A waiter that is already due
+// fires immediately.
+func (f *Fake) add(w *waiter, d time.Duration) {
+	f.mu.Lock()
+	w.when = f.now.Add(d)
+	if d <= 0 && w.period == 0 {
+		now := f.now
+		f.mu.Unlock()
+		f.fire(w, now)
+		return
+	}
+
+	f.seq++
+	w.seq = f.seq
+	f.waiters = append(f.waiters, w)
+	f.sort()
+	f.cond.Broadcast()
+	f.mu.Unlock()
+}
+
+// remove unregisters a waiter and reports whether it was still pending.
+func (f *Fake) remove(w *waiter) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i := range f.waiters {
+		if f.waiters[i] == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// sort keeps the waiters in deadline order, breaking ties by the order
+// they were registered. The caller must hold the lock.
+func (f *Fake) sort() {
+	sort.Slice(f.waiters, func(i, j int) bool {
+		a, b := f.waiters[i], f.waiters[j]
+		if a.when.Equal(b.when) {
+			return a.seq < b.seq
+		}
+		return a.when.Before(b.when)
+	})
+}
+
+// =============================================================================
+
+// fakeTimer is the Timer returned by a Fake clock.
+type fakeTimer struct {
+	f *Fake
+	w *waiter
+}
+
+// C returns the channel the timer fires on.
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.w.ch
+}
+
+// Stop prevents the timer from firing and reports whether it was pending.
+func (t *fakeTimer) Stop() bool {
+	return t.f.remove(t.w)
+}
+
+// Reset changes the timer to expire after duration d and reports whether
+// the timer had been pending.
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	active := t.f.remove(t.w)
+	t.f.add(t.w, d)
+
+	return active
+}
+
+// fakeTicker is the Ticker returned by a Fake clock.
+type fakeTicker struct {
+	f *Fake
+	w *waiter
+}
+
+// C returns the channel the ticks are delivered on.
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.w.ch
+}
+
+// Stop turns off the ticker.
+func (t *fakeTicker) Stop() {
+	t.f.remove(t.w)
+}
+
+// Reset stops the ticker and resets its period to d.
+func (t *fakeTicker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("non-positive interval for Ticker.Reset")
+	}
+
+	t.f.remove(t.w)
+
+	t.f.mu.Lock()
+	t.w.period = d
+	t.f.mu.Unlock()
+
+	t.f.add(t.w, d)
+}
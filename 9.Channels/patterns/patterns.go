@@ -0,0 +1,424 @@
+// Package patterns holds the channel patterns from the 9.Channels lessons in
+// a form that can be tested. Every pattern takes an Env carrying the clock,
+// the source of randomness and the writer it reports to, so a test can swap
+// in a fake clock and a seeded source and get the same run every time. An
+// Env can also carry a tracer to see the run on a timeline.
+package patterns
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/arjun1malhotra/a-labs-go/9.Channels/clock"
+	"github.com/arjun1malhotra/a-labs-go/9.Channels/trace"
+)
+
+// Rand is the behavior the patterns need to simulate unknown latency.
+type Rand interface {
+	Intn(n int) int
+}
+
+// lockedRand is a seeded source of randomness that is safe to share between
+// the child goroutines of a pattern. A *rand.Rand on its own is not.
+type lockedRand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+// NewRand returns a source of randomness seeded with the specified seed that
+// is safe for concurrent use.
+func NewRand(seed int64) Rand {
+	return &lockedRand{
+		r: rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Intn returns a non-negative pseudo-random number in [0,n).
+func (l *lockedRand) Intn(n int) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.r.Intn(n)
+}
+
+// Env is the environment the patterns run in. Out is written to from
+// several goroutines at once so it must be safe for concurrent use. Trace
+// is optional and records every goroutine's sends, receives, blocks, drops
+// and cancels when set.
+type Env struct {
+	Clock clock.Clock
+	Rand  Rand
+	Out   io.Writer
+	Trace *trace.Tracer
+}
+
+// NewEnv returns an environment backed by the real clock, a source of
+// randomness seeded with the specified seed and stdout.
+func NewEnv(seed int64) Env {
+	return Env{
+		Clock: clock.New(),
+		Rand:  NewRand(seed),
+		Out:   os.Stdout,
+	}
+}
+
+// work simulates some work of unknown latency up to max milliseconds.
+func (env Env) work(g *trace.G, max int) {
+	s := g.Begin(trace.Work, "work")
+	env.Clock.Sleep(time.Duration(env.Rand.Intn(max)) * time.Millisecond)
+	s.End()
+}
+
+// =============================================================================
+
+// WaitForResult: In this pattern, the parent goroutine waits for the child
+// goroutine to finish some work to signal the result.
+func WaitForResult(env Env) string {
+	parent := env.Trace.G("parent")
+	ch := make(chan string)
+
+	go func() {
+		g := env.Trace.G("child")
+		env.work(g, 500)
+		ch <- "data"
+		g.Event(trace.Send, "sent signal")
+		fmt.Fprintln(env.Out, "child : sent signal")
+	}()
+
+	s := parent.Begin(trace.Block, "wait for result")
+	d := <-ch
+	s.End()
+	parent.Event(trace.Receive, "recv'd signal")
+	fmt.Fprintln(env.Out, "parent : recv'd signal :", d)
+
+	return d
+}
+
+// FanOut: In this pattern, the parent goroutine creates the specified number
+// of child goroutines and waits for them to signal their results.
+func FanOut(env Env, children int) int {
+	parent := env.Trace.G("parent")
+	ch := make(chan string, children)
+
+	for c := 0; c < children; c++ {
+		go func(child int) {
+			g := env.Trace.G(fmt.Sprintf("child %d", child))
+			env.work(g, 200)
+			ch <- "data"
+			g.Event(trace.Send, "sent signal")
+			fmt.Fprintln(env.Out, "child : sent signal :", child)
+		}(c)
+	}
+
+	var received int
+	for children > 0 {
+		s := parent.Begin(trace.Block, "wait for result")
+		<-ch
+		s.End()
+		children--
+		received++
+		parent.Event(trace.Receive, "recv'd signal")
+		fmt.Fprintln(env.Out, "parent : recv'd signal :", children)
+	}
+
+	return received
+}
+
+// WaitForTask: In this pattern, the parent goroutine sends a signal to a
+// child goroutine waiting to be told what to do.
+func WaitForTask(env Env) string {
+	parent := env.Trace.G("parent")
+	ch := make(chan string)
+	done := make(chan string)
+
+	go func() {
+		g := env.Trace.G("child")
+		s := g.Begin(trace.Block, "wait for task")
+		d := <-ch
+		s.End()
+		g.Event(trace.Receive, "recv'd signal")
+		fmt.Fprintln(env.Out, "child : recv'd signal :", d)
+		done <- d
+	}()
+
+	env.work(parent, 500)
+	ch <- "data"
+	parent.Event(trace.Send, "sent signal")
+	fmt.Fprintln(env.Out, "parent : sent signal")
+
+	return <-done
+}
+
+// Pooling: In this pattern, the parent goroutine signals work to a pool of
+// child goroutines waiting for work to perform. It returns how many pieces
+// of work each child performed.
+func Pooling(env Env, work int) []int {
+	parent := env.Trace.G("parent")
+	ch := make(chan string)
+
+	g := runtime.GOMAXPROCS(0)
+	counts := make([]int, g)
+
+	var wg sync.WaitGroup
+	wg.Add(g)
+
+	for c := 0; c < g; c++ {
+		go func(child int) {
+			defer wg.Done()
+			tg := env.Trace.G(fmt.Sprintf("child %d", child))
+			for d := range ch {
+				tg.Event(trace.Receive, "recv'd signal")
+				counts[child]++
+				fmt.Fprintf(env.Out, "child %d : recv'd signal : %s\n", child, d)
+			}
+			tg.Event(trace.Receive, "recv'd shutdown signal")
+			fmt.Fprintf(env.Out, "child %d : recv'd shutdown signal\n", child)
+		}(c)
+	}
+
+	for w := 0; w < work; w++ {
+		s := parent.Begin(trace.Block, "wait for child")
+		ch <- "data"
+		s.End()
+		parent.Event(trace.Send, "sent signal")
+		fmt.Fprintln(env.Out, "parent : sent signal :", w)
+	}
+
+	close(ch)
+	parent.Event(trace.Send, "sent shutdown signal")
+	fmt.Fprintln(env.Out, "parent : sent shutdown signal")
+	wg.Wait()
+
+	return counts
+}
+
+// FanOutSem: In this pattern, a semaphore is added to the fan out pattern
+// to restrict the number of child goroutines that can be schedule to run.
+func FanOutSem(env Env, children int) int {
+	parent := env.Trace.G("parent")
+	ch := make(chan string, children)
+
+	g := runtime.GOMAXPROCS(0)
+	sem := make(chan bool, g)
+
+	for c := 0; c < children; c++ {
+		go func(child int) {
+			tg := env.Trace.G(fmt.Sprintf("child %d", child))
+			s := tg.Begin(trace.Block, "wait for semaphore")
+			sem <- true
+			s.End()
+			{
+				env.work(tg, 200)
+				ch <- "data"
+				tg.Event(trace.Send, "sent signal")
+				fmt.Fprintln(env.Out, "child : sent signal :", child)
+			}
+			<-sem
+		}(c)
+	}
+
+	var received int
+	for children > 0 {
+		s := parent.Begin(trace.Block, "wait for result")
+		<-ch
+		s.End()
+		children--
+		received++
+		parent.Event(trace.Receive, "recv'd signal")
+		fmt.Fprintln(env.Out, "parent : recv'd signal :", children)
+	}
+
+	return received
+}
+
+// BoundedWorkPooling: In this pattern, a pool of child goroutines is created
+// to service a fixed amount of work. The parent goroutine iterates over all
+// work, signalling that into the pool. Once all the work has been signaled,
+// then the channel is closed, the channel is flushed, and the child
+// goroutines terminate.
+func BoundedWorkPooling(env Env, work []string) int {
+	parent := env.Trace.G("parent")
+
+	g := runtime.GOMAXPROCS(0)
+	var wg sync.WaitGroup
+	wg.Add(g)
+
+	ch := make(chan string, g)
+
+	var mu sync.Mutex
+	var done int
+
+	for c := 0; c < g; c++ {
+		go func(child int) {
+			defer wg.Done()
+			tg := env.Trace.G(fmt.Sprintf("child %d", child))
+			for wrk := range ch {
+				tg.Event(trace.Receive, "recv'd signal")
+				mu.Lock()
+				done++
+				mu.Unlock()
+				fmt.Fprintf(env.Out, "child %d : recv'd signal : %s\n", child, wrk)
+			}
+			tg.Event(trace.Receive, "recv'd shutdown signal")
+			fmt.Fprintf(env.Out, "child %d : recv'd shutdown signal\n", child)
+		}(c)
+	}
+
+	for _, wrk := range work {
+		s := parent.Begin(trace.Block, "wait for capacity")
+		ch <- wrk
+		s.End()
+		parent.Event(trace.Send, "sent signal")
+	}
+	close(ch)
+	wg.Wait()
+
+	return done
+}
+
+// Drop: In this pattern, the parent goroutine signals work to a single child
+// goroutine that can't handle all the work. If the parent performs a send
+// and the child is not ready, that work is discarded and dropped. It returns
+// the number of signals sent and dropped.
+func Drop(env Env, capacity int, work int) (sent int, dropped int) {
+	parent := env.Trace.G("parent")
+	ch := make(chan string, capacity)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		g := env.Trace.G("child")
+		for p := range ch {
+			g.Event(trace.Receive, "recv'd signal")
+			fmt.Fprintln(env.Out, "child : recv'd signal :", p)
+		}
+	}()
+
+	for w := 0; w < work; w++ {
+		select {
+		case ch <- "data":
+			sent++
+			parent.Event(trace.Send, "sent signal")
+			fmt.Fprintln(env.Out, "parent : sent signal :", w)
+		default:
+			dropped++
+			parent.Event(trace.Drop, "dropped data")
+			fmt.Fprintln(env.Out, "parent : dropped data :", w)
+		}
+	}
+
+	close(ch)
+	parent.Event(trace.Send, "sent shutdown signal")
+	fmt.Fprintln(env.Out, "parent : sent shutdown signal")
+	wg.Wait()
+
+	return sent, dropped
+}
+
+// Cancellation: In this pattern, the parent goroutine creates a child
+// goroutine to perform some work. The parent goroutine is only willing to
+// wait the specified duration for that work to be completed. After that the
+// parent goroutine walks away. It reports whether the work completed.
+func Cancellation(env Env, duration time.Duration) bool {
+	parent := env.Trace.G("parent")
+	ctx, cancel := clock.WithTimeout(context.Background(), env.Clock, duration)
+	defer cancel()
+
+	ch := make(chan string, 1)
+
+	go func() {
+		g := env.Trace.G("child")
+		env.work(g, 200)
+		ch <- "data"
+		g.Event(trace.Send, "sent signal")
+	}()
+
+	s := parent.Begin(trace.Block, "wait for result")
+	defer s.End()
+
+	select {
+	case d := <-ch:
+		parent.Event(trace.Receive, "work complete")
+		fmt.Fprintln(env.Out, "work complete", d)
+		return true
+
+	case <-ctx.Done():
+		parent.Event(trace.Cancel, "work cancelled")
+		fmt.Fprintln(env.Out, "work cancelled")
+		return false
+	}
+}
+
+// RetryTimeout: You need to validate if something can be done with no error
+// but it may take time before this is true. You set a retry interval to create
+// a delay before you retry the call and you use the context to set a timeout.
+// It returns the number of calls made and the last error.
+func RetryTimeout(ctx context.Context, env Env, retryInterval time.Duration, check func(ctx context.Context) error) (int, error) {
+	g := env.Trace.G("retry")
+	var calls int
+
+	for {
+		fmt.Fprintln(env.Out, "perform user check call")
+		calls++
+		s := g.Begin(trace.Work, "check")
+		err := check(ctx)
+		s.End()
+		if err == nil {
+			fmt.Fprintln(env.Out, "work finished successfully")
+			return calls, nil
+		}
+
+		fmt.Fprintln(env.Out, "check if timeout has expired")
+		if ctx.Err() != nil {
+			g.Event(trace.Cancel, "time expired")
+			fmt.Fprintln(env.Out, "time expired 1 :", ctx.Err())
+			return calls, ctx.Err()
+		}
+
+		fmt.Fprintf(env.Out, "wait %s before trying again\n", retryInterval)
+		t := env.Clock.NewTimer(retryInterval)
+
+		s = g.Begin(trace.Block, "wait to retry")
+		select {
+		case <-ctx.Done():
+			s.End()
+			g.Event(trace.Cancel, "time expired")
+			fmt.Fprintln(env.Out, "timed expired 2 :", ctx.Err())
+			t.Stop()
+			return calls, ctx.Err()
+		case <-t.C():
+			s.End()
+			fmt.Fprintln(env.Out, "retry again")
+		}
+	}
+}
+
+// ChannelCancellation shows how you can take an existing channel being
+// used for cancellation and convert that into using a context where
+// a context is needed.
+func ChannelCancellation(stop <-chan struct{}, f func(ctx context.Context) error) error {
+
+	// Create a cancel context for handling the stop signal.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// If a signal is received on the stop channel, cancel the
+	// context. This will propagate the cancel into the f function.
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return f(ctx)
+}
@@ -0,0 +1,254 @@
+package patterns_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/arjun1malhotra/a-labs-go/9.Channels/clock"
+	"github.com/arjun1malhotra/a-labs-go/9.Channels/patterns"
+	"github.com/arjun1malhotra/a-labs-go/9.Channels/trace"
+	"github.com/arjun1malhotra/a-labs-go/911.Testing/leaktest"
+)
+
+const succeed = "\u2713"
+const failed = "\u2717"
+
+var epoch = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// fixed is a source of randomness that always simulates the same latency.
+type fixed int
+
+// Intn ignores n and returns the fixed value.
+func (f fixed) Intn(n int) int {
+	return int(f)
+}
+
+// wait blocks for the result of a pattern running in its own goroutine.
+func wait(t *testing.T, ch <-chan bool) bool {
+	select {
+	case ok := <-ch:
+		return ok
+	case <-time.After(time.Second):
+		t.Fatal("pattern did not return")
+		return false
+	}
+}
+
+// TestCancellation validates the cancellation pattern walks away from work
+// that takes longer than the deadline, and only then.
+func TestCancellation(t *testing.T) {
+	leaktest.Check(t)
+
+	tt := []struct {
+		name     string
+		work     int
+		advance  time.Duration
+		complete bool
+	}{
+		{"slow", 200, 150 * time.Millisecond, false},
+		{"fast", 100, 100 * time.Millisecond, true},
+	}
+
+	t.Log("Given the need to cancel work that takes too long.")
+	{
+		for testID, test := range tt {
+			t.Logf("\tTest %d:\tWhen work takes %dms against a 150ms deadline.", testID, test.work)
+			{
+				f := clock.NewFake(epoch)
+				env := patterns.Env{
+					Clock: f,
+					Rand:  fixed(test.work),
+					Out:   io.Discard,
+				}
+
+				res := make(chan bool, 1)
+				go func() {
+					res <- patterns.Cancellation(env, 150*time.Millisecond)
+				}()
+
+				// Wait for the deadline timer and the child's sleep.
+				f.BlockUntil(2)
+				f.Advance(test.advance)
+
+				if got := wait(t, res); got == test.complete {
+					t.Logf("\t%s\tTest %d:\tShould report complete=%v.", succeed, testID, test.complete)
+				} else {
+					t.Errorf("\t%s\tTest %d:\tShould report complete=%v : got %v", failed, testID, test.complete, got)
+				}
+
+				// Let the child goroutine finish.
+				f.Advance(time.Second)
+			}
+		}
+	}
+}
+
+// TestCancellationSeeded validates a seeded source gives the same outcome
+// as the latency it draws.
+func TestCancellationSeeded(t *testing.T) {
+	leaktest.Check(t)
+
+	t.Log("Given the need to reproduce a cancellation run from a seed.")
+	{
+		for seed := int64(1); seed <= 10; seed++ {
+			work := time.Duration(rand.New(rand.NewSource(seed)).Intn(200)) * time.Millisecond
+			if work == 150*time.Millisecond {
+				continue
+			}
+
+			t.Logf("\tTest %d:\tWhen the seed draws %v of work.", seed, work)
+			{
+				f := clock.NewFake(epoch)
+				env := patterns.Env{
+					Clock: f,
+					Rand:  patterns.NewRand(seed),
+					Out:   io.Discard,
+				}
+
+				res := make(chan bool, 1)
+				go func() {
+					res <- patterns.Cancellation(env, 150*time.Millisecond)
+				}()
+
+				f.BlockUntil(2)
+
+				complete := work < 150*time.Millisecond
+				if complete {
+					f.Advance(work)
+				} else {
+					f.Advance(150 * time.Millisecond)
+				}
+
+				if got := wait(t, res); got == complete {
+					t.Logf("\t%s\tTest %d:\tShould report complete=%v.", succeed, seed, complete)
+				} else {
+					t.Errorf("\t%s\tTest %d:\tShould report complete=%v : got %v", failed, seed, complete, got)
+				}
+
+				f.Advance(time.Second)
+			}
+		}
+	}
+}
+
+// TestDrop validates the drop pattern accounts for every piece of work.
+func TestDrop(t *testing.T) {
+	leaktest.Check(t)
+
+	t.Log("Given the need to drop work the child can't keep up with.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen signalling 2000 pieces of work with a capacity of 100.", testID)
+		{
+			env := patterns.NewEnv(1)
+			env.Out = io.Discard
+
+			sent, dropped := patterns.Drop(env, 100, 2000)
+			if sent+dropped == 2000 {
+				t.Logf("\t%s\tTest %d:\tShould send or drop every piece of work.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould send or drop every piece of work : sent %d, dropped %d", failed, testID, sent, dropped)
+			}
+		}
+	}
+}
+
+// TestRetryTimeout validates the retry pattern keeps calling until the
+// context expires, waiting the retry interval between calls.
+func TestRetryTimeout(t *testing.T) {
+	leaktest.Check(t)
+
+	t.Log("Given the need to retry a failing check until a timeout.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the check always fails with a 1s interval and 3.5s timeout.", testID)
+		{
+			f := clock.NewFake(epoch)
+			env := patterns.Env{
+				Clock: f,
+				Rand:  fixed(0),
+				Out:   io.Discard,
+			}
+
+			ctx, cancel := clock.WithTimeout(context.Background(), f, 3500*time.Millisecond)
+			defer cancel()
+
+			type result struct {
+				calls int
+				err   error
+			}
+			res := make(chan result, 1)
+			go func() {
+				calls, err := patterns.RetryTimeout(ctx, env, time.Second, func(ctx context.Context) error {
+					return errors.New("always fail")
+				})
+				res <- result{calls, err}
+			}()
+
+			for i := 0; i < 3; i++ {
+				f.BlockUntil(2)
+				f.Advance(time.Second)
+			}
+			f.BlockUntil(2)
+			f.Advance(500 * time.Millisecond)
+
+			var r result
+			select {
+			case r = <-res:
+			case <-time.After(time.Second):
+				t.Fatalf("\t%s\tTest %d:\tShould return once the timeout expires.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould return once the timeout expires.", succeed, testID)
+
+			if r.calls == 4 {
+				t.Logf("\t%s\tTest %d:\tShould make 4 calls.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould make 4 calls : %d", failed, testID, r.calls)
+			}
+
+			if r.err == context.DeadlineExceeded {
+				t.Logf("\t%s\tTest %d:\tShould report the deadline was exceeded.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould report the deadline was exceeded : %v", failed, testID, r.err)
+			}
+		}
+	}
+}
+
+// TestDropTrace validates the drop pattern records every send and drop.
+func TestDropTrace(t *testing.T) {
+	leaktest.Check(t)
+
+	t.Log("Given the need to see drops on a timeline.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen tracing the drop pattern.", testID)
+		{
+			env := patterns.NewEnv(1)
+			env.Out = io.Discard
+			env.Trace = trace.New(env.Clock)
+
+			sent, dropped := patterns.Drop(env, 10, 200)
+
+			var sends, drops int
+			for _, e := range env.Trace.Events() {
+				switch {
+				case e.Cat == string(trace.Drop):
+					drops++
+				case e.Cat == string(trace.Send) && e.Name == "sent signal":
+					sends++
+				}
+			}
+
+			if sends == sent && drops == dropped {
+				t.Logf("\t%s\tTest %d:\tShould record %d sends and %d drops.", succeed, testID, sent, dropped)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould record %d sends and %d drops : got %d and %d", failed, testID, sent, dropped, sends, drops)
+			}
+		}
+	}
+}
@@ -0,0 +1,213 @@
+// Package trace records what goroutines do with channels so a run of a
+// pattern can be looked at on a timeline instead of read back from thousands
+// of print statements. The recording is written out in the Chrome Trace
+// Event Format and can be opened in chrome://tracing or ui.perfetto.dev.
+//
+// A nil *Tracer and a nil *G are valid and record nothing, so code can be
+// instrumented unconditionally and only pay for tracing when it's turned on.
+package trace
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/arjun1malhotra/a-labs-go/9.Channels/clock"
+)
+
+// Kind categorizes what a goroutine was doing.
+type Kind string
+
+// Set of kinds a goroutine can record.
+const (
+	Work    Kind = "work"
+	Send    Kind = "send"
+	Receive Kind = "receive"
+	Block   Kind = "block"
+	Drop    Kind = "drop"
+	Cancel  Kind = "cancel"
+)
+
+// Event is a single entry in the Chrome Trace Event Format.
+type Event struct {
+	Name  string            `json:"name"`
+	Cat   string            `json:"cat,omitempty"`
+	Ph    string            `json:"ph"`
+	TS    float64           `json:"ts"`
+	Dur   float64           `json:"dur"`
+	PID   int               `json:"pid"`
+	TID   int               `json:"tid"`
+	Scope string            `json:"s,omitempty"`
+	Args  map[string]string `json:"args,omitempty"`
+}
+
+// Tracer collects the events recorded by a set of goroutines.
+type Tracer struct {
+	clock clock.Clock
+	start time.Time
+
+	mu     sync.Mutex
+	events []Event
+	tid    int
+}
+
+// New constructs a Tracer that timestamps events with the specified clock.
+// Using a fake clock produces the same trace for the same run.
+func New(c clock.Clock) *Tracer {
+	return &Tracer{
+		clock: c,
+		start: c.Now(),
+	}
+}
+
+// G returns a lane on the timeline for a goroutine with the specified name.
+// Every call returns a new lane, so each goroutine should ask for its own.
+func (t *Tracer) G(name string) *G {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.tid++
+	t.events = append(t.events, Event{
+		Name: "thread_name",
+		Ph:   "M",
+		PID:  1,
+		TID:  t.tid,
+		Args: map[string]string{"name": name},
+	})
+
+	return &G{t: t, tid: t.tid}
+}
+
+// Events returns a copy of the events recorded so far.
+func (t *Tracer) Events() []Event {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	events := make([]Event, len(t.events))
+	copy(events, t.events)
+
+	return events
+}
+
+// WriteJSON writes the recorded events as a Chrome trace document.
+func (t *Tracer) WriteJSON(w io.Writer) error {
+	doc := struct {
+		TraceEvents     []Event `json:"traceEvents"`
+		DisplayTimeUnit string  `json:"displayTimeUnit"`
+	}{
+		TraceEvents:     t.Events(),
+		DisplayTimeUnit: "ms",
+	}
+	if doc.TraceEvents == nil {
+		doc.TraceEvents = []Event{}
+	}
+
+	return json.NewEncoder(w).Encode(doc)
+}
+
+// since returns the microseconds elapsed since the tracer was created.
+func (t *Tracer) since() float64 {
+	return float64(t.clock.Since(t.start)) / float64(time.Microsecond)
+}
+
+// add appends an event to the trace.
+func (t *Tracer) add(e Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.events = append(t.events, e)
+}
+
+// =============================================================================
+
+// G is the lane of a single goroutine on the timeline.
+type G struct {
+	t   *Tracer
+	tid int
+}
+
+// Event records something that happened at a single point in time, like a
+// send that completed or a piece of work that was dropped.
+func (g *G) Event(kind Kind, name string, args ...string) {
+	if g == nil {
+		return
+	}
+
+	g.t.add(Event{
+		Name:  name,
+		Cat:   string(kind),
+		Ph:    "i",
+		TS:    g.t.since(),
+		PID:   1,
+		TID:   g.tid,
+		Scope: "t",
+		Args:  pairs(args),
+	})
+}
+
+// Begin starts a span of time on the goroutine's lane, like the time spent
+// doing work or blocked waiting on a semaphore. The span is recorded when
+// End is called on the returned value.
+func (g *G) Begin(kind Kind, name string, args ...string) *Span {
+	if g == nil {
+		return nil
+	}
+
+	return &Span{
+		g:     g,
+		kind:  kind,
+		name:  name,
+		args:  pairs(args),
+		start: g.t.since(),
+	}
+}
+
+// Span is a span of time on a goroutine's lane.
+type Span struct {
+	g     *G
+	kind  Kind
+	name  string
+	args  map[string]string
+	start float64
+}
+
+// End records the span as finishing now.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.g.t.add(Event{
+		Name: s.name,
+		Cat:  string(s.kind),
+		Ph:   "X",
+		TS:   s.start,
+		Dur:  s.g.t.since() - s.start,
+		PID:  1,
+		TID:  s.g.tid,
+		Args: s.args,
+	})
+}
+
+// pairs turns a list of key, value strings into event arguments.
+func pairs(args []string) map[string]string {
+	if len(args) == 0 {
+		return nil
+	}
+
+	m := make(map[string]string, len(args)/2)
+	for i := 0; i+1 < len(args); i += 2 {
+		m[args[i]] = args[i+1]
+	}
+
+	return m
+}
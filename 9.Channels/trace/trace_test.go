@@ -0,0 +1,94 @@
+package trace_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/arjun1malhotra/a-labs-go/9.Channels/clock"
+	"github.com/arjun1malhotra/a-labs-go/9.Channels/trace"
+)
+
+const succeed = "\u2713"
+const failed = "\u2717"
+
+// TestWriteJSON validates spans and events are written in the Chrome
+// Trace Event Format with timestamps taken from the clock.
+func TestWriteJSON(t *testing.T) {
+	t.Log("Given the need to write goroutine activity as a Chrome trace.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a goroutine blocks for 150ms and then is cancelled.", testID)
+		{
+			f := clock.NewFake(time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC))
+			tr := trace.New(f)
+
+			g := tr.G("parent")
+			s := g.Begin(trace.Block, "wait for result")
+			f.Advance(150 * time.Millisecond)
+			s.End()
+			g.Event(trace.Cancel, "work cancelled", "reason", "deadline")
+
+			var buf bytes.Buffer
+			if err := tr.WriteJSON(&buf); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to write the trace : %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to write the trace.", succeed, testID)
+
+			var doc struct {
+				TraceEvents []trace.Event `json:"traceEvents"`
+			}
+			if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to decode the trace : %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to decode the trace.", succeed, testID)
+
+			if len(doc.TraceEvents) != 3 {
+				t.Fatalf("\t%s\tTest %d:\tShould have 3 events : %d", failed, testID, len(doc.TraceEvents))
+			}
+			t.Logf("\t%s\tTest %d:\tShould have 3 events.", succeed, testID)
+
+			meta, span, cancel := doc.TraceEvents[0], doc.TraceEvents[1], doc.TraceEvents[2]
+
+			if meta.Ph == "M" && meta.Args["name"] == "parent" {
+				t.Logf("\t%s\tTest %d:\tShould name the goroutine's lane.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould name the goroutine's lane : %+v", failed, testID, meta)
+			}
+
+			if span.Ph == "X" && span.Cat == "block" && span.TS == 0 && span.Dur == 150000 {
+				t.Logf("\t%s\tTest %d:\tShould record a 150ms block span.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould record a 150ms block span : %+v", failed, testID, span)
+			}
+
+			if cancel.Ph == "i" && cancel.Cat == "cancel" && cancel.TS == 150000 && cancel.Args["reason"] == "deadline" {
+				t.Logf("\t%s\tTest %d:\tShould record the cancel at 150ms.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould record the cancel at 150ms : %+v", failed, testID, cancel)
+			}
+
+			if meta.TID == span.TID && span.TID == cancel.TID {
+				t.Logf("\t%s\tTest %d:\tShould keep the goroutine on one lane.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould keep the goroutine on one lane.", failed, testID)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen tracing is turned off.", testID)
+		{
+			var tr *trace.Tracer
+			g := tr.G("parent")
+			g.Begin(trace.Work, "work").End()
+			g.Event(trace.Drop, "dropped data")
+
+			var buf bytes.Buffer
+			if err := tr.WriteJSON(&buf); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to write an empty trace : %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to write an empty trace.", succeed, testID)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+/*
+	In the cancellation lessons we turned a stop channel into a context, and in the failure detection
+	lesson we hooked into the operating system with "signal.Notify" by hand. A real service needs all of
+	this at once. It has several goroutines running for the life of the program, an http server, a worker
+	pulling jobs, a logger flushing to disk, and when one of them fails or the operator hits ctrl+C all of
+	them have to be told to stop, and we need to know that they actually did.
+
+	The lifecycle package gives us a group. Every piece of the service is a component that knows how to
+	"Run(ctx) error" and how to "Stop(ctx) error". The group starts every component and waits for the first
+	of three things: a component returning, a SIGINT/SIGTERM, or the context we passed being cancelled.
+	Then it cancels the context every component is running with, calls Stop on all of them and waits.
+
+	We can't wait forever, no shutdown can take forever either, so the group gets a shutdown deadline.
+	Any component still running after that deadline is reported by name, so we know exactly who to go
+	look at.
+
+	Run this and hit ctrl+C, or hit "http://localhost:4000/fail" to see a component failure take the
+	whole group down.
+*/
+
+// This sample program shows how to run the pieces of a service as a group
+// that shuts down together.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/arjun1malhotra/a-labs-go/910.Concurrency-pattern/lifecycle"
+)
+
+// server adapts an http.Server to a lifecycle component.
+type server struct {
+	srv *http.Server
+}
+
+// Run starts the server and blocks until it's shut down.
+func (s *server) Run(ctx context.Context) error {
+	if err := s.srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Stop shuts the server down gracefully.
+func (s *server) Stop(ctx context.Context) error {
+	return s.srv.Shutdown(ctx)
+}
+
+func main() {
+	fail := make(chan struct{}, 1)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/fail", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case fail <- struct{}{}:
+		default:
+		}
+		fmt.Fprintln(w, "failing the worker")
+	})
+
+	g := lifecycle.New(5 * time.Second)
+
+	g.Add("http", &server{
+		srv: &http.Server{Addr: "localhost:4000", Handler: mux},
+	})
+
+	g.Add("worker", lifecycle.RunFunc(func(ctx context.Context) error {
+		t := time.NewTicker(time.Second)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-t.C:
+				fmt.Println("worker : tick")
+			case <-fail:
+				return errors.New("worker asked to fail")
+			case <-ctx.Done():
+				fmt.Println("worker : shutting down")
+				return nil
+			}
+		}
+	}))
+
+	if err := g.Run(context.Background()); err != nil {
+		fmt.Println("shutdown :", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("shutdown : clean")
+}
@@ -0,0 +1,245 @@
+// Package lifecycle runs a group of named components for the life of a
+// service and shuts them all down together. The first component to fail, an
+// interrupt or terminate signal from the operating system, or the caller's
+// context ending is what starts the shutdown, and every component then has
+// a bounded amount of time to stop.
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Component is a long running piece of a service. Run blocks until the
+// component is done or the context is cancelled. Stop asks the component to
+// stop and should return once it has, or once the context expires.
+type Component interface {
+	Run(ctx context.Context) error
+	Stop(ctx context.Context) error
+}
+
+// RunFunc turns a function that stops when its context is cancelled into a
+// Component with nothing else to do on Stop.
+type RunFunc func(ctx context.Context) error
+
+// Run calls f(ctx).
+func (f RunFunc) Run(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Stop does nothing since the function stops with its context.
+func (f RunFunc) Stop(ctx context.Context) error {
+	return nil
+}
+
+// =============================================================================
+
+// Error describes why a group shut down when it didn't shut down cleanly.
+type Error struct {
+	Component  string           // Component that caused the shutdown.
+	Err        error            // Error returned by that component.
+	Signal     os.Signal        // Signal that caused the shutdown.
+	StopErrors map[string]error // Errors returned by Stop.
+	Timeout    []string         // Components that didn't stop in time.
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	var b strings.Builder
+
+	switch {
+	case e.Err != nil:
+		fmt.Fprintf(&b, "component %q failed: %v", e.Component, e.Err)
+	case e.Signal != nil:
+		fmt.Fprintf(&b, "received signal %v", e.Signal)
+	default:
+		b.WriteString("shutdown")
+	}
+
+	names := make([]string, 0, len(e.StopErrors))
+	for name := range e.StopErrors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, ", stop %q: %v", name, e.StopErrors[name])
+	}
+
+	if len(e.Timeout) > 0 {
+		fmt.Fprintf(&b, ", did not stop in time: %s", strings.Join(e.Timeout, ", "))
+	}
+
+	return b.String()
+}
+
+// Unwrap returns the error of the component that caused the shutdown.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// =============================================================================
+
+// Group is a set of components that start and stop together.
+type Group struct {
+	shutdown time.Duration
+	signals  []os.Signal
+	names    []string
+	comps    map[string]Component
+}
+
+// New constructs a Group that gives its components the specified amount of
+// time to stop once a shutdown starts. By default the group shuts down on
+// SIGINT and SIGTERM.
+func New(shutdown time.Duration) *Group {
+	return &Group{
+		shutdown: shutdown,
+		signals:  []os.Signal{os.Interrupt, syscall.SIGTERM},
+		comps:    make(map[string]Component),
+	}
+}
+
+// Signals replaces the set of signals that cause the group to shut down.
+// Calling it with no signals turns signal handling off.
+func (g *Group) Signals(sig ...os.Signal) {
+	g.signals = sig
+}
+
+// Add registers a component with the group under a unique name. It must be
+// called before Run.
+func (g *Group) Add(name string, c Component) {
+	if _, exists := g.comps[name]; exists {
+		panic(fmt.Sprintf("lifecycle: component %q added twice", name))
+	}
+
+	g.names = append(g.names, name)
+	g.comps[name] = c
+}
+
+// result is what a component's Run call returned.
+type result struct {
+	name string
+	err  error
+}
+
+// Run starts every component and blocks until the group has shut down. It
+// returns nil when the shutdown was asked for and every component stopped
+// cleanly and in time, otherwise it returns an *Error.
+func (g *Group) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sigs := make(chan os.Signal, 1)
+	if len(g.signals) > 0 {
+		signal.Notify(sigs, g.signals...)
+		defer signal.Stop(sigs)
+	}
+
+	// Buffered so a component that returns after the shutdown deadline
+	// doesn't block forever trying to report.
+	results := make(chan result, len(g.names))
+	for _, name := range g.names {
+		go func(name string, c Component) {
+			results <- result{name, c.Run(ctx)}
+		}(name, g.comps[name])
+	}
+
+	var e Error
+	running := make(map[string]bool, len(g.names))
+	for _, name := range g.names {
+		running[name] = true
+	}
+
+	select {
+	case r := <-results:
+		delete(running, r.name)
+		if r.err != nil {
+			e.Component = r.name
+			e.Err = r.err
+		}
+
+	case sig := <-sigs:
+		e.Signal = sig
+
+	case <-ctx.Done():
+	}
+
+	// Cancel every component and give them the shutdown deadline to stop.
+	cancel()
+
+	sctx, scancel := context.WithTimeout(context.Background(), g.shutdown)
+	defer scancel()
+
+	e.StopErrors = g.stop(sctx, running)
+
+	for len(running) > 0 {
+
+		// Take anything already reported before looking at the deadline
+		// so a component isn't blamed for a result we haven't read yet.
+		select {
+		case r := <-results:
+			delete(running, r.name)
+			continue
+		default:
+		}
+
+		select {
+		case r := <-results:
+			delete(running, r.name)
+
+		case <-sctx.Done():
+			for name := range running {
+				e.Timeout = append(e.Timeout, name)
+			}
+			sort.Strings(e.Timeout)
+			running = nil
+		}
+	}
+
+	// A signal or the caller's context is how a group is asked to shut
+	// down, so on their own they're not a failure.
+	if e.Err == nil && len(e.StopErrors) == 0 && len(e.Timeout) == 0 {
+		return nil
+	}
+
+	return &e
+}
+
+// stop calls Stop on every component still running, in parallel, and
+// returns the errors they report.
+func (g *Group) stop(ctx context.Context, running map[string]bool) map[string]error {
+	type stopResult struct {
+		name string
+		err  error
+	}
+
+	ch := make(chan stopResult, len(running))
+	for name := range running {
+		go func(name string, c Component) {
+			ch <- stopResult{name, c.Stop(ctx)}
+		}(name, g.comps[name])
+	}
+
+	var errs map[string]error
+	for n := len(running); n > 0; n-- {
+		select {
+		case r := <-ch:
+			if r.err != nil {
+				if errs == nil {
+					errs = make(map[string]error)
+				}
+				errs[r.name] = r.err
+			}
+
+		case <-ctx.Done():
+			return errs
+		}
+	}
+
+	return errs
+}
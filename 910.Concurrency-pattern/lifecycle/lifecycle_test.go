@@ -0,0 +1,190 @@
+package lifecycle_test
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/arjun1malhotra/a-labs-go/910.Concurrency-pattern/lifecycle"
+	"github.com/arjun1malhotra/a-labs-go/911.Testing/leaktest"
+)
+
+const succeed = "\u2713"
+const failed = "\u2717"
+
+// stuck is a component that ignores both its context and Stop.
+type stuck struct {
+	release chan struct{}
+}
+
+func (s *stuck) Run(ctx context.Context) error {
+	<-s.release
+	return nil
+}
+
+func (s *stuck) Stop(ctx context.Context) error {
+	return errors.New("can't stop")
+}
+
+// waitCtx is a component that runs until its context is cancelled.
+func waitCtx(stopped chan<- string, name string) lifecycle.RunFunc {
+	return func(ctx context.Context) error {
+		<-ctx.Done()
+		stopped <- name
+		return nil
+	}
+}
+
+// run runs the group in its own goroutine and waits for it to return.
+func run(t *testing.T, g *lifecycle.Group, start func()) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- g.Run(context.Background())
+	}()
+
+	if start != nil {
+		start()
+	}
+
+	select {
+	case err := <-errs:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("group did not shut down")
+		return nil
+	}
+}
+
+// TestFailure validates the first failing component shuts the group down.
+func TestFailure(t *testing.T) {
+	leaktest.Check(t)
+
+	t.Log("Given the need to shut down every component when one fails.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the db component fails.", testID)
+		{
+			stopped := make(chan string, 1)
+			errDB := errors.New("connection lost")
+
+			g := lifecycle.New(time.Second)
+			g.Signals()
+			g.Add("http", waitCtx(stopped, "http"))
+			g.Add("db", lifecycle.RunFunc(func(ctx context.Context) error {
+				return errDB
+			}))
+
+			err := run(t, g, nil)
+
+			var e *lifecycle.Error
+			if !errors.As(err, &e) {
+				t.Fatalf("\t%s\tTest %d:\tShould return a lifecycle error : %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould return a lifecycle error.", succeed, testID)
+
+			if e.Component == "db" && errors.Is(err, errDB) {
+				t.Logf("\t%s\tTest %d:\tShould report the db failure.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould report the db failure : %v", failed, testID, err)
+			}
+
+			if name := <-stopped; name == "http" {
+				t.Logf("\t%s\tTest %d:\tShould cancel the http component.", succeed, testID)
+			}
+		}
+	}
+}
+
+// TestSignal validates an interrupt shuts the group down cleanly.
+func TestSignal(t *testing.T) {
+	leaktest.Check(t)
+
+	t.Log("Given the need to shut down on an interrupt.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the process receives SIGINT.", testID)
+		{
+			stopped := make(chan string, 2)
+
+			g := lifecycle.New(time.Second)
+			g.Add("http", waitCtx(stopped, "http"))
+			g.Add("worker", waitCtx(stopped, "worker"))
+
+			err := run(t, g, func() {
+
+				// Give the group a moment to install its handler.
+				time.Sleep(100 * time.Millisecond)
+				syscall.Kill(syscall.Getpid(), syscall.SIGINT)
+			})
+
+			if err == nil {
+				t.Logf("\t%s\tTest %d:\tShould shut down without an error.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould shut down without an error : %v", failed, testID, err)
+			}
+
+			if len(stopped) == 2 {
+				t.Logf("\t%s\tTest %d:\tShould stop both components.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould stop both components : %d stopped", failed, testID, len(stopped))
+			}
+		}
+	}
+}
+
+// TestShutdownDeadline validates components that don't stop in time are
+// reported by name.
+func TestShutdownDeadline(t *testing.T) {
+	leaktest.Check(t)
+
+	t.Log("Given the need to bound how long a shutdown takes.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a component ignores the shutdown.", testID)
+		{
+			s := stuck{release: make(chan struct{})}
+			defer close(s.release)
+
+			stopped := make(chan string, 1)
+			ctx, cancel := context.WithCancel(context.Background())
+
+			g := lifecycle.New(50 * time.Millisecond)
+			g.Signals()
+			g.Add("http", waitCtx(stopped, "http"))
+			g.Add("legacy", &s)
+
+			errs := make(chan error, 1)
+			go func() {
+				errs <- g.Run(ctx)
+			}()
+			cancel()
+
+			var err error
+			select {
+			case err = <-errs:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("\t%s\tTest %d:\tShould give up after the deadline.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould give up after the deadline.", succeed, testID)
+
+			var e *lifecycle.Error
+			if !errors.As(err, &e) {
+				t.Fatalf("\t%s\tTest %d:\tShould return a lifecycle error : %v", failed, testID, err)
+			}
+
+			if len(e.Timeout) == 1 && e.Timeout[0] == "legacy" {
+				t.Logf("\t%s\tTest %d:\tShould report legacy didn't stop in time.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould report legacy didn't stop in time : %v", failed, testID, e.Timeout)
+			}
+
+			if e.StopErrors["legacy"] != nil {
+				t.Logf("\t%s\tTest %d:\tShould report the Stop error.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould report the Stop error : %v", failed, testID, e.StopErrors)
+			}
+		}
+	}
+}
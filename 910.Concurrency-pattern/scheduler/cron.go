@@ -0,0 +1,292 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule knows when a job should run next.
+type Schedule interface {
+	Next(t time.Time) time.Time
+}
+
+// Parse parses a cron expression. It accepts the five standard fields
+//
+//	minute hour day-of-month month day-of-week
+//
+// where every field can be "*", a value, a range "a-b", a step "*/n" or
+// "a-b/n", or a comma separated list of those. Months and weekdays can be
+// named (jan, mon). It also accepts the descriptors @yearly, @annually,
+// @monthly, @weekly, @daily, @midnight, @hourly and "@every <duration>".
+//
+// The expression can start with "CRON_TZ=<zone>" or "TZ=<zone>" to be
+// evaluated in that time zone instead of the one of the time passed to Next.
+func Parse(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+
+	var loc *time.Location
+	if strings.HasPrefix(spec, "CRON_TZ=") || strings.HasPrefix(spec, "TZ=") {
+		tz, rest, _ := strings.Cut(spec, " ")
+		_, name, _ := strings.Cut(tz, "=")
+
+		var err error
+		if loc, err = time.LoadLocation(name); err != nil {
+			return nil, fmt.Errorf("parse %q: %w", spec, err)
+		}
+		spec = strings.TrimSpace(rest)
+	}
+
+	if strings.HasPrefix(spec, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil {
+			return nil, fmt.Errorf("parse %q: %w", spec, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("parse %q: interval must be positive", spec)
+		}
+		return every{d: d}, nil
+	}
+
+	if d, ok := descriptors[spec]; ok {
+		spec = d
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("parse %q: expected 5 fields, got %d", spec, len(fields))
+	}
+
+	var c cron
+	var err error
+	if c.minute, err = parseField(fields[0], minutes); err != nil {
+		return nil, fmt.Errorf("parse %q: minute: %w", spec, err)
+	}
+	if c.hour, err = parseField(fields[1], hours); err != nil {
+		return nil, fmt.Errorf("parse %q: hour: %w", spec, err)
+	}
+	if c.dom, err = parseField(fields[2], doms); err != nil {
+		return nil, fmt.Errorf("parse %q: day of month: %w", spec, err)
+	}
+	if c.month, err = parseField(fields[3], months); err != nil {
+		return nil, fmt.Errorf("parse %q: month: %w", spec, err)
+	}
+	if c.dow, err = parseField(fields[4], dows); err != nil {
+		return nil, fmt.Errorf("parse %q: day of week: %w", spec, err)
+	}
+
+	// Sunday can be written as 0 or 7.
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+
+	c.domStar = strings.HasPrefix(fields[2], "*")
+	c.dowStar = strings.HasPrefix(fields[4], "*")
+	c.loc = loc
+
+	return c, nil
+}
+
+// MustParse is like Parse but panics if the expression can't be parsed.
+func MustParse(spec string) Schedule {
+	s, err := Parse(spec)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// descriptors maps the predefined schedules to their cron expression.
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// =============================================================================
+
+// every is a schedule that runs at a fixed interval.
+type every struct {
+	d time.Duration
+}
+
+// Next returns t plus the interval.
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(e.d)
+}
+
+// cron is a schedule described by the five cron fields, each held as a bit
+// set of the values it matches.
+type cron struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+	loc                           *time.Location
+}
+
+// Next returns the first time after t that matches the schedule, or the
+// zero time if nothing matches within five years.
+func (c cron) Next(t time.Time) time.Time {
+	orig := t.Location()
+	if c.loc != nil {
+		t = t.In(c.loc)
+	}
+	loc := t.Location()
+
+	// Start at the next whole minute.
+	t = t.Add(time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+	limit := t.Year() + 5
+
+	for t.Year() <= limit {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			next := time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+
+			// Around a daylight saving change the next wall clock hour can
+			// land on the same instant, so force the clock forward.
+			if !next.After(t) {
+				next = t.Add(time.Hour).Truncate(time.Hour)
+			}
+			t = next
+			continue
+		}
+
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t.In(orig)
+	}
+
+	return time.Time{}
+}
+
+// dayMatches applies the cron rule that when both day fields are
+// restricted a day matches if either one does.
+func (c cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// =============================================================================
+
+// bounds describes the values allowed in a field.
+type bounds struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minutes = bounds{min: 0, max: 59}
+	hours   = bounds{min: 0, max: 23}
+	doms    = bounds{min: 1, max: 31}
+	months  = bounds{min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dows = bounds{min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// parseField parses a comma separated list of ranges into a bit set.
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		r, err := parseRange(part, b)
+		if err != nil {
+			return 0, err
+		}
+		bits |= r
+	}
+
+	return bits, nil
+}
+
+// parseRange parses a single "*", "v", "a-b" optionally followed by "/step".
+func parseRange(s string, b bounds) (uint64, error) {
+	rng, stepStr, hasStep := strings.Cut(s, "/")
+
+	step := 1
+	if hasStep {
+		var err error
+		if step, err = strconv.Atoi(stepStr); err != nil || step <= 0 {
+			return 0, fmt.Errorf("invalid step %q", s)
+		}
+	}
+
+	var lo, hi int
+	switch {
+	case rng == "*":
+		lo, hi = b.min, b.max
+
+	case strings.Contains(rng, "-"):
+		a, z, _ := strings.Cut(rng, "-")
+		var err error
+		if lo, err = value(a, b); err != nil {
+			return 0, err
+		}
+		if hi, err = value(z, b); err != nil {
+			return 0, err
+		}
+
+	default:
+		var err error
+		if lo, err = value(rng, b); err != nil {
+			return 0, err
+		}
+		hi = lo
+
+		// "a/n" means every n starting at a.
+		if hasStep {
+			hi = b.max
+		}
+	}
+
+	if lo > hi {
+		return 0, fmt.Errorf("invalid range %q", s)
+	}
+
+	var bits uint64
+	for v := lo; v <= hi; v += step {
+		bits |= 1 << uint(v)
+	}
+
+	return bits, nil
+}
+
+// value parses a number or a name and checks it's within bounds.
+func value(s string, b bounds) (int, error) {
+	if v, ok := b.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	if v < b.min || v > b.max {
+		return 0, fmt.Errorf("value %d out of range [%d, %d]", v, b.min, b.max)
+	}
+
+	return v, nil
+}
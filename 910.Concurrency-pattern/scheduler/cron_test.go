@@ -0,0 +1,112 @@
+package scheduler_test
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/arjun1malhotra/a-labs-go/910.Concurrency-pattern/scheduler"
+)
+
+const succeed = "\u2713"
+const failed = "\u2717"
+
+// TestNext validates cron expressions find the next matching time.
+func TestNext(t *testing.T) {
+	from := time.Date(2021, time.March, 5, 10, 7, 30, 0, time.UTC) // A Friday.
+
+	tt := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2021, time.March, 5, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2021, time.March, 5, 10, 15, 0, 0, time.UTC)},
+		{"0 9-17 * * mon-fri", time.Date(2021, time.March, 5, 11, 0, 0, 0, time.UTC)},
+		{"30 8 * * mon", time.Date(2021, time.March, 8, 8, 30, 0, 0, time.UTC)},
+		{"0 0 1 jan *", time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 13 * 5", time.Date(2021, time.March, 5, 12, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2021, time.March, 7, 0, 0, 0, 0, time.UTC)},
+		{"5,10/20 * * * *", time.Date(2021, time.March, 5, 10, 10, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2021, time.March, 5, 11, 0, 0, 0, time.UTC)},
+		{"@every 90s", time.Date(2021, time.March, 5, 10, 9, 0, 0, time.UTC)},
+		{"CRON_TZ=America/New_York 0 9 * * *", time.Date(2021, time.March, 5, 14, 0, 0, 0, time.UTC)},
+		{"TZ=Asia/Kolkata 30 16 * * *", time.Date(2021, time.March, 5, 11, 0, 0, 0, time.UTC)},
+	}
+
+	t.Log("Given the need to find the next time a cron expression matches.")
+	{
+		for testID, test := range tt {
+			t.Logf("\tTest %d:\tWhen checking %q from %v.", testID, test.spec, from)
+			{
+				s, err := scheduler.Parse(test.spec)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to parse the expression : %v", failed, testID, err)
+				}
+
+				if got := s.Next(from); got.Equal(test.want) {
+					t.Logf("\t%s\tTest %d:\tShould match %v.", succeed, testID, test.want)
+				} else {
+					t.Errorf("\t%s\tTest %d:\tShould match %v : got %v", failed, testID, test.want, got)
+				}
+			}
+		}
+	}
+}
+
+// TestNextDST validates a schedule skips the hour that doesn't exist when
+// the clocks go forward.
+func TestNextDST(t *testing.T) {
+	t.Log("Given the need to schedule across a daylight saving change.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen 2:30am doesn't exist in New York.", testID)
+		{
+			ny, err := time.LoadLocation("America/New_York")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould load the zone : %v", failed, testID, err)
+			}
+
+			s := scheduler.MustParse("30 2 * * *")
+			from := time.Date(2021, time.March, 13, 3, 0, 0, 0, ny)
+			want := time.Date(2021, time.March, 15, 2, 30, 0, 0, ny)
+
+			if got := s.Next(from); got.Equal(want) {
+				t.Logf("\t%s\tTest %d:\tShould skip to the next day with a 2:30am.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould skip to the next day with a 2:30am : got %v", failed, testID, got)
+			}
+		}
+	}
+}
+
+// TestParseErrors validates bad expressions are rejected.
+func TestParseErrors(t *testing.T) {
+	specs := []string{
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"@every -1s",
+		"@every soon",
+		"CRON_TZ=Nowhere/Atlantis * * * * *",
+	}
+
+	t.Log("Given the need to reject invalid cron expressions.")
+	{
+		for testID, spec := range specs {
+			t.Logf("\tTest %d:\tWhen parsing %q.", testID, spec)
+			{
+				if _, err := scheduler.Parse(spec); err != nil {
+					t.Logf("\t%s\tTest %d:\tShould return an error : %v", succeed, testID, err)
+				} else {
+					t.Errorf("\t%s\tTest %d:\tShould return an error.", failed, testID)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,323 @@
+// Package scheduler runs periodic jobs on cron schedules. Every run of a job
+// gets its own context with a timeout, the same way the cancellation pattern
+// only waits so long for a piece of work, and every job decides what happens
+// when a run is still going when the next one is due.
+//
+// A Scheduler is a lifecycle component, so it can be added to a group and
+// shut down with the rest of a service.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/arjun1malhotra/a-labs-go/9.Channels/clock"
+)
+
+// Overlap decides what happens when a job is due while a previous run of it
+// is still going.
+type Overlap int
+
+// Set of overlap policies.
+const (
+	Skip  Overlap = iota // Drop the run that is due.
+	Queue                // Run it as soon as the previous run finishes.
+	Allow                // Run it concurrently.
+)
+
+// Func is the work a job performs. It should return when ctx is done.
+type Func func(ctx context.Context) error
+
+// Job describes a job to schedule.
+type Job struct {
+	Name     string
+	Spec     string        // Cron expression, see Parse.
+	Timeout  time.Duration // Per run timeout, zero means no timeout.
+	Overlap  Overlap
+	Location *time.Location // Time zone for the schedule, default is UTC.
+	Func     Func
+}
+
+// Status reports what happened the last time a job ran.
+type Status struct {
+	Runs         int
+	Skipped      int
+	Queued       int
+	Running      int
+	LastStart    time.Time
+	LastDuration time.Duration
+	LastErr      error
+	Next         time.Time
+}
+
+// ErrStopped is returned by Add once the scheduler has been stopped.
+var ErrStopped = errors.New("scheduler stopped")
+
+// ErrStarted is returned by Run when the scheduler was run before, since a
+// scheduler runs once.
+var ErrStarted = errors.New("scheduler already started")
+
+// =============================================================================
+
+// job is a scheduled job and its state.
+type job struct {
+	Job
+	schedule Schedule
+
+	mu     sync.Mutex
+	status Status
+}
+
+// Scheduler runs jobs on their schedules.
+type Scheduler struct {
+	clock clock.Clock
+
+	mu      sync.Mutex
+	jobs    map[string]*job
+	changed chan struct{}
+	stopped bool
+	ran     bool
+	cancel  context.CancelFunc
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// New constructs a Scheduler that keeps time with the specified clock.
+func New(c clock.Clock) *Scheduler {
+	return &Scheduler{
+		clock:   c,
+		jobs:    make(map[string]*job),
+		changed: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+}
+
+// Add schedules a job. It can be called before or while the scheduler runs.
+func (s *Scheduler) Add(j Job) error {
+	sched, err := Parse(j.Spec)
+	if err != nil {
+		return err
+	}
+	if j.Func == nil {
+		return fmt.Errorf("job %q: nil func", j.Name)
+	}
+	if j.Location == nil {
+		j.Location = time.UTC
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		return ErrStopped
+	}
+	if _, exists := s.jobs[j.Name]; exists {
+		return fmt.Errorf("job %q: already scheduled", j.Name)
+	}
+
+	nj := job{
+		Job:      j,
+		schedule: sched,
+	}
+	nj.status.Next = sched.Next(s.clock.Now().In(j.Location))
+	s.jobs[j.Name] = &nj
+
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Status returns the status of the named job.
+func (s *Scheduler) Status(name string) (Status, bool) {
+	s.mu.Lock()
+	j, ok := s.jobs[name]
+	s.mu.Unlock()
+
+	if !ok {
+		return Status{}, false
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.status, true
+}
+
+// Run dispatches jobs as they come due until ctx is cancelled or Stop is
+// called, then waits for the runs in flight to finish. A scheduler runs once.
+func (s *Scheduler) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		cancel()
+		return ErrStopped
+	}
+	if s.ran {
+		s.mu.Unlock()
+		cancel()
+		return ErrStarted
+	}
+	s.ran = true
+	s.cancel = cancel
+	s.mu.Unlock()
+
+	defer func() {
+		cancel()
+		s.wg.Wait()
+		close(s.done)
+	}()
+
+	for {
+		next, ok := s.next()
+
+		var fire <-chan time.Time
+		var t clock.Timer
+		if ok {
+			t = s.clock.NewTimer(next.Sub(s.clock.Now()))
+			fire = t.C()
+		}
+
+		select {
+		case <-ctx.Done():
+			if t != nil {
+				t.Stop()
+			}
+			return nil
+
+		case <-s.changed:
+			if t != nil {
+				t.Stop()
+			}
+
+		case now := <-fire:
+			s.dispatch(ctx, now)
+		}
+	}
+}
+
+// Stop stops dispatching new runs, cancels the runs in flight and waits for
+// them to finish or for ctx to expire.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	s.stopped = true
+	cancel := s.cancel
+	s.mu.Unlock()
+
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// next returns the earliest time a job is due.
+func (s *Scheduler) next() (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var next time.Time
+	for _, j := range s.jobs {
+		j.mu.Lock()
+		n := j.status.Next
+		j.mu.Unlock()
+
+		if n.IsZero() {
+			continue
+		}
+		if next.IsZero() || n.Before(next) {
+			next = n
+		}
+	}
+
+	return next, !next.IsZero()
+}
+
+// dispatch starts every job that is due at now, in name order.
+func (s *Scheduler) dispatch(ctx context.Context, now time.Time) {
+	s.mu.Lock()
+	var due []*job
+	for _, j := range s.jobs {
+		j.mu.Lock()
+		if !j.status.Next.IsZero() && !j.status.Next.After(now) {
+			due = append(due, j)
+		}
+		j.mu.Unlock()
+	}
+	s.mu.Unlock()
+
+	sort.Slice(due, func(i, k int) bool {
+		return due[i].Name < due[k].Name
+	})
+
+	for _, j := range due {
+		j.mu.Lock()
+		j.status.Next = j.schedule.Next(now.In(j.Location))
+
+		if j.status.Running > 0 {
+			switch j.Overlap {
+			case Skip:
+				j.status.Skipped++
+				j.mu.Unlock()
+				continue
+
+			case Queue:
+				j.status.Queued++
+				j.mu.Unlock()
+				continue
+			}
+		}
+
+		j.status.Running++
+		j.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.run(ctx, j)
+	}
+}
+
+// run performs a run of the job, then any runs that were queued behind it.
+func (s *Scheduler) run(ctx context.Context, j *job) {
+	defer s.wg.Done()
+
+	for {
+		start := s.clock.Now()
+
+		rctx, cancel := ctx, context.CancelFunc(func() {})
+		if j.Timeout > 0 {
+			rctx, cancel = clock.WithTimeout(ctx, s.clock, j.Timeout)
+		}
+		err := j.Func(rctx)
+		cancel()
+
+		j.mu.Lock()
+		j.status.Runs++
+		j.status.LastStart = start
+		j.status.LastDuration = s.clock.Since(start)
+		j.status.LastErr = err
+
+		if j.status.Queued > 0 && ctx.Err() == nil {
+			j.status.Queued--
+			j.mu.Unlock()
+			continue
+		}
+
+		j.status.Running--
+		j.mu.Unlock()
+		return
+	}
+}
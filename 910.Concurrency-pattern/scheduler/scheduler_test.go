@@ -0,0 +1,249 @@
+package scheduler_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arjun1malhotra/a-labs-go/9.Channels/clock"
+	"github.com/arjun1malhotra/a-labs-go/910.Concurrency-pattern/scheduler"
+	"github.com/arjun1malhotra/a-labs-go/911.Testing/leaktest"
+)
+
+var epoch = time.Date(2021, time.March, 5, 10, 0, 0, 0, time.UTC)
+
+// start runs the scheduler and returns a function that stops it.
+func start(t *testing.T, s *scheduler.Scheduler) func() {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.Run(context.Background())
+	}()
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		if err := s.Stop(ctx); err != nil {
+			t.Fatalf("scheduler did not stop : %v", err)
+		}
+		<-errs
+	}
+}
+
+// eventually polls the status of a job until ok returns true.
+func eventually(t *testing.T, s *scheduler.Scheduler, name string, ok func(scheduler.Status) bool) scheduler.Status {
+	deadline := time.Now().Add(time.Second)
+	for {
+		st, _ := s.Status(name)
+		if ok(st) || time.Now().After(deadline) {
+			return st
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestTimeout validates every run gets a context with the job's timeout.
+func TestTimeout(t *testing.T) {
+	leaktest.Check(t)
+
+	t.Log("Given the need to bound how long a run can take.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a run every minute takes longer than its 30s timeout.", testID)
+		{
+			f := clock.NewFake(epoch)
+			s := scheduler.New(f)
+
+			err := s.Add(scheduler.Job{
+				Name:    "report",
+				Spec:    "* * * * *",
+				Timeout: 30 * time.Second,
+				Func: func(ctx context.Context) error {
+					<-ctx.Done()
+					return ctx.Err()
+				},
+			})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to add the job : %v", failed, testID, err)
+			}
+
+			stop := start(t, s)
+			defer stop()
+
+			// Wait for the schedule timer and fire the first run.
+			f.BlockUntil(1)
+			f.Advance(time.Minute)
+
+			// Wait for the run's timeout and the next schedule timer.
+			f.BlockUntil(2)
+			f.Advance(30 * time.Second)
+
+			st := eventually(t, s, "report", func(st scheduler.Status) bool { return st.Runs == 1 })
+
+			if st.Runs == 1 && st.LastErr == context.DeadlineExceeded {
+				t.Logf("\t%s\tTest %d:\tShould time the run out.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould time the run out : %+v", failed, testID, st)
+			}
+
+			if st.LastStart.Equal(epoch.Add(time.Minute)) && st.LastDuration == 30*time.Second {
+				t.Logf("\t%s\tTest %d:\tShould record the start and duration.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould record the start and duration : %v %v", failed, testID, st.LastStart, st.LastDuration)
+			}
+
+			if st.Next.Equal(epoch.Add(2 * time.Minute)) {
+				t.Logf("\t%s\tTest %d:\tShould schedule the next run.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould schedule the next run : %v", failed, testID, st.Next)
+			}
+		}
+	}
+}
+
+// TestOverlap validates each overlap policy when a run is still going when
+// the next one is due.
+func TestOverlap(t *testing.T) {
+	tt := []struct {
+		name    string
+		overlap scheduler.Overlap
+		runs    int
+		skipped int
+	}{
+		{"skip", scheduler.Skip, 1, 1},
+		{"queue", scheduler.Queue, 2, 0},
+		{"allow", scheduler.Allow, 2, 0},
+	}
+
+	t.Log("Given the need to control runs that overlap.")
+	{
+		for testID, test := range tt {
+			t.Logf("\tTest %d:\tWhen the policy is %s.", testID, test.name)
+			{
+				f := clock.NewFake(epoch)
+				s := scheduler.New(f)
+
+				started := make(chan struct{}, 2)
+				release := make(chan struct{})
+
+				s.Add(scheduler.Job{
+					Name:    "sync",
+					Spec:    "@every 1m",
+					Overlap: test.overlap,
+					Func: func(ctx context.Context) error {
+						started <- struct{}{}
+						<-release
+						return nil
+					},
+				})
+
+				stop := start(t, s)
+
+				f.BlockUntil(1)
+				f.Advance(time.Minute)
+				<-started
+
+				f.BlockUntil(1)
+				f.Advance(time.Minute)
+				f.BlockUntil(1)
+
+				close(release)
+				st := eventually(t, s, "sync", func(st scheduler.Status) bool {
+					return st.Runs == test.runs && st.Running == 0
+				})
+				stop()
+
+				if st.Runs == test.runs && st.Skipped == test.skipped {
+					t.Logf("\t%s\tTest %d:\tShould run %d times and skip %d.", succeed, testID, test.runs, test.skipped)
+				} else {
+					t.Errorf("\t%s\tTest %d:\tShould run %d times and skip %d : %+v", failed, testID, test.runs, test.skipped, st)
+				}
+			}
+		}
+	}
+}
+
+// TestStop validates stopping the scheduler cancels the runs in flight.
+func TestStop(t *testing.T) {
+	leaktest.Check(t)
+
+	t.Log("Given the need to shut the scheduler down cleanly.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a run is in flight.", testID)
+		{
+			f := clock.NewFake(epoch)
+			s := scheduler.New(f)
+
+			started := make(chan struct{})
+			s.Add(scheduler.Job{
+				Name: "backup",
+				Spec: "@hourly",
+				Func: func(ctx context.Context) error {
+					close(started)
+					<-ctx.Done()
+					return ctx.Err()
+				},
+			})
+
+			stop := start(t, s)
+
+			f.BlockUntil(1)
+			f.Advance(time.Hour)
+			<-started
+			stop()
+
+			st, _ := s.Status("backup")
+			if st.Runs == 1 && st.LastErr == context.Canceled {
+				t.Logf("\t%s\tTest %d:\tShould cancel the run.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould cancel the run : %+v", failed, testID, st)
+			}
+
+			if err := s.Add(scheduler.Job{Name: "late", Spec: "@daily", Func: func(context.Context) error { return nil }}); err == scheduler.ErrStopped {
+				t.Logf("\t%s\tTest %d:\tShould refuse new jobs.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould refuse new jobs : %v", failed, testID, err)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen the scheduler is run more than once.", testID)
+		{
+			s := scheduler.New(clock.NewFake(epoch))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			errs := make(chan error, 2)
+			for i := 0; i < 2; i++ {
+				go func() {
+					errs <- s.Run(ctx)
+				}()
+			}
+
+			// The call that doesn't run returns right away.
+			second := <-errs
+			cancel()
+			if err := <-errs; err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould run the first time : %v", failed, testID, err)
+			}
+
+			if second == scheduler.ErrStarted {
+				t.Logf("\t%s\tTest %d:\tShould refuse to run while running.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould refuse to run while running : %v", failed, testID, second)
+			}
+
+			if err := s.Run(context.Background()); err == scheduler.ErrStarted {
+				t.Logf("\t%s\tTest %d:\tShould refuse to run once it ran.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould refuse to run once it ran : %v", failed, testID, err)
+			}
+
+			if err := s.Stop(context.Background()); err == nil {
+				t.Logf("\t%s\tTest %d:\tShould still stop.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould still stop : %v", failed, testID, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,238 @@
+// Package leaktest fails a test that leaves goroutines running behind it.
+//
+// Many of the channel patterns leak a goroutine when they're used the wrong
+// way, a child blocked forever sending on an unbuffered channel nobody
+// receives from anymore, or a child ranging over a channel nobody closes.
+// Calling Check at the top of a test snapshots the goroutines that are
+// already running and, once the test is over, reports the stack of every
+// new goroutine that is still around after a grace period.
+//
+//	func TestDrop(t *testing.T) {
+//		leaktest.Check(t)
+//		...
+//	}
+package leaktest
+
+import (
+	"bytes"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TB is the part of testing.TB the leak check needs.
+type TB interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+	Cleanup(func())
+}
+
+// Option changes how a leak check is performed.
+type Option func(*config)
+
+// config holds the settings for a leak check.
+type config struct {
+	grace  time.Duration
+	ignore []string
+}
+
+// Grace sets how long the check waits for new goroutines to finish before
+// reporting them. The default is one second.
+func Grace(d time.Duration) Option {
+	return func(c *config) {
+		c.grace = d
+	}
+}
+
+// Ignore skips goroutines with a function in their stack whose name
+// contains the specified string, for goroutines a test knows will outlive it.
+func Ignore(fn string) Option {
+	return func(c *config) {
+		c.ignore = append(c.ignore, fn)
+	}
+}
+
+// ignoreTop are the functions at the top of a stack that belong to the
+// runtime or the testing framework and are never a leak.
+var ignoreTop = []string{
+	"testing.RunTests",
+	"testing.(*T).Run",
+	"testing.(*T).Parallel",
+	"testing.(*F).Fuzz",
+	"testing.runFuzzing",
+	"testing.tRunner.func1",
+	"os/signal.signal_recv",
+	"os/signal.loop",
+	"runtime.ensureSigM",
+	"runtime.goexit",
+	"runtime/trace.Start",
+}
+
+// Check snapshots the running goroutines and registers a cleanup that fails
+// the test if new goroutines are still running after the grace period.
+func Check(t TB, opts ...Option) {
+	t.Helper()
+
+	cfg := config{
+		grace: time.Second,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	before := make(map[int]bool)
+	for _, g := range goroutines() {
+		before[g.id] = true
+	}
+
+	t.Cleanup(func() {
+		t.Helper()
+
+		leaked := find(before, cfg)
+		if len(leaked) == 0 {
+			return
+		}
+
+		var b strings.Builder
+		for _, g := range leaked {
+			b.WriteString("\n\n")
+			b.WriteString(g.stack)
+		}
+		t.Errorf("found %d leaked goroutine(s):%s", len(leaked), b.String())
+	})
+}
+
+// goroutine is a goroutine found running by a leak check.
+type goroutine struct {
+	id    int
+	top   string
+	stack string
+}
+
+// find polls the running goroutines until every goroutine that isn't in
+// the snapshot and isn't ignored has finished, or the grace period is up,
+// and returns what is left.
+func find(before map[int]bool, cfg config) []goroutine {
+	deadline := time.Now().Add(cfg.grace)
+	wait := time.Millisecond
+
+	for {
+		leaked := leaks(before, cfg)
+		if len(leaked) == 0 || time.Now().After(deadline) {
+			return leaked
+		}
+
+		time.Sleep(wait)
+		if wait < 100*time.Millisecond {
+			wait *= 2
+		}
+	}
+}
+
+// leaks returns the goroutines that are running now and were not in the
+// snapshot, minus the current goroutine and anything ignored.
+func leaks(before map[int]bool, cfg config) []goroutine {
+	self := current()
+
+	var leaked []goroutine
+	for _, g := range goroutines() {
+		if g.id == self || before[g.id] || ignored(g, cfg) {
+			continue
+		}
+		leaked = append(leaked, g)
+	}
+
+	sort.Slice(leaked, func(i, j int) bool {
+		return leaked[i].id < leaked[j].id
+	})
+
+	return leaked
+}
+
+// ignored reports whether the goroutine belongs to the runtime, the testing
+// framework or was asked to be ignored.
+func ignored(g goroutine, cfg config) bool {
+	for _, fn := range ignoreTop {
+		if g.top == fn || strings.HasPrefix(g.top, fn+".") {
+			return true
+		}
+	}
+
+	for _, fn := range cfg.ignore {
+		if strings.Contains(g.stack, fn) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// =============================================================================
+
+// goroutines returns every goroutine currently running.
+func goroutines() []goroutine {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	var gs []goroutine
+	for _, s := range bytes.Split(buf, []byte("\n\n")) {
+		if g, ok := parse(string(s)); ok {
+			gs = append(gs, g)
+		}
+	}
+
+	return gs
+}
+
+// current returns the id of the calling goroutine.
+func current() int {
+	buf := make([]byte, 128)
+	n := runtime.Stack(buf, false)
+
+	g, _ := parse(string(buf[:n]))
+	return g.id
+}
+
+// parse reads a single goroutine from a stack dump that looks like:
+//
+//	goroutine 18 [chan send]:
+//	main.waitForResult.func1()
+//		/path/main.go:118 +0x7e
+//	created by main.waitForResult
+//		/path/main.go:116 +0x6e
+func parse(s string) (goroutine, bool) {
+	s = strings.TrimSpace(s)
+
+	header, rest, _ := strings.Cut(s, "\n")
+	if !strings.HasPrefix(header, "goroutine ") {
+		return goroutine{}, false
+	}
+
+	num, _, _ := strings.Cut(strings.TrimPrefix(header, "goroutine "), " ")
+	id, err := strconv.Atoi(num)
+	if err != nil {
+		return goroutine{}, false
+	}
+
+	top, _, _ := strings.Cut(rest, "\n")
+	if i := strings.LastIndex(top, "("); i > 0 {
+		top = top[:i]
+	}
+
+	g := goroutine{
+		id:    id,
+		top:   top,
+		stack: s,
+	}
+
+	return g, true
+}
@@ -0,0 +1,115 @@
+package leaktest_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arjun1malhotra/a-labs-go/911.Testing/leaktest"
+)
+
+const succeed = "\u2713"
+const failed = "\u2717"
+
+// recorder is a leaktest.TB that records what the check reports.
+type recorder struct {
+	cleanups []func()
+	errors   []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Cleanup(f func()) {
+	r.cleanups = append(r.cleanups, f)
+}
+
+// finish runs the cleanups like the testing package does when a test ends.
+func (r *recorder) finish() {
+	for i := len(r.cleanups) - 1; i >= 0; i-- {
+		r.cleanups[i]()
+	}
+}
+
+// waitForResult is the wait for result pattern with the parent walking
+// away, which leaves the child blocked forever on an unbuffered send.
+func waitForResult(release chan struct{}) {
+	ch := make(chan string)
+
+	go func() {
+		select {
+		case ch <- "data":
+		case <-release:
+		}
+	}()
+}
+
+// TestCheck validates leaked goroutines are reported with their stacks and
+// goroutines that finish inside the grace period are not.
+func TestCheck(t *testing.T) {
+	t.Log("Given the need to find goroutines left behind by a test.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a child is blocked on a send nobody receives.", testID)
+		{
+			release := make(chan struct{})
+			defer close(release)
+
+			var r recorder
+			leaktest.Check(&r, leaktest.Grace(50*time.Millisecond))
+			waitForResult(release)
+			r.finish()
+
+			if len(r.errors) == 1 {
+				t.Logf("\t%s\tTest %d:\tShould fail the test.", succeed, testID)
+			} else {
+				t.Fatalf("\t%s\tTest %d:\tShould fail the test : %v", failed, testID, r.errors)
+			}
+
+			if strings.Contains(r.errors[0], "waitForResult.func1") {
+				t.Logf("\t%s\tTest %d:\tShould print the leaked stack.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould print the leaked stack : %s", failed, testID, r.errors[0])
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen a child finishes inside the grace period.", testID)
+		{
+			var r recorder
+			leaktest.Check(&r)
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+			}()
+			r.finish()
+
+			if len(r.errors) == 0 {
+				t.Logf("\t%s\tTest %d:\tShould not fail the test.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould not fail the test : %v", failed, testID, r.errors)
+			}
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen the leaked function is ignored.", testID)
+		{
+			release := make(chan struct{})
+			defer close(release)
+
+			var r recorder
+			leaktest.Check(&r, leaktest.Grace(10*time.Millisecond), leaktest.Ignore("leaktest_test.waitForResult"))
+			waitForResult(release)
+			r.finish()
+
+			if len(r.errors) == 0 {
+				t.Logf("\t%s\tTest %d:\tShould not fail the test.", succeed, testID)
+			} else {
+				t.Errorf("\t%s\tTest %d:\tShould not fail the test : %v", failed, testID, r.errors)
+			}
+		}
+	}
+}